@@ -11,7 +11,9 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/edrlab/lcp-server/pkg/api"
 	"github.com/edrlab/lcp-server/pkg/conf"
+	"github.com/go-chi/render"
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -40,14 +42,14 @@ func Login(config *conf.Config) http.HandlerFunc {
 		var creds Credentials
 		err := json.NewDecoder(r.Body).Decode(&creds)
 		if err != nil {
-			http.Error(w, "Bad request", http.StatusBadRequest)
+			render.Render(w, r, api.ErrInvalidRequest(errors.New("Bad request")))
 			return
 		}
 
 		// Check credentials using configured dashboard accounts
 		if !validateCredentials(creds.Username, creds.Password, config) {
 			log.Printf("🚫 Connection attempt failed for user: %s", creds.Username)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			render.Render(w, r, api.ErrUnauthorized(errors.New("Unauthorized")))
 			return
 		}
 
@@ -65,7 +67,7 @@ func Login(config *conf.Config) http.HandlerFunc {
 		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 		tokenString, err := token.SignedString([]byte(config.JWT.SecretKey))
 		if err != nil {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			render.Render(w, r, api.ErrServer(nil))
 			return
 		}
 
@@ -112,14 +114,10 @@ func AuthMiddleware(config *conf.Config) func(http.Handler) http.Handler {
 				c, err := r.Cookie("token")
 				if err != nil {
 					if err == http.ErrNoCookie {
-						w.Header().Set("Content-Type", "application/json")
-						w.WriteHeader(http.StatusUnauthorized)
-						json.NewEncoder(w).Encode(map[string]string{"error": "No authentication token provided"})
+						render.Render(w, r, api.ErrUnauthorized(errors.New("No authentication token provided")))
 						return
 					}
-					w.Header().Set("Content-Type", "application/json")
-					w.WriteHeader(http.StatusBadRequest)
-					json.NewEncoder(w).Encode(map[string]string{"error": "Bad request"})
+					render.Render(w, r, api.ErrInvalidRequest(errors.New("Bad request")))
 					return
 				}
 				tokenStr = c.Value
@@ -132,17 +130,15 @@ func AuthMiddleware(config *conf.Config) func(http.Handler) http.Handler {
 
 			if err != nil {
 				log.Println("JWT parse error:", err)
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusUnauthorized)
 
 				// Handle JWT validation errors using modern Go error handling
 				errorMessage := "Invalid token"
-				var errorCode string
+				errResponse := api.ErrUnauthorized
 
 				// Use errors.Is() to check for specific JWT errors in composite errors
 				if errors.Is(err, jwt.ErrTokenExpired) {
 					errorMessage = "Token has expired"
-					errorCode = "TOKEN_EXPIRED"
+					errResponse = api.ErrTokenExpired
 				} else if errors.Is(err, jwt.ErrSignatureInvalid) { // msg is "token signature is invalid"
 					errorMessage = "Invalid token signature"
 				} else if errors.Is(err, jwt.ErrTokenNotValidYet) {
@@ -156,18 +152,12 @@ func AuthMiddleware(config *conf.Config) func(http.Handler) http.Handler {
 					errorMessage = "Invalid or malformed token"
 				}
 
-				response := map[string]string{"error": errorMessage}
-				if errorCode != "" {
-					response["code"] = errorCode
-				}
-				json.NewEncoder(w).Encode(response)
+				render.Render(w, r, errResponse(errors.New(errorMessage)))
 				return
 			}
 
 			if !token.Valid {
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusUnauthorized)
-				json.NewEncoder(w).Encode(map[string]string{"error": "Token is not valid"})
+				render.Render(w, r, api.ErrUnauthorized(errors.New("Token is not valid")))
 				return
 			}
 
@@ -0,0 +1,58 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package main
+
+import (
+	"expvar"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/edrlab/lcp-server/pkg/sign"
+)
+
+// defaultExpiryWarningDays is the warning window before the expiry of the provider certificate.
+const defaultExpiryWarningDays = 30
+
+// certificateCheckInterval is the interval between the checks of the expiry of the provider certificate.
+const certificateCheckInterval = 12 * time.Hour
+
+// Expiry of the provider certificate, published as JSON by the expvar handler.
+var (
+	// days before the expiry of the certificate, negative once expired
+	metricCertificateExpiryDays = expvar.NewInt("certificate_expiry_days")
+	// valid, expiring or expired
+	metricCertificateStatus = expvar.NewString("certificate_status")
+)
+
+// checkCertificate checks the expiry of the provider certificate, logs a warning if it expires
+// within the warning window or has expired, and updates the metrics. It returns the expiry state.
+func (s *Server) checkCertificate() (string, error) {
+	days := s.Config.Certificate.ExpiryWarningDays
+	if days <= 0 {
+		days = defaultExpiryWarningDays
+	}
+	now := time.Now()
+	notAfter, status, err := sign.CertificateExpiry(s.Cert, time.Duration(days)*24*time.Hour, now)
+	if err != nil {
+		return "", err
+	}
+	metricCertificateExpiryDays.Set(int64(notAfter.Sub(now).Hours() / 24))
+	metricCertificateStatus.Set(status)
+	switch status {
+	case sign.CertificateExpired:
+		log.Errorf("The provider certificate expired on %s: reading systems will reject the licenses", notAfter.Format(time.RFC822))
+	case sign.CertificateExpiring:
+		log.Warnf("The provider certificate expires on %s", notAfter.Format(time.RFC822))
+	}
+	return status, nil
+}
+
+// monitorCertificate checks the expiry of the provider certificate periodically.
+func (s *Server) monitorCertificate() {
+	for range time.Tick(certificateCheckInterval) {
+		if _, err := s.checkCertificate(); err != nil {
+			log.Errorf("Checking the provider certificate failed: %v", err)
+		}
+	}
+}
@@ -6,8 +6,9 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"expvar"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
 
@@ -15,14 +16,43 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/go-chi/render"
+	log "github.com/sirupsen/logrus"
 
 	"github.com/edrlab/lcp-server/pkg/api"
+	"github.com/edrlab/lcp-server/pkg/sign"
 )
 
+// responseFilter is applied to encryption responses before their serialization.
+// Deployments which must redact or complete responses centrally replace it, e.g.
+//
+//	var responseFilter = func(m *api.EncryptResponse) { m.EncryptionKey = "" }
+var responseFilter = api.NoResponseFilter
+
+// postProcessors are the post-processing steps which the post_processing configuration may apply
+// to publications before their encryption, by name. Deployments register their steps here, e.g.
+//
+//	var postProcessors = map[string]api.PostProcessor{"linearize": linearizePDF}
+var postProcessors = map[string]api.PostProcessor{}
+
+// auditSink writes the audit records of sensitive operations, in the application logs by default.
+// Deployments which must keep them in a dedicated store replace it, e.g.
+//
+//	var auditSink = func(rec api.AuditRecord) error { return auditStore.Append(rec) }
+var auditSink = api.LogAuditSink
+
 func (s *Server) setRoutes() *chi.Mux {
 
 	// Set api controller dependencies
 	a := api.NewAPICtrl(s.Config, s.Store, s.Cert)
+	a.ResponseFilter = responseFilter
+	a.AuditSink = auditSink
+	for name, step := range postProcessors {
+		a.PostProcessors[name] = step
+	}
+	if err := a.CheckPostProcessing(); err != nil {
+		log.Println("Configuration failed: " + err.Error())
+		os.Exit(1)
+	}
 
 	// Define the router
 	r := chi.NewRouter()
@@ -33,6 +63,10 @@ func (s *Server) setRoutes() *chi.Mux {
 	// Heartbeat (excluded from logs)
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("The LCP Server is running!"))
+		// a certificate near expiry is reported, without failing the check
+		if status := metricCertificateStatus.Value(); status == sign.CertificateExpiring || status == sign.CertificateExpired {
+			w.Write([]byte("\nWarning: the provider certificate is " + status))
+		}
 	})
 
 	// Group for all other routes
@@ -67,6 +101,9 @@ func (s *Server) setRoutes() *chi.Mux {
 			})
 		}
 
+		// Error codes (public, cacheable)
+		r.Get("/error-codes", a.ListErrorCodes) // GET /error-codes
+
 		// Status document management
 		r.Group(func(r chi.Router) {
 			r.Use(render.SetContentType(render.ContentTypeJSON))
@@ -92,9 +129,10 @@ func (s *Server) setRoutes() *chi.Mux {
 				r.Post("/", a.CreatePublication)                      // POST /publications
 
 				r.Route("/{publicationID}", func(r chi.Router) {
-					r.Get("/", a.GetPublication)       // GET /publications/123
-					r.Put("/", a.UpdatePublication)    // PUT /publications/123
-					r.Delete("/", a.DeletePublication) // DELETE /publications/123
+					r.Get("/", a.GetPublication)                              // GET /publications/123
+					r.Put("/", a.UpdatePublication)                           // PUT /publications/123
+					r.Delete("/", a.DeletePublication)                        // DELETE /publications/123
+					r.Post("/refresh-metadata", a.RefreshPublicationMetadata) // POST /publications/123/refresh-metadata
 				})
 				// get publication by AltID
 				r.Get("/altid/{altID}", a.GetPublicationByAltID) // GET /publications/altid/alt123	
@@ -129,6 +167,9 @@ func (s *Server) setRoutes() *chi.Mux {
 
 			// License revocation
 			r.Put("/revoke/{licenseID}", a.Revoke) // PUT /revoke/123
+
+			// Server metrics
+			r.Get("/metrics", expvar.Handler().ServeHTTP) // GET /metrics
 		})
 
 		// Dashboard data
@@ -142,6 +183,8 @@ func (s *Server) setRoutes() *chi.Mux {
 				r.Get("/overshared", a.GetOversharedLicenses) // GET /dashdata/overshared
 				r.Put("/revoke/{licenseID}", a.Revoke)        // PUT /dashdata/revoke/license123
 				r.Post("/encrypt", a.EncryptEPUB)             // POST /dashdata/encrypt
+				r.Post("/encrypt-bundle", a.EncryptBundle)    // POST /dashdata/encrypt-bundle
+				r.Post("/encrypt-base64", a.EncryptBase64)    // POST /dashdata/encrypt-base64
 				// these dashboard routes allow alt authentication before accessing crud functions
 				r.With(paginate).Get("/publications", a.ListPublications)                      // GET /dashdata/publications
 				r.Delete("/publications/{publicationID}", a.DeletePublication)                  // DELETE /dashdata/publication/publication123
@@ -185,10 +228,5 @@ func paginate(next http.Handler) http.Handler {
 
 // notFoundProblemDetail formats not found errors as problem details, for the sake of consistency.
 func notFoundProblemDetail(w http.ResponseWriter, r *http.Request) {
-	response := map[string]string{"type": "about:blank", "title": "Endpoint not found."}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusNotFound)
-
-	json.NewEncoder(w).Encode(response)
+	render.Render(w, r, api.ErrNotFound)
 }
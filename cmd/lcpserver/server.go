@@ -20,6 +20,7 @@ import (
 	"github.com/go-chi/chi/v5"
 
 	"github.com/edrlab/lcp-server/pkg/conf"
+	"github.com/edrlab/lcp-server/pkg/sign"
 	"github.com/edrlab/lcp-server/pkg/stor"
 )
 
@@ -115,6 +116,18 @@ func (s *Server) initialize() {
 	}
 	s.Cert = &cert
 
+	// Check the expiry of the certificate, which must not be expired unless allowed
+	status, err := s.checkCertificate()
+	if err != nil {
+		log.Println("Checking the X509 certificate failed: " + err.Error())
+		os.Exit(1)
+	}
+	if status == sign.CertificateExpired && !s.Config.Certificate.AllowExpired {
+		log.Println("The provider certificate has expired, set allow_expired to start anyway")
+		os.Exit(1)
+	}
+	go s.monitorCertificate()
+
 	// Init routes
 	s.Router = s.setRoutes()
 }
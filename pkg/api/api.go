@@ -17,13 +17,28 @@ type APICtrl struct {
 	*conf.Config
 	stor.Store
 	Cert *tls.Certificate
+	// ResponseFilter is applied to every encryption response before its serialization,
+	// e.g. for redacting fields. It is set at startup and must not be nil.
+	ResponseFilter func(*EncryptResponse)
+	// PostProcessors are the post-processing steps which the post_processing configuration
+	// may apply to publications before their encryption, by name. They are set at startup.
+	PostProcessors map[string]PostProcessor
+	// AuditSink writes the audit records of sensitive operations. It is set at startup and must not be nil.
+	AuditSink AuditSink
+	locks     *uuidLocks
+	uploads   *memoryBudget
 }
 
 // NewAPICtrl returns a new API controller
 func NewAPICtrl(cf *conf.Config, st stor.Store, cr *tls.Certificate) *APICtrl {
 	return &APICtrl{
-		Config: cf,
-		Store:  st,
-		Cert:   cr,
+		Config:         cf,
+		Store:          st,
+		Cert:           cr,
+		ResponseFilter: NoResponseFilter,
+		PostProcessors: map[string]PostProcessor{"none": NoPostProcessor},
+		AuditSink:      LogAuditSink,
+		locks:          newUUIDLocks(),
+		uploads:        &memoryBudget{},
 	}
 }
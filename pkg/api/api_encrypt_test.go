@@ -0,0 +1,1546 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/edrlab/lcp-server/pkg/conf"
+	"github.com/edrlab/lcp-server/pkg/keywrap"
+	"github.com/edrlab/lcp-server/pkg/meta"
+	"github.com/edrlab/lcp-server/pkg/pack"
+	"github.com/edrlab/lcp-server/pkg/stor"
+	"github.com/edrlab/lcp-server/pkg/test"
+	"github.com/readium/readium-lcp-server/encrypt"
+	"github.com/readium/readium-lcp-server/epub"
+)
+
+// ---
+// Utilities - Encryption
+// ---
+
+// encryptPublication posts an EPUB made of the given files to the encryption endpoint,
+// with additional form fields.
+func encryptPublication(t *testing.T, files map[string]string, fields map[string]string) *httptest.ResponseRecorder {
+	return executeRequest(newEncryptRequest(t, files, fields))
+}
+
+// newEncryptRequest returns an encryption request for an EPUB made of the given files.
+func newEncryptRequest(t *testing.T, files map[string]string, fields map[string]string) *http.Request {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for key, val := range fields {
+		mw.WriteField(key, val)
+	}
+	fw, err := mw.CreateFormFile("file", "test.epub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(test.BuildEPUB(files))
+	mw.Close()
+
+	req, _ := http.NewRequest("POST", "/encrypt", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+// encryptMetadata returns the metadata of an encryption response
+func encryptMetadata(t *testing.T, response *httptest.ResponseRecorder) EncryptResponse {
+	var metadata EncryptResponse
+	if err := json.Unmarshal([]byte(response.Header().Get("X-Encrypt-Metadata")), &metadata); err != nil {
+		t.Fatalf("Invalid encryption metadata: %v", err)
+	}
+	return metadata
+}
+
+// a chapter referencing a remote image
+var remoteChapter = map[string]string{
+	"OEBPS/chapter1.xhtml": `<html><body><img src="https://img.example.com/pic.png"/></body></html>`,
+}
+
+func TestEncryptEPUB(t *testing.T) {
+	response := encryptPublication(t, map[string]string{
+		"OEBPS/nav.xhtml":      `<html><body><nav><a href="chapter1.xhtml">Chapter</a></nav></body></html>`,
+		"OEBPS/chapter1.xhtml": `<html><body><p>Hello</p></body></html>`,
+	}, nil)
+
+	if checkResponseCode(t, http.StatusOK, response) {
+		metadata := encryptMetadata(t, response)
+		if metadata.UUID == "" || metadata.EncryptionKey == "" || metadata.Checksum == "" {
+			t.Errorf("Incomplete metadata: %+v", metadata)
+		}
+		if metadata.Title != "Test Book" {
+			t.Errorf("Expected the title of the EPUB, got %q", metadata.Title)
+		}
+		if int(metadata.Size) != response.Body.Len() {
+			t.Errorf("Expected size %d, got %d", response.Body.Len(), metadata.Size)
+		}
+		if metadata.HasRemoteResources {
+			t.Error("Unexpected remote resources")
+		}
+	}
+}
+
+func TestEncryptFingerprint(t *testing.T) {
+	files := map[string]string{"OEBPS/chapter1.xhtml": `<html><body><p>Fingerprint</p></body></html>`}
+	first := encryptPublication(t, files, nil)
+	second := encryptPublication(t, files, nil)
+	if !checkResponseCode(t, http.StatusOK, first) || !checkResponseCode(t, http.StatusOK, second) {
+		return
+	}
+	m1, m2 := encryptMetadata(t, first), encryptMetadata(t, second)
+	if m1.EncryptionKey == m2.EncryptionKey {
+		t.Fatal("Expected different encryption keys")
+	}
+	if m1.Fingerprint == "" || m1.Fingerprint != m2.Fingerprint {
+		t.Errorf("Expected the same fingerprint, got %q and %q", m1.Fingerprint, m2.Fingerprint)
+	}
+}
+
+func TestEncryptRemoteResources(t *testing.T) {
+	// warning only
+	response := encryptPublication(t, remoteChapter, nil)
+	if checkResponseCode(t, http.StatusOK, response) {
+		metadata := encryptMetadata(t, response)
+		if !metadata.HasRemoteResources || len(metadata.Warnings) != 1 {
+			t.Errorf("Expected a remote resource warning, got %+v", metadata)
+		}
+	}
+
+	// rejection
+	response = encryptPublication(t, remoteChapter, map[string]string{"reject_remote_resources": "true"})
+	checkResponseCode(t, http.StatusUnprocessableEntity, response)
+}
+
+func TestEncryptMemoryCap(t *testing.T) {
+	// a dedicated controller with a global cap on in-memory uploads
+	h := newTestCtrl(t, func(cf *conf.Config) {
+		cf.Encrypt.MaxTotalInMemoryBytes = 1 << 20
+	})
+
+	// the budget is used by other uploads
+	used := metricUploadMemoryBytes.Value()
+	if !h.uploads.reserve(h.Config.Encrypt.MaxTotalInMemoryBytes-100, h.Config.Encrypt.MaxTotalInMemoryBytes) {
+		t.Fatal("Unable to reserve the budget")
+	}
+	if metricUploadMemoryBytes.Value() != used+h.Config.Encrypt.MaxTotalInMemoryBytes-100 {
+		t.Errorf("Unexpected memory usage metric %d", metricUploadMemoryBytes.Value())
+	}
+	response := httptest.NewRecorder()
+	h.EncryptEPUB(response, newEncryptRequest(t, nil, nil))
+	checkResponseCode(t, http.StatusServiceUnavailable, response)
+
+	// the budget is available again
+	h.uploads.release(h.Config.Encrypt.MaxTotalInMemoryBytes - 100)
+	response = httptest.NewRecorder()
+	h.EncryptEPUB(response, newEncryptRequest(t, nil, nil))
+	checkResponseCode(t, http.StatusOK, response)
+	if metricUploadMemoryBytes.Value() != used {
+		t.Errorf("Expected the memory to be released, got %d", metricUploadMemoryBytes.Value())
+	}
+}
+
+func TestTempFileModes(t *testing.T) {
+	dir, err := newWorkDir("lcp-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fi, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0700 {
+		t.Errorf("Expected a 700 temp dir, got %o", fi.Mode().Perm())
+	}
+
+	// default and configured modes
+	h := newTestCtrl(t, nil)
+	for _, mode := range []os.FileMode{0, 0640} {
+		h.Config.Encrypt.TempFileMode = mode
+		expected := mode
+		if expected == 0 {
+			expected = 0600
+		}
+		path := filepath.Join(dir, "test.epub")
+		if err := saveMultipartFile(strings.NewReader("content"), path, h.tempFileMode()); err != nil {
+			t.Fatal(err)
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != expected {
+			t.Errorf("Expected a %o temp file, got %o", expected, fi.Mode().Perm())
+		}
+		os.Remove(path)
+	}
+}
+
+func TestEncryptOutputMismatch(t *testing.T) {
+	defer func(orig func(string, string, string, pack.Options) (*encrypt.Publication, []pack.Resource, []string, error)) {
+		processEncryption = orig
+	}(processEncryption)
+
+	for name, alter := range map[string]func(*encrypt.Publication){
+		"size":    func(pub *encrypt.Publication) { pub.Size++ },
+		"missing": func(pub *encrypt.Publication) { pub.FileName = "missing.epub" },
+	} {
+		processEncryption = func(contentID, inputPath, outputDir string, opts pack.Options) (*encrypt.Publication, []pack.Resource, []string, error) {
+			pub, resources, warnings, err := encryptFile(contentID, inputPath, outputDir, opts)
+			if err == nil {
+				alter(pub)
+			}
+			return pub, resources, warnings, err
+		}
+		response := encryptPublication(t, nil, nil)
+		if checkResponseCode(t, http.StatusInternalServerError, response) {
+			if !strings.Contains(response.Body.String(), "verification failed") {
+				t.Errorf("%s: unexpected error %q", name, response.Body.String())
+			}
+		}
+	}
+}
+
+func TestEncryptSelfTest(t *testing.T) {
+	files := map[string]string{"OEBPS/chapter1.xhtml": `<html><body><p>Hello</p></body></html>`}
+	response := encryptPublication(t, files, map[string]string{"self_test": "true"})
+	checkResponseCode(t, http.StatusOK, response)
+
+	// a content key which does not match the encrypted resources
+	defer func(orig func(string, string, string, pack.Options) (*encrypt.Publication, []pack.Resource, []string, error)) {
+		processEncryption = orig
+	}(processEncryption)
+	processEncryption = func(contentID, inputPath, outputDir string, opts pack.Options) (*encrypt.Publication, []pack.Resource, []string, error) {
+		pub, resources, warnings, err := encryptFile(contentID, inputPath, outputDir, opts)
+		if err == nil {
+			pub.EncryptionKey = bytes.Repeat([]byte{1}, len(pub.EncryptionKey))
+		}
+		return pub, resources, warnings, err
+	}
+	response = encryptPublication(t, files, nil)
+	checkResponseCode(t, http.StatusOK, response)
+	response = encryptPublication(t, files, map[string]string{"self_test": "true"})
+	if checkResponseCode(t, http.StatusInternalServerError, response) {
+		if !strings.Contains(response.Body.String(), "self-test failed") || !strings.Contains(response.Body.String(), CodeSelfTest) {
+			t.Errorf("Unexpected error %q", response.Body.String())
+		}
+	}
+}
+
+func TestEncryptClearPolicy(t *testing.T) {
+	files := map[string]string{
+		"OEBPS/nav.xhtml":      `<html><body><nav><a href="chapter1.xhtml">Chapter</a></nav></body></html>`,
+		"OEBPS/chapter1.xhtml": `<html><body><p>Hello</p></body></html>`,
+	}
+	for policy, navEncrypted := range map[string]bool{"": false, "preview": false, "required": true} {
+		response := encryptPublication(t, files, map[string]string{"clear_policy": policy, "resource_report": "true"})
+		if !checkResponseCode(t, http.StatusOK, response) {
+			continue
+		}
+		metadata := encryptMetadata(t, response)
+		found := false
+		for _, res := range metadata.Resources {
+			if res.Path == "OEBPS/nav.xhtml" {
+				found = true
+				if res.Encrypted != navEncrypted {
+					t.Errorf("Policy %q: unexpected processing of the nav document %+v", policy, res)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("Policy %q: missing nav document in the resource report", policy)
+		}
+	}
+
+	// no report by default
+	response := encryptPublication(t, nil, nil)
+	if checkResponseCode(t, http.StatusOK, response) && len(encryptMetadata(t, response).Resources) != 0 {
+		t.Error("Unexpected resource report")
+	}
+
+	response = encryptPublication(t, nil, map[string]string{"clear_policy": "unknown"})
+	checkResponseCode(t, http.StatusBadRequest, response)
+}
+
+func TestEncryptFontObfuscation(t *testing.T) {
+	files := map[string]string{
+		"OEBPS/content.opf": test.OPF(`<dc:title>Fonts</dc:title>`,
+			`<item id="font" href="font.otf" media-type="application/vnd.ms-opentype"/>`,
+			`<spine/>`),
+		"OEBPS/font.otf": "font",
+		"META-INF/encryption.xml": `<encryption xmlns="urn:oasis:names:tc:opendocument:xmlns:container" xmlns:enc="http://www.w3.org/2001/04/xmlenc#">
+  <enc:EncryptedData>
+    <enc:EncryptionMethod Algorithm="http://www.idpf.org/2008/embedding"/>
+    <enc:CipherData><enc:CipherReference URI="OEBPS/font.otf"/></enc:CipherData>
+  </enc:EncryptedData>
+</encryption>`,
+	}
+	for policy, reason := range map[string]string{"": pack.ReasonAlreadyEncrypted, "strip": pack.ReasonDeobfuscated} {
+		response := encryptPublication(t, files, map[string]string{"font_obfuscation": policy, "resource_report": "true"})
+		if !checkResponseCode(t, http.StatusOK, response) {
+			continue
+		}
+		metadata := encryptMetadata(t, response)
+		if !slices.ContainsFunc(metadata.Warnings, func(w string) bool { return strings.Contains(w, "OEBPS/font.otf") }) {
+			t.Errorf("Policy %q: no warning on the font, got %q", policy, metadata.Warnings)
+		}
+		for _, res := range metadata.Resources {
+			if res.Path == "OEBPS/font.otf" && res.Reason != reason {
+				t.Errorf("Policy %q: unexpected processing of the font %+v", policy, res)
+			}
+		}
+	}
+
+	response := encryptPublication(t, files, map[string]string{"font_obfuscation": "unknown"})
+	checkResponseCode(t, http.StatusBadRequest, response)
+}
+
+func TestPublicationChanges(t *testing.T) {
+	previous := &stor.Publication{Title: "Title", Size: 1000, Checksum: "AAAA"}
+	if c := publicationChanges(previous, "Title", 1000, "AAAA"); *c != (PublicationChanges{}) {
+		t.Errorf("Expected no changes, got %+v", c)
+	}
+	c := publicationChanges(previous, "Title", 1200, "BBBB")
+	if c.Title != nil || *c.Size != (Change{uint32(1000), uint32(1200)}) || *c.Checksum != (Change{"AAAA", "BBBB"}) {
+		t.Errorf("Unexpected changes %+v", c)
+	}
+}
+
+func TestEncryptTenantMasterKey(t *testing.T) {
+	aliceKey, bobKey := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+	h := newTestCtrl(t, func(cf *conf.Config) {
+		cf.Encrypt.TenantMasterKeys = map[string]string{
+			"alice": base64.StdEncoding.EncodeToString(aliceKey),
+			"bob":   base64.StdEncoding.EncodeToString(bobKey),
+		}
+	})
+
+	req := newEncryptRequest(t, nil, nil)
+	req.Header.Set("X-Username", "alice")
+	response := httptest.NewRecorder()
+	h.EncryptEPUB(response, req)
+	if !checkResponseCode(t, http.StatusOK, response) {
+		return
+	}
+	metadata := encryptMetadata(t, response)
+	key, _ := base64.StdEncoding.DecodeString(metadata.EncryptionKey)
+	wrapped, err := base64.StdEncoding.DecodeString(metadata.WrappedEncryptionKey)
+	if err != nil || len(wrapped) == 0 {
+		t.Fatalf("Missing wrapped key: %v", err)
+	}
+
+	// the tenant unwraps its key
+	unwrapped, err := keywrap.Unwrap(aliceKey, wrapped)
+	if err != nil || !bytes.Equal(unwrapped, key) {
+		t.Errorf("Expected the content key, got %x (%v)", unwrapped, err)
+	}
+	// another tenant fails
+	if _, err := keywrap.Unwrap(bobKey, wrapped); !errors.Is(err, keywrap.ErrUnwrap) {
+		t.Errorf("Expected a cross-tenant unwrap to fail, got %v", err)
+	}
+
+	// an account without master key is rejected
+	req = newEncryptRequest(t, nil, nil)
+	req.Header.Set("X-Username", "carol")
+	response = httptest.NewRecorder()
+	h.EncryptEPUB(response, req)
+	checkResponseCode(t, http.StatusForbidden, response)
+}
+
+func TestEncryptMetrics(t *testing.T) {
+	files := map[string]string{"OEBPS/chapter1.xhtml": `<html><body><p>A short chapter of six words.</p></body></html>`}
+
+	// not requested
+	response := encryptPublication(t, files, nil)
+	if checkResponseCode(t, http.StatusOK, response) && encryptMetadata(t, response).Metrics != nil {
+		t.Error("Unexpected metrics")
+	}
+
+	response = encryptPublication(t, files, map[string]string{"include_metrics": "true"})
+	if checkResponseCode(t, http.StatusOK, response) {
+		metrics := encryptMetadata(t, response).Metrics
+		if metrics == nil || metrics.WordCount != 6 {
+			t.Errorf("Expected 6 words, got %+v", metrics)
+		}
+	}
+}
+
+func TestEncryptEscrowedKey(t *testing.T) {
+	aliceKey, bobKey := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+	h := newTestCtrl(t, func(cf *conf.Config) {
+		cf.Encrypt.TenantMasterKeys = map[string]string{
+			"alice": base64.StdEncoding.EncodeToString(aliceKey),
+			"bob":   base64.StdEncoding.EncodeToString(bobKey),
+		}
+	})
+	encryptAs := func(account string, fields map[string]string) *httptest.ResponseRecorder {
+		req := newEncryptRequest(t, map[string]string{"OEBPS/chapter1.xhtml": `<html><body><p>Escrow</p></body></html>`}, fields)
+		req.Header.Set("X-Username", account)
+		response := httptest.NewRecorder()
+		h.EncryptEPUB(response, req)
+		return response
+	}
+
+	response := encryptAs("alice", nil)
+	if !checkResponseCode(t, http.StatusOK, response) {
+		return
+	}
+	original := encryptMetadata(t, response)
+	if original.Changes != nil {
+		t.Errorf("Unexpected changes for a new publication: %+v", original.Changes)
+	}
+	fields := map[string]string{"uuid": original.UUID, "wrapped_encryption_key": original.WrappedEncryptionKey}
+
+	// the outcome of each re-encryption is audited
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	// the publication must be stored
+	checkResponseCode(t, http.StatusNotFound, encryptAs("alice", fields))
+	if audit := logs.String(); !strings.Contains(audit, "account=alice audit=reencrypt result=failure status=404 uuid="+original.UUID) {
+		t.Errorf("Expected the audit of the failure, got %s", audit)
+	}
+	key, _ := base64.StdEncoding.DecodeString(original.EncryptionKey)
+	publication := &stor.Publication{UUID: original.UUID, ContentType: original.ContentType, Title: original.Title,
+		EncryptionKey: key, Href: "http://example.com/escrow.epub", Size: original.Size, Checksum: original.Checksum}
+	if err := s.Store.Publication().Create(publication); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Store.Publication().Delete(publication)
+
+	// re-encryption under the same UUID, with the same key: the licenses of the publication still work
+	logs.Reset()
+	response = encryptAs("alice", fields)
+	if !strings.Contains(logs.String(), "account=alice audit=reencrypt result=success status=200") {
+		t.Errorf("Expected the audit of the success, got %s", logs.String())
+	}
+	if checkResponseCode(t, http.StatusOK, response) {
+		metadata := encryptMetadata(t, response)
+		if metadata.UUID != original.UUID || metadata.EncryptionKey != original.EncryptionKey {
+			t.Errorf("Expected %s and the original key, got %s", original.UUID, metadata.UUID)
+		}
+		// the IVs are new, the title is unchanged
+		if c := metadata.Changes; c == nil || c.Title != nil || c.Checksum == nil || c.Checksum.Previous != original.Checksum || c.Checksum.New != metadata.Checksum {
+			t.Errorf("Unexpected changes %+v", c)
+		}
+		input := filepath.Join(t.TempDir(), "input.epub")
+		output := filepath.Join(t.TempDir(), "output.epub")
+		os.WriteFile(input, test.BuildEPUB(map[string]string{"OEBPS/chapter1.xhtml": `<html><body><p>Escrow</p></body></html>`}), 0600)
+		os.WriteFile(output, response.Body.Bytes(), 0600)
+		if err := pack.SelfTest(input, output, key); err != nil {
+			t.Errorf("The original key does not decrypt the new output: %v", err)
+		}
+	}
+
+	// a new title
+	response = encryptAs("alice", map[string]string{"uuid": original.UUID, "wrapped_encryption_key": original.WrappedEncryptionKey, "title": "New Title"})
+	if checkResponseCode(t, http.StatusOK, response) {
+		if c := encryptMetadata(t, response).Changes; c == nil || c.Title == nil || c.Title.Previous != original.Title || c.Title.New != "New Title" {
+			t.Errorf("Expected a title change, got %+v", c)
+		}
+	}
+
+	// the content key of another publication
+	response = encryptAs("alice", nil)
+	if checkResponseCode(t, http.StatusOK, response) {
+		other := encryptMetadata(t, response)
+		checkResponseCode(t, http.StatusConflict, encryptAs("alice", map[string]string{"uuid": original.UUID, "wrapped_encryption_key": other.WrappedEncryptionKey}))
+	}
+
+	// the key of another tenant, a malformed key
+	checkResponseCode(t, http.StatusBadRequest, encryptAs("bob", fields))
+	checkResponseCode(t, http.StatusBadRequest, encryptAs("alice", map[string]string{"uuid": original.UUID, "wrapped_encryption_key": "AAAA"}))
+	checkResponseCode(t, http.StatusBadRequest, encryptAs("alice", map[string]string{"uuid": "not-a-uuid", "wrapped_encryption_key": original.WrappedEncryptionKey}))
+
+	// a failing audit sink: best effort by default, the output is not delivered in fail-closed mode
+	var records []AuditRecord
+	h.AuditSink = func(rec AuditRecord) error {
+		records = append(records, rec)
+		return errors.New("audit store down")
+	}
+	logs.Reset()
+	checkResponseCode(t, http.StatusOK, encryptAs("alice", fields))
+	if !strings.Contains(logs.String(), "audit store down") || len(records) != 1 || records[0].Result != "success" {
+		t.Errorf("Expected a logged audit failure, got %+v and %s", records, logs.String())
+	}
+	records = nil
+	h.Config.AuditMode = conf.AuditFailClosed
+	response = encryptAs("alice", fields)
+	if checkResponseCode(t, http.StatusServiceUnavailable, response) && !strings.Contains(response.Body.String(), CodeAuditUnavailable) {
+		t.Errorf("Expected the %s code, got %s", CodeAuditUnavailable, response.Body.String())
+	}
+	if len(records) != 2 || records[0].Result != "success" || records[1].Result != "failure" || records[1].Status != http.StatusServiceUnavailable {
+		t.Errorf("Expected the audit of the success then of the failure, got %+v", records)
+	}
+	// failures are still returned as such
+	checkResponseCode(t, http.StatusBadRequest, encryptAs("bob", fields))
+	h.Config.AuditMode, h.AuditSink = "", LogAuditSink
+
+	// key escrow is required
+	response = httptest.NewRecorder()
+	req := newEncryptRequest(t, nil, fields)
+	req.Header.Set("X-Username", "alice")
+	newTestCtrl(t, nil).EncryptEPUB(response, req)
+	checkResponseCode(t, http.StatusForbidden, response)
+}
+
+func TestEncryptCoverColors(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{0x20, 0x40, 0x60, 0xff}}, image.Point{}, draw.Src)
+	var cover bytes.Buffer
+	if err := png.Encode(&cover, img); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"OEBPS/content.opf": test.OPF(`<dc:title>Cover</dc:title>`,
+			`<item id="img" href="cover.png" media-type="image/png" properties="cover-image"/>`,
+			`<spine/>`),
+		"OEBPS/cover.png": cover.String(),
+	}
+
+	// not requested
+	response := encryptPublication(t, files, nil)
+	if checkResponseCode(t, http.StatusOK, response) && encryptMetadata(t, response).CoverColor != "" {
+		t.Error("Unexpected cover color")
+	}
+
+	response = encryptPublication(t, files, map[string]string{"cover_colors": "true"})
+	if checkResponseCode(t, http.StatusOK, response) {
+		metadata := encryptMetadata(t, response)
+		if metadata.CoverColor != "#204060" || len(metadata.CoverPalette) != 1 {
+			t.Errorf("Unexpected cover colors %q %q", metadata.CoverColor, metadata.CoverPalette)
+		}
+	}
+
+	// no cover
+	response = encryptPublication(t, nil, map[string]string{"cover_colors": "true"})
+	if checkResponseCode(t, http.StatusOK, response) {
+		if metadata := encryptMetadata(t, response); metadata.CoverColor != "" || metadata.CoverPalette != nil {
+			t.Errorf("Unexpected cover colors %q %q", metadata.CoverColor, metadata.CoverPalette)
+		}
+	}
+}
+
+func TestEncryptCoverOrder(t *testing.T) {
+	files := map[string]string{
+		"OEBPS/content.opf": test.OPF(`<dc:title>Covers</dc:title>`,
+			`<item id="img" href="images/cover.png" media-type="image/png" properties="cover-image"/>
+			<item id="old" href="images/old-cover.png" media-type="image/png"/>`,
+			`<spine/><guide><reference type="cover" href="images/old-cover.png"/></guide>`),
+	}
+	h := newTestCtrl(t, nil)
+
+	cases := []struct {
+		order []string
+		path  string
+	}{
+		{nil, "OEBPS/images/cover.png"},
+		{[]string{"guide", "cover-image"}, "OEBPS/images/old-cover.png"},
+	}
+	for _, c := range cases {
+		h.Config.Encrypt.CoverOrder = c.order
+		response := httptest.NewRecorder()
+		h.EncryptEPUB(response, newEncryptRequest(t, files, nil))
+		if !checkResponseCode(t, http.StatusOK, response) {
+			continue
+		}
+		cover := encryptMetadata(t, response).Cover
+		if cover == nil || cover.Path != c.path || len(cover.Conflicts) != 1 {
+			t.Errorf("%q: unexpected cover %+v", c.order, cover)
+		}
+	}
+
+	// no cover
+	response := encryptPublication(t, nil, nil)
+	if checkResponseCode(t, http.StatusOK, response) && encryptMetadata(t, response).Cover != nil {
+		t.Error("Unexpected cover")
+	}
+}
+
+func TestEncryptNormalizeIdentifiers(t *testing.T) {
+	files := map[string]string{
+		"OEBPS/content.opf": test.OPF(`<dc:title>Identifiers</dc:title>
+			<dc:identifier>urn:isbn:0-306-40615-2</dc:identifier>
+			<dc:identifier>urn:isbn:9780306406158</dc:identifier>`, ``, `<spine/>`),
+	}
+	h := newTestCtrl(t, nil)
+	for _, normalize := range []bool{false, true} {
+		h.Config.Encrypt.NormalizeIdentifiers = normalize
+		response := httptest.NewRecorder()
+		h.EncryptEPUB(response, newEncryptRequest(t, files, nil))
+		if !checkResponseCode(t, http.StatusOK, response) {
+			continue
+		}
+		metadata := encryptMetadata(t, response)
+		if len(metadata.Identifiers) != 3 || metadata.Identifiers[1].Value != "urn:isbn:0-306-40615-2" {
+			t.Fatalf("Unexpected identifiers %+v", metadata.Identifiers)
+		}
+		normalized := ""
+		if normalize {
+			normalized = "9780306406157"
+		}
+		if metadata.Identifiers[1].Normalized != normalized || metadata.Identifiers[2].Normalized != "" {
+			t.Errorf("Normalization %t: unexpected identifiers %+v", normalize, metadata.Identifiers)
+		}
+		invalid := slices.ContainsFunc(metadata.Warnings, func(w string) bool { return strings.Contains(w, "9780306406158") })
+		if invalid != normalize {
+			t.Errorf("Normalization %t: unexpected warnings %q", normalize, metadata.Warnings)
+		}
+	}
+}
+
+func TestEncryptContentRating(t *testing.T) {
+	rated := func(rating string) map[string]string {
+		return map[string]string{
+			"OEBPS/content.opf": test.OPF(`<dc:title>Rated</dc:title>
+			<meta property="schema:contentRating">`+rating+`</meta>`, ``, `<spine/>`),
+		}
+	}
+	h := newTestCtrl(t, func(cf *conf.Config) {
+		cf.Encrypt.TenantContentRatings = map[string][]string{"kids": {"G", "pg"}}
+	})
+
+	cases := []struct {
+		account string
+		files   map[string]string
+		rating  string // form field
+		status  int
+		result  string // rating, or error
+	}{
+		{"alice", rated("PG-13"), "", http.StatusOK, "PG-13"}, // not restricted
+		{"alice", rated("PG-13"), "G", http.StatusOK, "G"},    // the form field prevails
+		{"kids", rated("PG-13"), "", http.StatusUnprocessableEntity, "not permitted"},
+		{"kids", rated("pg"), "", http.StatusOK, "pg"},
+		{"kids", rated("PG"), "pg", http.StatusOK, "pg"},
+		{"kids", nil, "", http.StatusOK, ""}, // unrated
+		{"kids", nil, "G", http.StatusOK, "G"},
+		{"kids", nil, "R", http.StatusUnprocessableEntity, "not permitted"},
+		// a restricted account cannot override the declared rating
+		{"kids", rated("R"), "G", http.StatusUnprocessableEntity, "does not match the declared rating"},
+		{"kids", rated("PG-13"), "PG", http.StatusUnprocessableEntity, "does not match the declared rating"},
+	}
+	for _, c := range cases {
+		req := newEncryptRequest(t, c.files, map[string]string{"content_rating": c.rating})
+		req.Header.Set("X-Username", c.account)
+		response := httptest.NewRecorder()
+		h.EncryptEPUB(response, req)
+		if !checkResponseCode(t, c.status, response) {
+			continue
+		}
+		if c.status != http.StatusOK {
+			if !strings.Contains(response.Body.String(), c.result) {
+				t.Errorf("%s %q: unexpected error %q", c.account, c.rating, response.Body.String())
+			}
+			continue
+		}
+		if rating := encryptMetadata(t, response).ContentRating; rating != c.result {
+			t.Errorf("%s %q: expected rating %q, got %q", c.account, c.rating, c.result, rating)
+		}
+	}
+}
+
+func TestEncryptTenantDefaults(t *testing.T) {
+	files := map[string]string{
+		"OEBPS/content.opf": test.OPF(`<dc:title>Branded</dc:title>`, ``, `<spine/>`),
+	}
+	h := newTestCtrl(t, func(cf *conf.Config) {
+		cf.Encrypt.TenantDefaults = map[string]conf.TenantDefaults{
+			"storefront": {Provider: "https://storefront.example.com", TitlePrefix: "[S] ", TitleSuffix: " (edition)"},
+		}
+	})
+
+	cases := []struct {
+		account  string
+		title    string // form field
+		result   string
+		provider string
+	}{
+		{"alice", "", "Branded", ""},
+		{"storefront", "", "[S] Branded (edition)", "https://storefront.example.com"},
+		{"storefront", "Other", "Other", "https://storefront.example.com"}, // the form field prevails
+	}
+	for _, c := range cases {
+		req := newEncryptRequest(t, files, map[string]string{"title": c.title})
+		req.Header.Set("X-Username", c.account)
+		response := httptest.NewRecorder()
+		h.EncryptEPUB(response, req)
+		if !checkResponseCode(t, http.StatusOK, response) {
+			continue
+		}
+		metadata := encryptMetadata(t, response)
+		if metadata.Title != c.result || metadata.Provider != c.provider {
+			t.Errorf("%s %q: expected %q %q, got %q %q", c.account, c.title, c.result, c.provider, metadata.Title, metadata.Provider)
+		}
+	}
+}
+
+func TestEncryptRequireContent(t *testing.T) {
+	// a valid zip, without content in the spine
+	empty := map[string]string{
+		"OEBPS/content.opf": test.OPF(`<dc:title>Empty</dc:title>`,
+			`<item id="ch1" href="chapter1.xhtml" media-type="application/xhtml+xml"/>`, `<spine/>`),
+		"OEBPS/chapter1.xhtml": `<html><body><p>Not in the spine</p></body></html>`,
+	}
+	h := newTestCtrl(t, nil)
+
+	// not required by default
+	response := httptest.NewRecorder()
+	h.EncryptEPUB(response, newEncryptRequest(t, empty, nil))
+	checkResponseCode(t, http.StatusOK, response)
+
+	h.Config.Encrypt.RequireContent = true
+	response = httptest.NewRecorder()
+	h.EncryptEPUB(response, newEncryptRequest(t, empty, nil))
+	if checkResponseCode(t, http.StatusUnprocessableEntity, response) && !strings.Contains(response.Body.String(), "the spine is empty") {
+		t.Errorf("Unexpected error %q", response.Body.String())
+	}
+
+	response = httptest.NewRecorder()
+	h.EncryptEPUB(response, newEncryptRequest(t, map[string]string{"OEBPS/chapter1.xhtml": `<html><body><p>Hello</p></body></html>`}, nil))
+	checkResponseCode(t, http.StatusOK, response)
+}
+
+func TestEncryptResponseFilter(t *testing.T) {
+	h := newTestCtrl(t, nil)
+	h.ResponseFilter = func(m *EncryptResponse) {
+		m.EncryptionKey = ""
+		m.Warnings = append(m.Warnings, "redacted")
+	}
+
+	response := httptest.NewRecorder()
+	h.EncryptEPUB(response, newEncryptRequest(t, nil, nil))
+	if !checkResponseCode(t, http.StatusOK, response) {
+		return
+	}
+	metadata := encryptMetadata(t, response)
+	if metadata.EncryptionKey != "" {
+		t.Errorf("Expected a redacted encryption key, got %q", metadata.EncryptionKey)
+	}
+	if len(metadata.Warnings) != 1 || metadata.Warnings[0] != "redacted" {
+		t.Errorf("Expected the filter to be applied, got %+v", metadata)
+	}
+}
+
+// disconnectingWriter simulates a client closing the connection after the first write.
+type disconnectingWriter struct {
+	*httptest.ResponseRecorder
+	cancel context.CancelFunc
+	writes int
+}
+
+func (w *disconnectingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	if w.writes > 1 {
+		return 0, errors.New("broken pipe")
+	}
+	w.cancel()
+	return w.ResponseRecorder.Write(p)
+}
+
+func TestEncryptClientDisconnect(t *testing.T) {
+	// an incompressible chapter, streamed in several writes
+	noise := make([]byte, 256<<10)
+	rand.Read(noise)
+	files := map[string]string{"OEBPS/chapter1.xhtml": "<html><body><p>" + base64.StdEncoding.EncodeToString(noise) + "</p></body></html>"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req := newEncryptRequest(t, files, nil).WithContext(ctx)
+	w := &disconnectingWriter{ResponseRecorder: httptest.NewRecorder(), cancel: cancel}
+	before := expvarInt(metricEncryptOutcomes.Get(outcomeClientDisconnect))
+
+	h := newTestCtrl(t, nil)
+	h.EncryptEPUB(w, req)
+
+	if w.writes != 1 {
+		t.Errorf("Expected streaming to stop after the disconnection, got %d writes", w.writes)
+	}
+	if got := expvarInt(metricEncryptOutcomes.Get(outcomeClientDisconnect)); got != before+1 {
+		t.Errorf("Expected the disconnection to be counted, got %d then %d", before, got)
+	}
+
+	// a disconnection during the encryption cancels the post-encryption steps
+	defer func(orig func(string, string, string, pack.Options) (*encrypt.Publication, []pack.Resource, []string, error)) {
+		processEncryption = orig
+	}(processEncryption)
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	processEncryption = func(contentID, inputPath, outputDir string, opts pack.Options) (*encrypt.Publication, []pack.Resource, []string, error) {
+		defer cancel()
+		return encryptFile(contentID, inputPath, outputDir, opts)
+	}
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	before = expvarInt(metricEncryptOutcomes.Get(outcomeClientDisconnect))
+	response := httptest.NewRecorder()
+	h.EncryptEPUB(response, newEncryptRequest(t, files, map[string]string{"self_test": "true"}).WithContext(ctx))
+	if response.Body.Len() != 0 || response.Header().Get("X-Encrypt-Metadata") != "" {
+		t.Error("Expected no response after the disconnection")
+	}
+	if got := expvarInt(metricEncryptOutcomes.Get(outcomeClientDisconnect)); got != before+1 {
+		t.Errorf("Expected the disconnection to be counted, got %d then %d", before, got)
+	}
+	if !strings.Contains(logs.String(), "client disconnected before the packaging") {
+		t.Errorf("Expected the steps after the encryption to be cancelled, got %s", logs.String())
+	}
+}
+
+func expvarInt(v expvar.Var) int64 {
+	if i, ok := v.(*expvar.Int); ok {
+		return i.Value()
+	}
+	return 0
+}
+
+func TestEncryptResourceDigestsEPUB(t *testing.T) {
+	// digests are embedded in Readium Packages only
+	response := encryptPublication(t, nil, map[string]string{"resource_digests": "true"})
+	if checkResponseCode(t, http.StatusOK, response) {
+		if metadata := encryptMetadata(t, response); len(metadata.Warnings) != 1 {
+			t.Errorf("Expected a warning, got %+v", metadata.Warnings)
+		}
+	}
+}
+
+// newBundleRequest returns a bundle encryption request for an EPUB made of the given files,
+// and for supplementary files keyed by name.
+func newBundleRequest(t *testing.T, files map[string]string, supplements map[string]string) *http.Request {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", "test.epub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(test.BuildEPUB(files))
+	for name, content := range supplements {
+		fw, err := mw.CreateFormFile("supplements", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(content))
+	}
+	mw.Close()
+
+	req, _ := http.NewRequest("POST", "/encrypt-bundle", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestEncryptBundle(t *testing.T) {
+	response := executeRequest(newBundleRequest(t, nil, map[string]string{
+		"worksheet.pdf": "%PDF-1.4",
+		"track.mp3":     "ID3",
+	}))
+	if !checkResponseCode(t, http.StatusOK, response) {
+		return
+	}
+	metadata := encryptMetadata(t, response)
+	if metadata.Title != "Test Book" || metadata.ContentType != "application/epub+zip" {
+		t.Errorf("Unexpected metadata %+v", metadata)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(response.Body.Bytes()), int64(response.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ep, err := epub.Read(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"OEBPS/supplements/worksheet.pdf", "OEBPS/supplements/track.mp3"} {
+		if _, encrypted := ep.Encryption.DataForFile(name); !encrypted {
+			t.Errorf("Expected %s to be encrypted", name)
+		}
+	}
+
+	// supplements are required
+	response = executeRequest(newBundleRequest(t, nil, nil))
+	checkResponseCode(t, http.StatusBadRequest, response)
+}
+
+func TestEncryptEntryTimestamps(t *testing.T) {
+	dated := map[string]string{
+		"OEBPS/content.opf": test.OPF(`<dc:title>Dated</dc:title><dc:date>2019-06-21</dc:date>`,
+			`<item id="ch1" href="chapter1.xhtml" media-type="application/xhtml+xml"/>`,
+			`<spine><itemref idref="ch1"/></spine>`),
+		"OEBPS/chapter1.xhtml": `<html><body><p>Chapter</p></body></html>`,
+	}
+	cases := []struct {
+		config   string
+		expected time.Time
+	}{
+		{"publication_date", time.Date(2019, 6, 21, 0, 0, 0, 0, time.UTC)},
+		{"2020-01-01T12:00:00Z", time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		h := newTestCtrl(t, func(cf *conf.Config) {
+			cf.Encrypt.EntryTimestamp = c.config
+		})
+
+		response := httptest.NewRecorder()
+		h.EncryptEPUB(response, newEncryptRequest(t, dated, nil))
+		if !checkResponseCode(t, http.StatusOK, response) {
+			continue
+		}
+		if int(encryptMetadata(t, response).Size) != response.Body.Len() {
+			t.Error("Expected the size of the rewritten file")
+		}
+		zr, err := zip.NewReader(bytes.NewReader(response.Body.Bytes()), int64(response.Body.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range zr.File {
+			if !f.Modified.Equal(c.expected) {
+				t.Errorf("%s: expected %s to be modified at %v, got %v", c.config, f.Name, c.expected, f.Modified)
+			}
+		}
+	}
+}
+
+func TestEncryptProtectionLevel(t *testing.T) {
+	// a nav document and a chapter
+	files := map[string]string{
+		"OEBPS/nav.xhtml":      `<html><body><nav><a href="chapter1.xhtml">Chapter</a></nav></body></html>`,
+		"OEBPS/chapter1.xhtml": `<html><body><p>Hello</p></body></html>`,
+	}
+	response := encryptPublication(t, files, map[string]string{"clear_policy": "required"})
+	if checkResponseCode(t, http.StatusOK, response) {
+		if level := encryptMetadata(t, response).ProtectionLevel; level != pack.ProtectionFull {
+			t.Errorf("Expected a full protection, got %q", level)
+		}
+	}
+	response = encryptPublication(t, files, nil)
+	if checkResponseCode(t, http.StatusOK, response) {
+		if level := encryptMetadata(t, response).ProtectionLevel; level != pack.ProtectionPartial {
+			t.Errorf("Expected a partial protection, got %q", level)
+		}
+	}
+
+	// configured thresholds
+	h := newTestCtrl(t, func(cf *conf.Config) {
+		cf.Encrypt.SampleProtectionRatio = 0.5
+	})
+	response = httptest.NewRecorder()
+	h.EncryptEPUB(response, newEncryptRequest(t, files, nil))
+	if checkResponseCode(t, http.StatusOK, response) {
+		if level := encryptMetadata(t, response).ProtectionLevel; level != pack.ProtectionSample {
+			t.Errorf("Expected a sample, got %q", level)
+		}
+	}
+}
+
+// newBase64Request returns a base64 encryption request for the given payload.
+func newBase64Request(payload any, query string) *http.Request {
+	data, _ := json.Marshal(payload)
+	req, _ := http.NewRequest("POST", "/encrypt-base64"+query, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func TestEncryptBase64(t *testing.T) {
+	data := base64.StdEncoding.EncodeToString(test.BuildEPUB(map[string]string{
+		"OEBPS/chapter1.xhtml": `<html><body><p>Hello</p></body></html>`,
+	}))
+	response := executeRequest(newBase64Request(EncryptBase64Request{Filename: "test.epub", DataBase64: data, Title: "Base64"}, "?include_metrics=true"))
+	if checkResponseCode(t, http.StatusOK, response) {
+		metadata := encryptMetadata(t, response)
+		if metadata.Title != "Base64" || int(metadata.Size) != response.Body.Len() {
+			t.Errorf("Unexpected metadata %+v", metadata)
+		}
+		if metadata.Metrics == nil {
+			t.Error("Expected the query parameters to be applied")
+		}
+	}
+
+	cases := []struct {
+		name    string
+		payload any
+		status  int
+	}{
+		{"malformed json", "not an object", http.StatusBadRequest},
+		{"missing data", EncryptBase64Request{Filename: "test.epub"}, http.StatusBadRequest},
+		{"malformed base64", EncryptBase64Request{Filename: "test.epub", DataBase64: "not base64!"}, http.StatusBadRequest},
+		{"missing file name", EncryptBase64Request{DataBase64: data}, http.StatusBadRequest},
+		{"file name with a path", EncryptBase64Request{Filename: "../test.epub", DataBase64: data}, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		if response := executeRequest(newBase64Request(c.payload, "")); response.Code != c.status {
+			t.Errorf("%s: expected status %d, got %d", c.name, c.status, response.Code)
+		}
+	}
+}
+
+func TestEncryptManifestHash(t *testing.T) {
+	var audiobook bytes.Buffer
+	zw := zip.NewWriter(&audiobook)
+	for name, content := range map[string]string{
+		"manifest.json": `{"@context":"https://readium.org/webpub-manifest/context.jsonld","metadata":{"title":"Hash","conformsTo":"https://readium.org/webpub-manifest/profiles/audiobook"},"readingOrder":[{"href":"track1.mp3","type":"audio/mpeg","duration":10}]}`,
+		"track1.mp3":    "first track",
+	} {
+		w, _ := zw.Create(name)
+		w.Write([]byte(content))
+	}
+	zw.Close()
+	payload := EncryptBase64Request{Filename: "test.audiobook", DataBase64: base64.StdEncoding.EncodeToString(audiobook.Bytes())}
+
+	// the same input gives the same hash, whatever the content key
+	var hashes []string
+	for range 2 {
+		response := executeRequest(newBase64Request(payload, ""))
+		if !checkResponseCode(t, http.StatusOK, response) {
+			return
+		}
+		hash := encryptMetadata(t, response).ManifestHash
+		zr, err := zip.NewReader(bytes.NewReader(response.Body.Bytes()), int64(response.Body.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := zr.Open("manifest.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		manifest, _ := io.ReadAll(f)
+		f.Close()
+		if sum := sha256.Sum256(manifest); hash != "sha256:"+hex.EncodeToString(sum[:]) {
+			t.Errorf("The hash %q is not the digest of the manifest", hash)
+		}
+		hashes = append(hashes, hash)
+	}
+	if hashes[0] != hashes[1] {
+		t.Errorf("Expected stable hashes, got %q", hashes)
+	}
+
+	// EPUBs have no manifest
+	response := encryptPublication(t, nil, nil)
+	if checkResponseCode(t, http.StatusOK, response) && encryptMetadata(t, response).ManifestHash != "" {
+		t.Error("Unexpected manifest hash")
+	}
+}
+
+func TestEncryptLogRedaction(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	h := newTestCtrl(t, func(cf *conf.Config) {
+		cf.LogRedact = []string{conf.RedactTitle, conf.RedactFilename}
+	})
+	response := httptest.NewRecorder()
+	h.EncryptEPUB(response, newEncryptRequest(t, nil, map[string]string{"title": "Private Title"}))
+	checkResponseCode(t, http.StatusOK, response)
+	payload, _ := json.Marshal(EncryptBase64Request{Filename: "../private-name.epub", DataBase64: "AAAA"})
+	req, _ := http.NewRequest("POST", "/encrypt-base64", bytes.NewReader(payload))
+	response = httptest.NewRecorder()
+	h.EncryptBase64(response, req)
+	checkResponseCode(t, http.StatusBadRequest, response)
+
+	if strings.Contains(logs.String(), "Private Title") || strings.Contains(logs.String(), "private-name") {
+		t.Errorf("Unredacted logs: %s", logs.String())
+	}
+	if !strings.Contains(logs.String(), "title=[redacted:") {
+		t.Errorf("Expected a redacted title: %s", logs.String())
+	}
+
+	// the file name of the upload is only redacted from the errors
+	var processed string
+	h.PostProcessors["fail"] = func(ctx context.Context, path string) error {
+		processed = filepath.Base(path)
+		return fmt.Errorf("unable to process %s", path)
+	}
+	h.Config.Encrypt.PostProcessing = map[string][]string{"epub": {"fail"}}
+	logs.Reset()
+	response = httptest.NewRecorder()
+	h.EncryptBase64(response, newBase64Request(EncryptBase64Request{Filename: "private-name.epub", DataBase64: base64.StdEncoding.EncodeToString(test.BuildEPUB(nil))}, ""))
+	checkResponseCode(t, http.StatusInternalServerError, response)
+	if processed != "private-name.epub" {
+		t.Errorf("Expected the upload to keep its name, got %q", processed)
+	}
+	if strings.Contains(logs.String(), "private-name") || !strings.Contains(logs.String(), "unable to process") {
+		t.Errorf("Unredacted logs: %s", logs.String())
+	}
+
+	// not redacted by default
+	logs.Reset()
+	encryptPublication(t, nil, map[string]string{"title": "Public Title"})
+	if !strings.Contains(logs.String(), "title=Public Title") {
+		t.Errorf("Expected the title in the logs: %s", logs.String())
+	}
+}
+
+func TestEncryptSourceChecksum(t *testing.T) {
+	source := test.BuildEPUB(nil)
+	response := executeRequest(newBase64Request(EncryptBase64Request{Filename: "test.epub", DataBase64: base64.StdEncoding.EncodeToString(source)}, ""))
+	if !checkResponseCode(t, http.StatusOK, response) {
+		return
+	}
+	metadata := encryptMetadata(t, response)
+	sourceSum, outputSum := sha256.Sum256(source), sha256.Sum256(response.Body.Bytes())
+	if metadata.SourceChecksum != base64.StdEncoding.EncodeToString(sourceSum[:]) {
+		t.Errorf("Unexpected source checksum %q", metadata.SourceChecksum)
+	}
+	if metadata.Checksum != base64.StdEncoding.EncodeToString(outputSum[:]) || metadata.ChecksumOf != "encrypted" {
+		t.Errorf("Unexpected checksum %q of %q", metadata.Checksum, metadata.ChecksumOf)
+	}
+
+	// the checksum of the source as the default checksum
+	h := newTestCtrl(t, func(cf *conf.Config) {
+		cf.Encrypt.ChecksumOf = "source"
+	})
+	response = httptest.NewRecorder()
+	h.EncryptBase64(response, newBase64Request(EncryptBase64Request{Filename: "test.epub", DataBase64: base64.StdEncoding.EncodeToString(source)}, ""))
+	if checkResponseCode(t, http.StatusOK, response) {
+		metadata := encryptMetadata(t, response)
+		if metadata.Checksum != metadata.SourceChecksum || metadata.SourceChecksum != base64.StdEncoding.EncodeToString(sourceSum[:]) || metadata.ChecksumOf != "source" {
+			t.Errorf("Unexpected checksums %+v", metadata)
+		}
+	}
+}
+
+func TestEncryptBase64TooLarge(t *testing.T) {
+	h := newTestCtrl(t, func(cf *conf.Config) {
+		cf.Encrypt.MaxBase64BodyBytes = 1024
+	})
+	payload := EncryptBase64Request{Filename: "test.epub", DataBase64: base64.StdEncoding.EncodeToString(test.BuildEPUB(nil))}
+
+	response := httptest.NewRecorder()
+	h.EncryptBase64(response, newBase64Request(payload, ""))
+	checkResponseCode(t, http.StatusRequestEntityTooLarge, response)
+
+	// without a declared length
+	req := newBase64Request(payload, "")
+	req.ContentLength = -1
+	response = httptest.NewRecorder()
+	h.EncryptBase64(response, req)
+	checkResponseCode(t, http.StatusRequestEntityTooLarge, response)
+}
+
+// A base64 payload reserves twice its size under the cap on in-memory uploads.
+func TestEncryptBase64MemoryCap(t *testing.T) {
+	payload := EncryptBase64Request{Filename: "test.epub", DataBase64: base64.StdEncoding.EncodeToString(test.BuildEPUB(nil))}
+	size := newBase64Request(payload, "").ContentLength
+	for limit, status := range map[int64]int{size + size/2: http.StatusServiceUnavailable, 2 * size: http.StatusOK} {
+		h := newTestCtrl(t, func(cf *conf.Config) {
+			cf.Encrypt.MaxTotalInMemoryBytes = limit
+		})
+		response := httptest.NewRecorder()
+		h.EncryptBase64(response, newBase64Request(payload, ""))
+		checkResponseCode(t, status, response)
+	}
+}
+
+func TestEncryptValidator(t *testing.T) {
+	files := map[string]string{"OEBPS/chapter1.xhtml": `<html><body><p>Hello</p></body></html>`}
+	h := newTestCtrl(t, nil)
+	encryptWith := func() *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		h.EncryptEPUB(response, newEncryptRequest(t, files, nil))
+		return response
+	}
+
+	// the command gets the path of the upload, and no secret from the environment
+	t.Setenv("LCPSERVER_JWT_SECRETKEY", "secret")
+	h.Config.Encrypt.ValidatorCommand = []string{"sh", "-c", `test -f "$0" && test -z "$LCPSERVER_JWT_SECRETKEY"`}
+	checkResponseCode(t, http.StatusOK, encryptWith())
+
+	h.Config.Encrypt.ValidatorCommand = []string{"sh", "-c", `echo "ERROR(RSC-005): $(basename "$0")"; exit 1`}
+	response := encryptWith()
+	if checkResponseCode(t, http.StatusUnprocessableEntity, response) && !strings.Contains(response.Body.String(), "ERROR(RSC-005): test.epub") {
+		t.Errorf("Expected the output of the validator, got %q", response.Body.String())
+	}
+
+	// the paths of the server are not returned
+	h.Config.Encrypt.ValidatorCommand = []string{"sh", "-c", `echo "ERROR(RSC-005): $0 in $PWD"; exit 1`}
+	response = encryptWith()
+	if checkResponseCode(t, http.StatusUnprocessableEntity, response) {
+		if body := response.Body.String(); !strings.Contains(body, "ERROR(RSC-005): test.epub in .") || strings.Contains(body, os.TempDir()) {
+			t.Errorf("Expected the output of the validator without the temp dir, got %q", body)
+		}
+	}
+
+	// the command is run by the sandbox, alone with a copy of the upload in its directory
+	h.Config.Encrypt.ValidatorSandbox = []string{"env", "SANDBOX_DIR={dir}"}
+	h.Config.Encrypt.ValidatorCommand = []string{"sh", "-c",
+		`test "$(dirname "$0")" = "$SANDBOX_DIR" && test "$PWD" = "$SANDBOX_DIR" && test "$(ls)" = test.epub && rm "$0"`}
+	checkResponseCode(t, http.StatusOK, encryptWith())
+	h.Config.Encrypt.ValidatorSandbox = nil
+
+	h.Config.Encrypt.ValidatorCommand = []string{"sh", "-c", "exec sleep 5"}
+	h.Config.Encrypt.ValidatorTimeoutMs = 100
+	start := time.Now()
+	checkResponseCode(t, http.StatusBadGateway, encryptWith())
+	if time.Since(start) > 3*time.Second {
+		t.Error("The validator was not stopped at the timeout")
+	}
+
+	// validator service
+	status := http.StatusOK
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		if _, err := zip.NewReader(bytes.NewReader(data), int64(len(data))); err != nil {
+			t.Errorf("Expected the upload, got %d bytes", len(data))
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, "checked "+r.Header.Get("X-Filename"))
+	}))
+	defer service.Close()
+	h.Config.Encrypt.ValidatorCommand = nil
+	h.Config.Encrypt.ValidatorURL = service.URL
+	checkResponseCode(t, http.StatusOK, encryptWith())
+
+	status = http.StatusBadRequest
+	response = encryptWith()
+	if checkResponseCode(t, http.StatusUnprocessableEntity, response) && !strings.Contains(response.Body.String(), "checked test.epub") {
+		t.Errorf("Expected the output of the validator, got %q", response.Body.String())
+	}
+
+	status = http.StatusInternalServerError
+	checkResponseCode(t, http.StatusBadGateway, encryptWith())
+}
+
+func TestEncryptResourceMap(t *testing.T) {
+	files := map[string]string{
+		"OEBPS/content.opf": test.OPF(`<dc:title>Map</dc:title>`,
+			`<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+			<item id="ch1" href="text/chapter%201.xhtml" media-type="application/xhtml+xml"/>
+			<item id="font" href="https://fonts.example.com/font.woff2" media-type="font/woff2"/>`,
+			`<spine><itemref idref="ch1"/></spine>`),
+		"OEBPS/nav.xhtml":            `<html><body><nav><a href="text/chapter%201.xhtml">Chapter</a></nav></body></html>`,
+		"OEBPS/text/chapter 1.xhtml": `<html><body><p>Hello</p></body></html>`,
+	}
+	response := encryptPublication(t, files, map[string]string{"resource_map": "true"})
+	if !checkResponseCode(t, http.StatusOK, response) {
+		return
+	}
+	expected := []pack.ResourceLink{
+		{Href: "nav.xhtml", Path: "OEBPS/nav.xhtml", MediaType: "application/xhtml+xml"},
+		{Href: "text/chapter%201.xhtml", Path: "OEBPS/text/chapter 1.xhtml", MediaType: "application/xhtml+xml", Encrypted: true},
+	}
+	if got := encryptMetadata(t, response).ResourceMap; !slices.Equal(got, expected) {
+		t.Errorf("Expected the resource map %+v, got %+v", expected, got)
+	}
+
+	// no map by default
+	response = encryptPublication(t, files, nil)
+	if checkResponseCode(t, http.StatusOK, response) && encryptMetadata(t, response).ResourceMap != nil {
+		t.Error("Unexpected resource map")
+	}
+}
+
+// newEncodedRequest returns an encryption request for an EPUB sent as a part with the given transfer encoding.
+func newEncodedRequest(t *testing.T, encoding string, data []byte) *http.Request {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	pw, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Disposition":       {`form-data; name="file"; filename="test.epub"`},
+		"Content-Type":              {"application/epub+zip"},
+		"Content-Transfer-Encoding": {encoding},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pw.Write(data)
+	mw.Close()
+
+	req, _ := http.NewRequest("POST", "/encrypt", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestEncryptTransferEncoding(t *testing.T) {
+	epubData := test.BuildEPUB(map[string]string{"OEBPS/chapter1.xhtml": `<html><body><p>Hello</p></body></html>`})
+	// base64 in lines of 76 characters, as MIME encoders do
+	encoded := base64.StdEncoding.EncodeToString(epubData)
+	var lines strings.Builder
+	for len(encoded) > 76 {
+		lines.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	lines.WriteString(encoded)
+
+	response := executeRequest(newEncodedRequest(t, "base64", []byte(lines.String())))
+	if checkResponseCode(t, http.StatusOK, response) {
+		metadata := encryptMetadata(t, response)
+		if sum := sha256.Sum256(epubData); metadata.SourceChecksum != base64.StdEncoding.EncodeToString(sum[:]) {
+			t.Error("Expected the checksum of the decoded EPUB")
+		}
+	}
+
+	response = executeRequest(newEncodedRequest(t, "binary", epubData))
+	checkResponseCode(t, http.StatusOK, response)
+
+	response = executeRequest(newEncodedRequest(t, "base64", []byte("not base64!")))
+	if checkResponseCode(t, http.StatusBadRequest, response) && !strings.Contains(response.Body.String(), "malformed base64") {
+		t.Errorf("Unexpected error %q", response.Body.String())
+	}
+
+	response = executeRequest(newEncodedRequest(t, "x-uuencode", epubData))
+	if checkResponseCode(t, http.StatusBadRequest, response) && !strings.Contains(response.Body.String(), "unsupported transfer encoding") {
+		t.Errorf("Unexpected error %q", response.Body.String())
+	}
+}
+
+func TestEncryptPageList(t *testing.T) {
+	files := map[string]string{
+		"OEBPS/nav.xhtml": `<html><body><nav epub:type="toc"><ol><li><a href="chapter1.xhtml">Chapter</a></li></ol></nav>
+			<nav epub:type="page-list"><ol><li><a href="chapter1.xhtml#p1">1</a></li></ol></nav></body></html>`,
+		"OEBPS/chapter1.xhtml": `<html><body><p id="p1">Hello</p></body></html>`,
+	}
+	response := encryptPublication(t, files, map[string]string{"page_list": "true"})
+	if checkResponseCode(t, http.StatusOK, response) {
+		expected := []meta.PageTarget{{Label: "1", Href: "OEBPS/chapter1.xhtml#p1"}}
+		if got := encryptMetadata(t, response).PageList; got == nil || !slices.Equal(*got, expected) {
+			t.Errorf("Expected the page list %+v, got %+v", expected, got)
+		}
+	}
+
+	// the page list is empty when absent
+	response = encryptPublication(t, nil, map[string]string{"page_list": "true"})
+	if checkResponseCode(t, http.StatusOK, response) && !strings.Contains(response.Header().Get("X-Encrypt-Metadata"), `"page_list":[]`) {
+		t.Errorf("Expected an empty page list, got %s", response.Header().Get("X-Encrypt-Metadata"))
+	}
+
+	// no page list by default, the header stays small
+	response = encryptPublication(t, files, nil)
+	if checkResponseCode(t, http.StatusOK, response) && encryptMetadata(t, response).PageList != nil {
+		t.Error("Unexpected page list")
+	}
+}
+
+func TestEncryptSpineProperties(t *testing.T) {
+	files := map[string]string{
+		"OEBPS/content.opf": test.OPF(`<dc:title>Fixed layout</dc:title>
+			<meta property="rendition:layout">pre-paginated</meta>`,
+			`<item id="p1" href="page1.xhtml" media-type="application/xhtml+xml"/>`,
+			`<spine><itemref idref="p1" properties="page-spread-left"/></spine>`),
+		"OEBPS/page1.xhtml": `<html><body><p>Hello</p></body></html>`,
+	}
+	response := encryptPublication(t, files, map[string]string{"spine_properties": "true"})
+	if checkResponseCode(t, http.StatusOK, response) {
+		expected := []meta.SpineProperties{{Href: "OEBPS/page1.xhtml", Layout: "pre-paginated", Orientation: "auto", Spread: "auto", Flow: "auto", PageSpread: "left"}}
+		if got := encryptMetadata(t, response).SpineProperties; !slices.Equal(got, expected) {
+			t.Errorf("Expected the spine properties %+v, got %+v", expected, got)
+		}
+	}
+
+	// no spine properties by default, the header stays small
+	response = encryptPublication(t, files, nil)
+	if checkResponseCode(t, http.StatusOK, response) {
+		if metadata := encryptMetadata(t, response); metadata.SpineProperties != nil || !metadata.FixedLayout {
+			t.Errorf("Expected the layout without spine properties, got %+v", metadata)
+		}
+	}
+}
+
+func TestEncryptTranscripts(t *testing.T) {
+	audiobook := func(files map[string]string) EncryptBase64Request {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for name, content := range files {
+			w, _ := zw.Create(name)
+			w.Write([]byte(content))
+		}
+		zw.Close()
+		return EncryptBase64Request{Filename: "test.audiobook", DataBase64: base64.StdEncoding.EncodeToString(buf.Bytes())}
+	}
+	files := map[string]string{
+		"manifest.json": `{"metadata":{"title":"Transcripts","conformsTo":"https://readium.org/webpub-manifest/profiles/audiobook"},"readingOrder":[{"href":"track1.mp3","type":"audio/mpeg","duration":10}]}`,
+		"track1.mp3":    "first track",
+	}
+	response := executeRequest(newBase64Request(audiobook(files), ""))
+	if checkResponseCode(t, http.StatusOK, response) && encryptMetadata(t, response).HasTranscripts {
+		t.Error("Unexpected transcripts")
+	}
+
+	files["track1.vtt"] = "WEBVTT"
+	h := newTestCtrl(t, func(cf *conf.Config) {
+		cf.Encrypt.DeclareTranscripts = true
+	})
+	response = httptest.NewRecorder()
+	h.EncryptBase64(response, newBase64Request(audiobook(files), ""))
+	if !checkResponseCode(t, http.StatusOK, response) {
+		return
+	}
+	if !encryptMetadata(t, response).HasTranscripts {
+		t.Error("Expected transcripts")
+	}
+	zr, err := zip.NewReader(bytes.NewReader(response.Body.Bytes()), int64(response.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := zr.Open("manifest.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest struct {
+		Resources []struct {
+			Href string `json:"href"`
+			Type string `json:"type"`
+		} `json:"resources"`
+	}
+	err = json.NewDecoder(f).Decode(&manifest)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Resources) != 1 || manifest.Resources[0].Href != "track1.vtt" || manifest.Resources[0].Type != "text/vtt" {
+		t.Errorf("Expected the transcript to be declared, got %+v", manifest.Resources)
+	}
+}
+
+func TestEncryptPostProcessing(t *testing.T) {
+	files := map[string]string{"OEBPS/chapter1.xhtml": `<html><body><p>Hello</p></body></html>`}
+	h := newTestCtrl(t, nil)
+	var steps []string
+	h.PostProcessors["retitle"] = func(ctx context.Context, path string) error {
+		steps = append(steps, "retitle")
+		test.WriteEPUB(t, path, map[string]string{
+			"OEBPS/content.opf":    test.OPF(`<dc:title>Processed</dc:title>`, `<item id="ch1" href="chapter1.xhtml" media-type="application/xhtml+xml"/>`, `<spine><itemref idref="ch1"/></spine>`),
+			"OEBPS/chapter1.xhtml": files["OEBPS/chapter1.xhtml"],
+		})
+		return nil
+	}
+	h.PostProcessors["count"] = func(ctx context.Context, path string) error {
+		steps = append(steps, "count")
+		return nil
+	}
+	h.PostProcessors["fail"] = func(ctx context.Context, path string) error {
+		return errors.New("failed")
+	}
+	h.PostProcessors["truncate"] = func(ctx context.Context, path string) error {
+		return os.Truncate(path, 0)
+	}
+	encryptWith := func(pipeline map[string][]string) *httptest.ResponseRecorder {
+		steps = nil
+		h.Config.Encrypt.PostProcessing = pipeline
+		response := httptest.NewRecorder()
+		h.EncryptEPUB(response, newEncryptRequest(t, files, nil))
+		return response
+	}
+
+	// the steps of the format are applied in order, before the metadata pass
+	response := encryptWith(map[string][]string{"epub": {"count", "retitle", "count"}, "pdf": {"fail"}})
+	if checkResponseCode(t, http.StatusOK, response) {
+		if title := encryptMetadata(t, response).Title; title != "Processed" {
+			t.Errorf("Expected the title of the processed EPUB, got %q", title)
+		}
+		if !slices.Equal(steps, []string{"count", "retitle", "count"}) {
+			t.Errorf("Expected the steps in order, got %v", steps)
+		}
+	}
+
+	// the steps of other formats are not applied
+	checkResponseCode(t, http.StatusOK, encryptWith(map[string][]string{"pdf": {"fail"}}))
+	if len(steps) != 0 {
+		t.Errorf("Expected no step, got %v", steps)
+	}
+
+	checkResponseCode(t, http.StatusInternalServerError, encryptWith(map[string][]string{"epub": {"fail", "count"}}))
+	if len(steps) != 0 {
+		t.Errorf("Expected no step after the failure, got %v", steps)
+	}
+	checkResponseCode(t, http.StatusInternalServerError, encryptWith(map[string][]string{"epub": {"truncate"}}))
+
+	// unknown steps are reported at startup
+	h.Config.Encrypt.PostProcessing = map[string][]string{"epub": {"count", "linearize"}}
+	if err := h.CheckPostProcessing(); err == nil || !strings.Contains(err.Error(), "linearize") {
+		t.Errorf("Expected an unknown step error, got %v", err)
+	}
+	h.Config.Encrypt.PostProcessing = map[string][]string{"epub": {"count", "none"}}
+	if err := h.CheckPostProcessing(); err != nil {
+		t.Errorf("Expected registered steps, got %v", err)
+	}
+}
+
+// an Arabic EPUB, read right to left
+var rtlPublication = map[string]string{
+	"OEBPS/content.opf": test.OPF(`<dc:title>كتاب</dc:title><dc:language>ar</dc:language>`,
+		`<item id="ch1" href="chapter1.xhtml" media-type="application/xhtml+xml"/>`,
+		`<spine page-progression-direction="rtl"><itemref idref="ch1"/></spine>`),
+	"OEBPS/chapter1.xhtml": `<html xml:lang="ar" dir="rtl"><body><p>مرحبا</p></body></html>`,
+}
+
+func TestEncryptPageProgressionDirection(t *testing.T) {
+	response := encryptPublication(t, rtlPublication, nil)
+	if checkResponseCode(t, http.StatusOK, response) {
+		if dir := encryptMetadata(t, response).PageProgressionDirection; dir != "rtl" {
+			t.Errorf("Expected rtl, got %q", dir)
+		}
+	}
+
+	response = encryptPublication(t, nil, nil)
+	if checkResponseCode(t, http.StatusOK, response) {
+		if dir := encryptMetadata(t, response).PageProgressionDirection; dir != "ltr" {
+			t.Errorf("Expected ltr by default, got %q", dir)
+		}
+	}
+}
+
+func TestEncryptDates(t *testing.T) {
+	response := encryptPublication(t, map[string]string{
+		"OEBPS/content.opf": test.OPF(`<dc:title>Dated</dc:title><dc:date>2019-06-21</dc:date>
+			<meta property="dcterms:modified">2021-03-04T05:06:07Z</meta>`,
+			`<item id="ch1" href="chapter1.xhtml" media-type="application/xhtml+xml"/>`,
+			`<spine><itemref idref="ch1"/></spine>`),
+		"OEBPS/chapter1.xhtml": `<html><body><p>Hello</p></body></html>`,
+	}, nil)
+	if checkResponseCode(t, http.StatusOK, response) {
+		header := response.Header().Get("X-Encrypt-Metadata")
+		if !strings.Contains(header, `"modified":"2021-03-04T05:06:07Z"`) || !strings.Contains(header, `"created":"2019-06-21T00:00:00Z"`) {
+			t.Errorf("Expected the RFC 3339 dates, got %s", header)
+		}
+	}
+
+	response = encryptPublication(t, nil, nil)
+	if checkResponseCode(t, http.StatusOK, response) {
+		if metadata := encryptMetadata(t, response); metadata.Modified != nil || metadata.Created != nil {
+			t.Errorf("Expected no dates, got %v and %v", metadata.Modified, metadata.Created)
+		}
+	}
+}
+
+func TestEncryptResourceCounts(t *testing.T) {
+	response := encryptPublication(t, map[string]string{
+		"OEBPS/content.opf": test.OPF(`<dc:title>Media</dc:title>`,
+			`<item id="ch1" href="chapter1.xhtml" media-type="application/xhtml+xml"/>
+			<item id="clip" href="clip.mp3" media-type="audio/mpeg"/>
+			<item id="video" href="intro.mp4" media-type="video/mp4"/>`,
+			`<spine><itemref idref="ch1"/></spine>`),
+		"OEBPS/chapter1.xhtml": `<html><body><audio src="clip.mp3"/><video src="intro.mp4"/></body></html>`,
+		"OEBPS/clip.mp3":       "ID3",
+		"OEBPS/intro.mp4":      "ftyp",
+	}, nil)
+	if checkResponseCode(t, http.StatusOK, response) {
+		counts := encryptMetadata(t, response).ResourceCounts
+		if counts["documents"] != 1 || counts["audio"] != 1 || counts["video"] != 1 || counts["images"] != 0 {
+			t.Errorf("Unexpected resource counts %v", counts)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestListErrorCodes(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/error-codes", nil)
+	response := executeRequest(req)
+	if !checkResponseCode(t, http.StatusOK, response) {
+		return
+	}
+	if response.Header().Get("Cache-Control") == "" {
+		t.Error("Expected a cacheable response")
+	}
+	var codes []ErrorCode
+	if err := json.Unmarshal(response.Body.Bytes(), &codes); err != nil {
+		t.Fatal(err)
+	}
+	listed := make(map[string]ErrorCode)
+	for _, ec := range codes {
+		if _, ok := listed[ec.Code]; ok {
+			t.Errorf("Duplicate error code %s", ec.Code)
+		}
+		listed[ec.Code] = ec
+	}
+
+	// every error returned by the API is listed
+	err := errors.New("test")
+	for _, e := range []*ErrResponse{
+		ErrInvalidRequest(err).(*ErrResponse), ErrRender(err).(*ErrResponse), ErrServer(err).(*ErrResponse),
+		ErrUnavailable(err).(*ErrResponse), ErrConflict(err).(*ErrResponse), ErrNotFound,
+		ErrRegister(err).(*ErrResponse), ErrRenew(err).(*ErrResponse), ErrReturn(err).(*ErrResponse), ErrRevoke(err).(*ErrResponse),
+		ErrPayloadTooLarge(err).(*ErrResponse), ErrForbidden(err).(*ErrResponse), ErrBusy(err).(*ErrResponse),
+		ErrInvalidPublication(err).(*ErrResponse), ErrValidation(err).(*ErrResponse), ErrValidatorUnavailable(err).(*ErrResponse),
+		ErrKeyMismatch(err).(*ErrResponse), ErrSelfTest(err).(*ErrResponse), ErrAuditUnavailable(err).(*ErrResponse),
+		ErrUnauthorized(err).(*ErrResponse), ErrTokenExpired(err).(*ErrResponse),
+	} {
+		ec, ok := listed[e.Code]
+		if !ok || ec.Status != e.HTTPStatusCode || ec.Type != e.Type || ec.Title != e.Title {
+			t.Errorf("Error %+v not listed as such", e)
+		}
+	}
+}
+
+// The error codes of the source code are all listed, and errors are not returned outside of the table.
+func TestErrorCodesInSource(t *testing.T) {
+	listed := make(map[string]bool)
+	for _, ec := range errorCodes {
+		listed[ec.Code] = true
+	}
+	fset := token.NewFileSet()
+	for _, pattern := range []string{"*.go", "../../cmd/lcpserver/*.go"} {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, path := range paths {
+			if strings.HasSuffix(path, "_test.go") {
+				continue
+			}
+			f, err := parser.ParseFile(fset, path, nil, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ast.Inspect(f, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.ValueSpec:
+					// the Code constants
+					for i, name := range n.Names {
+						if strings.HasPrefix(name.Name, "Code") && i < len(n.Values) {
+							if lit, ok := n.Values[i].(*ast.BasicLit); ok && !listed[strings.Trim(lit.Value, `"`)] {
+								t.Errorf("%s: error code %s is not listed", fset.Position(n.Pos()), lit.Value)
+							}
+						}
+					}
+				case *ast.CallExpr:
+					if sel, ok := n.Fun.(*ast.SelectorExpr); ok && sel.Sel.Name == "Error" {
+						if pkg, ok := sel.X.(*ast.Ident); ok && pkg.Name == "http" {
+							t.Errorf("%s: error returned without code", fset.Position(n.Pos()))
+						}
+					}
+				case *ast.KeyValueExpr:
+					if lit, ok := n.Key.(*ast.BasicLit); ok && (lit.Value == `"code"` || lit.Value == `"error"`) {
+						t.Errorf("%s: error code outside of the table", fset.Position(n.Pos()))
+					}
+				}
+				return true
+			})
+		}
+	}
+}
+
+func TestErrorCodeInResponse(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/publications/"+uuid.New().String(), nil)
+	response := executeRequest(req)
+	if checkResponseCode(t, http.StatusNotFound, response) {
+		var e ErrResponse
+		if err := json.Unmarshal(response.Body.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Code != CodeNotFound {
+			t.Errorf("Expected code %s, got %q", CodeNotFound, e.Code)
+		}
+	}
+}
+
+func TestEncryptErrorCodes(t *testing.T) {
+	h := newTestCtrl(t, nil)
+	checkCode := func(response *httptest.ResponseRecorder, status int, code string) {
+		t.Helper()
+		if !checkResponseCode(t, status, response) {
+			return
+		}
+		var e ErrResponse
+		if err := json.Unmarshal(response.Body.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Code != code {
+			t.Errorf("Expected code %s, got %q", code, e.Code)
+		}
+	}
+
+	req, _ := http.NewRequest("POST", "/encrypt-base64", strings.NewReader("{"))
+	response := httptest.NewRecorder()
+	h.EncryptBase64(response, req)
+	checkCode(response, http.StatusBadRequest, CodeInvalidRequest)
+
+	h.Config.Encrypt.ValidatorCommand = []string{"sh", "-c", "echo rejected; exit 1"}
+	response = httptest.NewRecorder()
+	h.EncryptEPUB(response, newEncryptRequest(t, nil, nil))
+	checkCode(response, http.StatusUnprocessableEntity, CodeValidation)
+
+	h.Config.Encrypt.ValidatorCommand = []string{"/nonexistent/validator"}
+	response = httptest.NewRecorder()
+	h.EncryptEPUB(response, newEncryptRequest(t, nil, nil))
+	checkCode(response, http.StatusBadGateway, CodeValidatorUnavailable)
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/edrlab/lcp-server/pkg/conf"
+)
+
+func TestUUIDLock(t *testing.T) {
+
+	l := newUUIDLocks()
+	ctx := context.Background()
+
+	unlock, err := l.lock(ctx, "123", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// another UUID is not blocked
+	unlockOther, err := l.lock(ctx, "456", 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlockOther()
+
+	if _, err := l.lock(ctx, "123", 10*time.Millisecond); err == nil {
+		t.Error("Expected a timeout on a locked UUID")
+	}
+	unlock()
+
+	unlock, err = l.lock(ctx, "123", 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+
+	if len(l.locks) != 0 {
+		t.Errorf("Expected released locks to be removed, got %d", len(l.locks))
+	}
+}
+
+func TestPublicationLockConflict(t *testing.T) {
+
+	inPub, _ := createPublication(t)
+
+	// a dedicated controller with a short timeout
+	h := newTestCtrl(t, func(cf *conf.Config) {
+		cf.LockTimeoutMs = 10
+	})
+
+	unlock, err := h.locks.lock(context.Background(), inPub.UUID, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := json.Marshal(inPub)
+	req, _ := http.NewRequest("PUT", "/publications/"+inPub.UUID, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("publicationID", inPub.UUID)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	response := httptest.NewRecorder()
+	h.UpdatePublication(response, req)
+	unlock()
+
+	checkResponseCode(t, http.StatusConflict, response)
+
+	deletePublication(t, inPub.UUID)
+}
+
+func TestConcurrentPublicationUpdates(t *testing.T) {
+
+	inPub, _ := createPublication(t)
+
+	const count = 20
+	titles := make(map[string]bool)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		pub := *inPub
+		pub.Title = fmt.Sprintf("Concurrent title %d", i)
+		titles[pub.Title] = true
+		data, err := json.Marshal(&pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest("PUT", "/publications/"+inPub.UUID, bytes.NewReader(data))
+			checkResponseCode(t, http.StatusOK, executeRequest(req))
+		}()
+	}
+	wg.Wait()
+
+	req, _ := http.NewRequest("GET", "/publications/"+inPub.UUID, nil)
+	response := executeRequest(req)
+	if checkResponseCode(t, http.StatusOK, response) {
+		var outPub PublicationTest
+		if err := json.Unmarshal(response.Body.Bytes(), &outPub); err != nil {
+			t.Fatal(err)
+		}
+		if !titles[outPub.Title] {
+			t.Errorf("Unexpected title %q", outPub.Title)
+		}
+		outPub.Title = inPub.Title
+		if !comparePublications(inPub, &outPub) {
+			t.Error("Concurrent updates corrupted the publication")
+		}
+	}
+
+	deletePublication(t, inPub.UUID)
+}
@@ -4,9 +4,15 @@ import (
 	"bytes"
 	"encoding/json"
 	"net/http"
+	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 
+	log "github.com/sirupsen/logrus"
+
+	"github.com/edrlab/lcp-server/pkg/conf"
+	"github.com/edrlab/lcp-server/pkg/test"
 	"github.com/google/uuid"
 )
 
@@ -286,3 +292,116 @@ func TestGetDeletedPublication(t *testing.T) {
 
 	checkResponseCode(t, http.StatusNotFound, response)
 }
+
+func TestRefreshPublicationMetadata(t *testing.T) {
+
+	// serve a stored publication
+	opf := test.OPF(`<dc:title>Refreshed Title</dc:title>
+		<dc:creator>Jules Verne</dc:creator>
+		<dc:creator>Édouard Riou</dc:creator>
+		<dc:publisher>Hetzel</dc:publisher>
+		<dc:description>A journey.</dc:description>`,
+		`<item id="ch1" href="chapter1.xhtml" media-type="application/xhtml+xml"/>`,
+		`<spine><itemref idref="ch1"/></spine>`)
+	epub := test.BuildEPUB(map[string]string{"OEBPS/content.opf": opf})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/pub.epub":
+			w.Write(epub)
+		case "/invalid.epub":
+			w.Write([]byte("not a zip"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	// create the publication
+	inPub := newPublication()
+	inPub.Href = srv.URL + "/pub.epub"
+	data, _ := json.Marshal(inPub)
+	req, _ := http.NewRequest("POST", "/publications/", bytes.NewReader(data))
+	checkResponseCode(t, http.StatusCreated, executeRequest(req))
+	defer deletePublication(t, inPub.UUID)
+
+	// refresh its metadata
+	req, _ = http.NewRequest("POST", "/publications/"+inPub.UUID+"/refresh-metadata", nil)
+	response := executeRequest(req)
+	if checkResponseCode(t, http.StatusOK, response) {
+		var outPub struct {
+			PublicationTest
+			Authors     string `json:"authors"`
+			Publishers  string `json:"publishers"`
+			Description string `json:"description"`
+		}
+		if err := json.Unmarshal(response.Body.Bytes(), &outPub); err != nil {
+			t.Fatal(err)
+		}
+		if outPub.Title != "Refreshed Title" || outPub.Authors != "Jules Verne, Édouard Riou" ||
+			outPub.Publishers != "Hetzel" || outPub.Description != "A journey." {
+			t.Errorf("Metadata not refreshed: %+v", outPub)
+		}
+		// the encryption data must not be modified
+		inPub.Title = outPub.Title
+		if !comparePublications(inPub, &outPub.PublicationTest) {
+			t.Error("Failed to get the same content back")
+		}
+	}
+
+	// the stored file is unavailable
+	inPub2 := newPublication()
+	inPub2.Href = srv.URL + "/missing.epub"
+	data, _ = json.Marshal(inPub2)
+	req, _ = http.NewRequest("POST", "/publications/", bytes.NewReader(data))
+	checkResponseCode(t, http.StatusCreated, executeRequest(req))
+	defer deletePublication(t, inPub2.UUID)
+
+	req, _ = http.NewRequest("POST", "/publications/"+inPub2.UUID+"/refresh-metadata", nil)
+	checkResponseCode(t, http.StatusBadGateway, executeRequest(req))
+
+	// the stored file exceeds the size limit
+	s.Config.MaxFetchBytes = int64(len(epub) - 1)
+	req, _ = http.NewRequest("POST", "/publications/"+inPub.UUID+"/refresh-metadata", nil)
+	checkResponseCode(t, http.StatusBadGateway, executeRequest(req))
+	s.Config.MaxFetchBytes = 0
+
+	// the stored file is not an EPUB
+	inPub3 := newPublication()
+	inPub3.Href = srv.URL + "/invalid.epub"
+	data, _ = json.Marshal(inPub3)
+	req, _ = http.NewRequest("POST", "/publications/", bytes.NewReader(data))
+	checkResponseCode(t, http.StatusCreated, executeRequest(req))
+	defer deletePublication(t, inPub3.UUID)
+
+	req, _ = http.NewRequest("POST", "/publications/"+inPub3.UUID+"/refresh-metadata", nil)
+	response = executeRequest(req)
+	if checkResponseCode(t, http.StatusBadGateway, response) && !strings.Contains(response.Body.String(), CodeUnavailable) {
+		t.Errorf("Expected the %s code, got %s", CodeUnavailable, response.Body.String())
+	}
+
+	// unknown publication
+	req, _ = http.NewRequest("POST", "/publications/"+uuid.New().String()+"/refresh-metadata", nil)
+	checkResponseCode(t, http.StatusNotFound, executeRequest(req))
+}
+
+func TestRefreshLogRedaction(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	s.Config.LogRedact = []string{conf.RedactIdentifiers}
+	defer func() { s.Config.LogRedact = nil }()
+
+	// the publication is unreachable, its URL embeds its ISBN
+	inPub := newPublication()
+	inPub.Href = "http://127.0.0.1:1/9781234567897.epub"
+	data, _ := json.Marshal(inPub)
+	req, _ := http.NewRequest("POST", "/publications/", bytes.NewReader(data))
+	checkResponseCode(t, http.StatusCreated, executeRequest(req))
+	defer deletePublication(t, inPub.UUID)
+
+	req, _ = http.NewRequest("POST", "/publications/"+inPub.UUID+"/refresh-metadata", nil)
+	checkResponseCode(t, http.StatusBadGateway, executeRequest(req))
+	if strings.Contains(logs.String(), "9781234567897") || !strings.Contains(logs.String(), "failed to fetch [redacted:") {
+		t.Errorf("Unredacted logs: %s", logs.String())
+	}
+}
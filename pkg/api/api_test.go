@@ -18,6 +18,7 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
 	"github.com/google/uuid"
+	"gopkg.in/yaml.v2"
 	"syreclabs.com/go/faker"
 )
 
@@ -89,6 +90,24 @@ func setConfig() *conf.Config {
 	return &c
 }
 
+// newTestCtrl returns a controller on the store of the test server, with a deep copy of its
+// configuration, modified by configure if not nil.
+func newTestCtrl(t testing.TB, configure func(*conf.Config)) *APICtrl {
+	t.Helper()
+	data, err := yaml.Marshal(s.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cf conf.Config
+	if err := yaml.Unmarshal(data, &cf); err != nil {
+		t.Fatal(err)
+	}
+	if configure != nil {
+		configure(&cf)
+	}
+	return NewAPICtrl(&cf, s.Store, s.Cert)
+}
+
 // ---
 // Utilities - Publications
 // ---
@@ -280,6 +299,7 @@ func TestMain(m *testing.M) {
 		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
 			w.Write([]byte("This is the LCP Server running!"))
 		})
+		r.Get("/error-codes", h.ListErrorCodes)
 	})
 
 	r.Group(func(r chi.Router) {
@@ -301,9 +321,10 @@ func TestMain(m *testing.M) {
 			r.Post("/", h.CreatePublication)       // POST /publications
 
 			r.Route("/{publicationID}", func(r chi.Router) {
-				r.Get("/", h.GetPublication)       // GET /publications/123
-				r.Put("/", h.UpdatePublication)    // PUT /publications/123
-				r.Delete("/", h.DeletePublication) // DELETE /publications/123
+				r.Get("/", h.GetPublication)                              // GET /publications/123
+				r.Put("/", h.UpdatePublication)                           // PUT /publications/123
+				r.Delete("/", h.DeletePublication)                        // DELETE /publications/123
+				r.Post("/refresh-metadata", h.RefreshPublicationMetadata) // POST /publications/123/refresh-metadata
 			})
 		})
 
@@ -329,6 +350,11 @@ func TestMain(m *testing.M) {
 			})
 		})
 
+		// Encryption
+		r.Post("/encrypt", h.EncryptEPUB)          // POST /encrypt
+		r.Post("/encrypt-bundle", h.EncryptBundle) // POST /encrypt-bundle
+		r.Post("/encrypt-base64", h.EncryptBase64) // POST /encrypt-base64
+
 		// Status document management
 		r.Group(func(r chi.Router) {
 			r.Use(render.SetContentType(render.ContentTypeJSON))
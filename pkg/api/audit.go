@@ -0,0 +1,42 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package api
+
+import (
+	log "github.com/sirupsen/logrus"
+
+	"github.com/edrlab/lcp-server/pkg/conf"
+)
+
+// AuditRecord is the outcome of an audited operation, e.g. the re-encryption of a publication.
+type AuditRecord struct {
+	Operation string // e.g. "reencrypt"
+	UUID      string // publication
+	Account   string // dashboard account
+	Result    string // "success" or "failure"
+	Status    int    // HTTP status of the response
+}
+
+// AuditSink writes audit records. An error means that the record is lost.
+type AuditSink func(AuditRecord) error
+
+// LogAuditSink is the default audit sink, which writes the records in the application logs.
+func LogAuditSink(rec AuditRecord) error {
+	log.WithFields(log.Fields{"audit": rec.Operation, "uuid": rec.UUID, "account": rec.Account, "result": rec.Result, "status": rec.Status}).
+		Infof("audit: %s of %s by account %q: %s", rec.Operation, rec.UUID, rec.Account, rec.Result)
+	return nil
+}
+
+// audit writes an audit record. A write failure is logged; in fail-closed mode, it is also
+// returned, and the operation must be aborted.
+func (a *APICtrl) audit(rec AuditRecord) error {
+	err := a.AuditSink(rec)
+	if err == nil {
+		return nil
+	}
+	log.Errorf("audit: failed to write the record of the %s of %s: %v", rec.Operation, rec.UUID, err)
+	if a.Config.AuditMode == conf.AuditFailClosed {
+		return err
+	}
+	return nil
+}
@@ -3,42 +3,257 @@
 package api
 
 import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"mime"
+	"mime/quotedprintable"
 	"net/http"
+	"net/textproto"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/go-chi/render"
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/edrlab/lcp-server/pkg/conf"
+	"github.com/edrlab/lcp-server/pkg/keywrap"
+	"github.com/edrlab/lcp-server/pkg/meta"
+	"github.com/edrlab/lcp-server/pkg/pack"
+	"github.com/edrlab/lcp-server/pkg/stor"
 	"github.com/readium/readium-lcp-server/encrypt"
+	"github.com/readium/readium-lcp-server/epub"
 )
 
+// Permissions of the temp files and directories used for processing publications
+const (
+	defaultTempFileMode os.FileMode = 0600
+	workDirMode         os.FileMode = 0700
+)
+
+// defaultMaxBase64BodyBytes is the default size limit of the payload of EncryptBase64.
+const defaultMaxBase64BodyBytes = 64 << 20
+
+// Default thresholds of the protection levels, as ratios of encrypted resources
+const (
+	defaultFullProtectionRatio   = 0.8
+	defaultSampleProtectionRatio = 0.2
+)
+
+// Subjects of the checksum of the encrypt metadata
+const (
+	checksumOfEncrypted = "encrypted"
+	checksumOfSource    = "source"
+)
+
+// processEncryption encrypts a publication; replaced in tests.
+var processEncryption = encryptFile
+
 // EncryptResponse is returned as JSON in the X-Encrypt-Metadata header.
 type EncryptResponse struct {
 	UUID          string `json:"uuid"`
 	EncryptionKey string `json:"encryption_key"` // base64-encoded
 	Size          uint32 `json:"size"`
-	Checksum      string `json:"checksum"`
-	ContentType   string `json:"content_type"`
-	Title         string `json:"title"`
-	FileName      string `json:"file_name"`
+	// Checksum is the checksum of the encrypted publication (SHA-256, base64-encoded), as expected
+	// by POST /publications, or the checksum of the uploaded publication if checksum_of is "source"
+	Checksum string `json:"checksum"`
+	// ChecksumOf is the subject of Checksum: "encrypted" or "source"
+	ChecksumOf string `json:"checksum_of"`
+	// SourceChecksum is the checksum of the uploaded publication, computed like Checksum
+	SourceChecksum string `json:"source_checksum"`
+	ContentType    string `json:"content_type"`
+	Title          string `json:"title"`
+	FileName       string `json:"file_name"`
+	// Provider is the default provider of the tenant, if configured
+	Provider string `json:"provider,omitempty"`
+	// Warnings lists non-blocking issues found while processing the publication
+	Warnings                 []string `json:"warnings,omitempty"`
+	HasRemoteResources       bool     `json:"has_remote_resources"`
+	AccessibilityConformance string   `json:"accessibility_conformance"` // empty if not declared
+	// AccessibilitySummary is the accessibility summary declared by the publication, with its variants
+	// keyed by language (EPUB only)
+	AccessibilitySummary   string            `json:"accessibility_summary,omitempty"`
+	AccessibilitySummaries map[string]string `json:"accessibility_summaries,omitempty"`
+	// AltTitles are the variants of the title in other scripts, keyed by language (EPUB only)
+	AltTitles map[string]string `json:"alt_titles,omitempty"`
+	// Fingerprint identifies the clear content, whatever the encryption key
+	Fingerprint string `json:"fingerprint"`
+	// Identifiers are the identifiers of the publication, normalized if configured (EPUB only)
+	Identifiers []meta.Identifier `json:"identifiers,omitempty"`
+	// PrimaryLanguage and HasPronunciationData help configuring the reading system (EPUB only)
+	PrimaryLanguage      string `json:"primary_language,omitempty"`
+	HasPronunciationData bool   `json:"has_pronunciation_data"`
+	// HasTranscripts is set if an audiobook ships WebVTT transcripts or captions
+	HasTranscripts bool `json:"has_transcripts"`
+	// ContentRating is the age or content rating of the publication, declared or set by the request
+	ContentRating string `json:"content_rating,omitempty"`
+	// PageList are the print page equivalents of an EPUB, on request, empty if it declares none
+	PageList *[]meta.PageTarget `json:"page_list,omitempty"`
+	// SpineProperties are the effective rendition properties of the spine items of an EPUB, on request
+	SpineProperties []meta.SpineProperties `json:"spine_properties,omitempty"`
+	// FixedLayout is set if an EPUB is fixed-layout, as declared by its global rendition:layout
+	FixedLayout bool `json:"fixed_layout"`
+	// PageProgressionDirection is the direction of an EPUB, ltr or rtl, for the first rendering of reading systems
+	PageProgressionDirection string `json:"page_progression_direction,omitempty"`
+	// Modified and Created are the last modification and creation dates declared by an EPUB (RFC 3339)
+	Modified *time.Time `json:"modified,omitempty"`
+	Created  *time.Time `json:"created,omitempty"`
+	// ResourceCounts are the numbers of resources of an EPUB by type, e.g. for routing media-rich publications
+	ResourceCounts map[string]int `json:"resource_counts,omitempty"`
+	// ManifestHash is the digest of the manifest of the encrypted package (Readium Packages only)
+	ManifestHash string `json:"manifest_hash,omitempty"`
+	// ProtectionLevel is the extent of the protection: full, partial or sample
+	ProtectionLevel string `json:"protection_level"`
+	// Resources reports the processing of each resource, on request (EPUB only)
+	Resources []pack.Resource `json:"resources,omitempty"`
+	// ResourceMap lists the resources of the manifest and their encryption, on request (EPUB only)
+	ResourceMap []pack.ResourceLink `json:"resource_map,omitempty"`
+	// Metrics are statistics on the content, on request
+	Metrics *meta.ContentMetrics `json:"metrics,omitempty"`
+	// Cover is the cover image chosen for the publication, if any
+	Cover *meta.Cover `json:"cover,omitempty"`
+	// CoverColor and CoverPalette are the dominant color and main colors of the cover ("#rrggbb"), on request
+	CoverColor   string   `json:"cover_color,omitempty"`
+	CoverPalette []string `json:"cover_palette,omitempty"`
+	// WrappedEncryptionKey is the content key wrapped with the master key of the tenant (base64-encoded)
+	WrappedEncryptionKey string `json:"wrapped_encryption_key,omitempty"`
+	// Changes compares a re-encrypted publication with its stored record, empty if nothing changed
+	Changes *PublicationChanges `json:"changes,omitempty"`
+}
+
+// PublicationChanges lists the fields of the stored record of a publication changed by its re-encryption.
+type PublicationChanges struct {
+	Title    *Change `json:"title,omitempty"`
+	Size     *Change `json:"size,omitempty"`
+	Checksum *Change `json:"checksum,omitempty"`
 }
 
+// Change is the previous and new values of a field of a publication record.
+type Change struct {
+	Previous any `json:"previous"`
+	New      any `json:"new"`
+}
+
+// NoResponseFilter is the default response filter, which leaves responses unchanged.
+func NoResponseFilter(*EncryptResponse) {}
+
 // EncryptEPUB accepts an EPUB upload, encrypts it, and returns the encrypted
 // file as the response body with metadata in the X-Encrypt-Metadata header.
 // It does NOT store the file permanently or create a publication record.
 func (a *APICtrl) EncryptEPUB(w http.ResponseWriter, r *http.Request) {
+	a.encryptUpload(w, r, false)
+}
+
+// EncryptBundle accepts an EPUB upload with supplementary files, bundles the supplements
+// in the EPUB, and encrypts the bundle like EncryptEPUB, under one UUID and content key.
+func (a *APICtrl) EncryptBundle(w http.ResponseWriter, r *http.Request) {
+	a.encryptUpload(w, r, true)
+}
+
+// EncryptBase64Request is the payload of EncryptBase64.
+type EncryptBase64Request struct {
+	Filename   string `json:"filename"`
+	DataBase64 string `json:"data_base64"`
+	Title      string `json:"title"`
+}
+
+// EncryptBase64 accepts a publication as base64 data in a JSON payload, for clients
+// which cannot send multipart forms, and encrypts it like EncryptEPUB.
+// Other options can be passed as query parameters.
+func (a *APICtrl) EncryptBase64(w http.ResponseWriter, r *http.Request) {
+	log.Info("EncryptBase64: request received")
+
+	limit := int64(defaultMaxBase64BodyBytes)
+	if a.Config.Encrypt.MaxBase64BodyBytes > 0 {
+		limit = a.Config.Encrypt.MaxBase64BodyBytes
+	}
+	if r.ContentLength > limit {
+		log.Errorf("EncryptBase64: payload of %d bytes rejected", r.ContentLength)
+		render.Render(w, r, ErrPayloadTooLarge(nil))
+		return
+	}
+
+	// Admission control: while the payload is decoded, it is held twice in memory,
+	// in the buffer of the JSON decoder and as the decoded string
+	reserved := 2 * r.ContentLength
+	if reserved < 0 {
+		reserved = 2 * limit
+	}
+	if !a.reserveUploadMemory(w, r, reserved) {
+		return
+	}
+	defer a.uploads.release(reserved)
+
+	var req EncryptBase64Request
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit)).Decode(&req); err != nil {
+		log.Errorf("EncryptBase64: invalid payload: %v", err)
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			render.Render(w, r, ErrPayloadTooLarge(nil))
+			return
+		}
+		render.Render(w, r, ErrInvalidRequest(errors.New("invalid JSON payload")))
+		return
+	}
+	if filename := filepath.Base(req.Filename); filename != req.Filename || filename == "." || filename == ".." {
+		log.Errorf("EncryptBase64: invalid file name %q", a.redacted(conf.RedactFilename, req.Filename))
+		render.Render(w, r, ErrInvalidRequest(errors.New("invalid 'filename' field")))
+		return
+	}
+	if req.DataBase64 == "" {
+		log.Errorf("EncryptBase64: missing data")
+		render.Render(w, r, ErrInvalidRequest(errors.New("missing 'data_base64' field")))
+		return
+	}
+
+	// the title of the payload overrides the query parameters
+	r.Form = r.URL.Query()
+	if req.Title != "" {
+		r.Form.Set("title", req.Title)
+	}
+	// the data is decoded while the upload is saved, malformed data is rejected then
+	data := base64.NewDecoder(base64.StdEncoding, strings.NewReader(req.DataBase64))
+	a.encryptPublication(w, r, data, req.Filename, false)
+}
+
+// reserveUploadMemory reserves memory for an upload, under the global cap on in-memory uploads.
+// It renders an error asking the client to retry if the cap is reached.
+func (a *APICtrl) reserveUploadMemory(w http.ResponseWriter, r *http.Request, n int64) bool {
+	if a.uploads.reserve(n, a.Config.Encrypt.MaxTotalInMemoryBytes) {
+		return true
+	}
+	metricUploadMemoryRejected.Add(1)
+	log.Warnf("EncryptEPUB: in-memory upload cap reached, request rejected")
+	w.Header().Set("Retry-After", "5")
+	render.Render(w, r, ErrBusy(nil))
+	return false
+}
+
+// encryptUpload encrypts an uploaded publication, with its supplements if bundle is set.
+func (a *APICtrl) encryptUpload(w http.ResponseWriter, r *http.Request, bundle bool) {
 	log.Info("EncryptEPUB: request received")
 
-	// 1. Parse multipart form (max 50 MB)
-	if err := r.ParseMultipartForm(50 << 20); err != nil {
+	// Admission control on the memory used by form buffers across requests
+	reserved := formMemory(r.ContentLength)
+	if !a.reserveUploadMemory(w, r, reserved) {
+		return
+	}
+	defer a.uploads.release(reserved)
+
+	// 1. Parse multipart form (max 50 MB in memory)
+	if err := r.ParseMultipartForm(maxFormMemory); err != nil {
 		log.Errorf("EncryptEPUB: failed to parse multipart form: %v", err)
-		http.Error(w, "failed to parse multipart form", http.StatusBadRequest)
+		render.Render(w, r, ErrInvalidRequest(errors.New("failed to parse multipart form")))
 		return
 	}
 
@@ -46,67 +261,462 @@ func (a *APICtrl) EncryptEPUB(w http.ResponseWriter, r *http.Request) {
 	file, header, err := r.FormFile("file")
 	if err != nil {
 		log.Errorf("EncryptEPUB: missing file field: %v", err)
-		http.Error(w, "missing 'file' field", http.StatusBadRequest)
+		render.Render(w, r, ErrInvalidRequest(errors.New("missing 'file' field")))
 		return
 	}
 	defer file.Close()
+	data, err := decodePart(file, header.Header)
+	if err != nil {
+		log.Errorf("EncryptEPUB: %v", err)
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
 
+	a.encryptPublication(w, r, data, header.Filename, bundle)
+}
+
+// encryptPublication runs the encryption pipeline on an uploaded file. Options are read from
+// the form values of the request; the supplements of a bundle from its multipart form.
+func (a *APICtrl) encryptPublication(w http.ResponseWriter, r *http.Request, file io.Reader, filename string, bundle bool) {
 	// Optional title field
 	title := r.FormValue("title")
+	// Optional rejection of publications referencing remote resources
+	rejectRemote := r.FormValue("reject_remote_resources") == "true"
+	// Optional resource report (EPUB only)
+	resourceReport := r.FormValue("resource_report") == "true"
+	// Optional map of the resources and their encryption, for client prefetch (EPUB only)
+	resourceMap := r.FormValue("resource_map") == "true"
+	// Optional print page equivalents (EPUB only)
+	pageList := r.FormValue("page_list") == "true"
+	// Optional rendition properties of the spine items (EPUB only)
+	spineProperties := r.FormValue("spine_properties") == "true"
+	// Optional content metrics (word count, estimated reading time)
+	includeMetrics := r.FormValue("include_metrics") == "true"
+	// Optional colors of the cover, for theming reading systems
+	coverColors := r.FormValue("cover_colors") == "true"
+	// Optional decryption of a resource of the output, checked against the clear publication
+	selfTest := r.FormValue("self_test") == "true"
+	// Optional digests of the clear resources, embedded in the manifest (Readium Packages only)
+	resourceDigests := r.FormValue("resource_digests") == "true"
+	// Optional selection of the EPUB resources left in clear, overriding the configuration
+	policyName := a.Config.Encrypt.ClearPolicy
+	if p := r.FormValue("clear_policy"); p != "" {
+		policyName = p
+	}
+	clearPolicy, err := pack.ParseClearPolicy(policyName)
+	if err != nil {
+		log.Errorf("EncryptEPUB: %v", err)
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	// Optional processing of the fonts obfuscated in the source EPUB, overriding the configuration
+	fontPolicyName := a.Config.Encrypt.FontObfuscation
+	if p := r.FormValue("font_obfuscation"); p != "" {
+		fontPolicyName = p
+	}
+	fontPolicy, err := pack.ParseFontPolicy(fontPolicyName)
+	if err != nil {
+		log.Errorf("EncryptEPUB: %v", err)
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+	coverOrder, err := meta.ParseCoverOrder(a.Config.Encrypt.CoverOrder)
+	if err != nil {
+		log.Errorf("EncryptEPUB: invalid cover order: %v", err)
+		render.Render(w, r, ErrServer(nil))
+		return
+	}
+	// In multi-tenant mode, content keys are wrapped with the master key of the tenant
+	masterKey, err := a.tenantMasterKey(r)
+	if err != nil {
+		log.Errorf("EncryptEPUB: %v", err)
+		render.Render(w, r, ErrForbidden(errors.New("no master key available for the account")))
+		return
+	}
+	// Optional re-encryption of an existing publication, under its UUID and with its escrowed content key
+	var contentID string
+	var contentKey []byte
+	var previous *stor.Publication // stored record of a re-encrypted publication
+	var auditRecord *AuditRecord   // audit of a re-encryption
+	var audited bool               // set once the success of a re-encryption is audited
+	if id := r.FormValue("uuid"); id != "" {
+		// a success is audited before the response is sent, a failure once the error is returned
+		account := r.Header.Get("X-Username")
+		auditRecord = &AuditRecord{Operation: "reencrypt", UUID: id, Account: account}
+		rec := &statusRecorder{ResponseWriter: w}
+		w = rec
+		defer func() {
+			if !audited {
+				auditRecord.Result, auditRecord.Status = "failure", rec.status
+				a.audit(*auditRecord)
+			}
+		}()
+		if masterKey == nil {
+			log.Errorf("EncryptEPUB: re-encryption of %s without key escrow", id)
+			render.Render(w, r, ErrForbidden(errors.New("key escrow is not enabled for the account")))
+			return
+		}
+		if _, err := uuid.Parse(id); err != nil {
+			log.Errorf("EncryptEPUB: invalid uuid %q", id)
+			render.Render(w, r, ErrInvalidRequest(errors.New("invalid 'uuid' field")))
+			return
+		}
+		if contentKey, err = unwrapContentKey(masterKey, r.FormValue("wrapped_encryption_key")); err != nil {
+			log.Errorf("EncryptEPUB: %v", err)
+			render.Render(w, r, ErrInvalidRequest(errors.New("invalid 'wrapped_encryption_key' field")))
+			return
+		}
+		unlock := a.lockUUID(w, r, id)
+		if unlock == nil {
+			return
+		}
+		defer unlock()
+		// the existing licenses only decrypt the new output if it uses their content key
+		stored, err := a.Store.Publication().Get(id)
+		if err != nil || stored.DeletedAt.Valid {
+			log.Errorf("EncryptEPUB: re-encryption of unknown publication %s", id)
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+		if subtle.ConstantTimeCompare(contentKey, stored.EncryptionKey) != 1 {
+			log.Errorf("EncryptEPUB: the escrowed key is not the content key of %s", id)
+			render.Render(w, r, ErrKeyMismatch(errors.New("'wrapped_encryption_key' is not the content key of the publication")))
+			return
+		}
+		contentID, previous = id, stored
+		// the output is always checked against the content key of the existing licenses
+		selfTest = true
+	}
 
 	// 3. Create temp directory for processing
-	tempDir, err := os.MkdirTemp("", "lcp-encrypt-*")
+	fileMode := a.tempFileMode()
+	tempDir, err := newWorkDir("lcp-encrypt-*")
 	if err != nil {
 		log.Errorf("EncryptEPUB: failed to create temp dir: %v", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		render.Render(w, r, ErrServer(nil))
 		return
 	}
-	defer os.RemoveAll(tempDir)
+	// the temp directory is kept for diagnosis if the encrypted output is inconsistent (debug only)
+	keepTempDir := false
+	defer func() {
+		if !keepTempDir {
+			os.RemoveAll(tempDir)
+		}
+	}()
 
-	// 4. Save the uploaded file to temp directory
-	inputPath := filepath.Join(tempDir, header.Filename)
-	if err := saveMultipartFile(file, inputPath); err != nil {
-		log.Errorf("EncryptEPUB: failed to save uploaded file: %v", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+	// 4. Save the uploaded file to temp directory, hashing it on the way
+	// the name of the upload is redacted from the errors which are logged or returned, if configured
+	hide := func(err error) error { return a.redactedError(conf.RedactFilename, filename, err) }
+	inputPath := filepath.Join(tempDir, filename)
+	sourceHasher := sha256.New()
+	if err := saveMultipartFile(io.TeeReader(file, sourceHasher), inputPath, fileMode); err != nil {
+		var corrupt base64.CorruptInputError
+		if errors.As(err, &corrupt) {
+			log.Errorf("EncryptEPUB: malformed base64 part: %v", hide(err))
+			render.Render(w, r, ErrInvalidRequest(errors.New("malformed base64 data")))
+			return
+		}
+		log.Errorf("EncryptEPUB: failed to save uploaded file: %v", hide(err))
+		render.Render(w, r, ErrServer(nil))
 		return
 	}
 
-	// 5. Generate UUID
-	contentID := uuid.New().String()
+	// Bundle the supplementary files in the EPUB
+	if bundle {
+		if inputPath, err = bundleSupplements(r, inputPath, fileMode); err != nil {
+			log.Errorf("EncryptEPUB: unable to bundle the supplements: %v", hide(err))
+			render.Render(w, r, ErrInvalidRequest(fmt.Errorf("invalid bundle: %w", hide(err))))
+			return
+		}
+	}
+
+	// Run the external validator, if configured
+	if err := a.validate(r.Context(), inputPath); err != nil {
+		var verdict *validationError
+		if errors.As(err, &verdict) {
+			log.Errorf("EncryptEPUB: the publication was rejected by the validator")
+			render.Render(w, r, ErrValidation(hide(err)))
+			return
+		}
+		log.Errorf("EncryptEPUB: validator failure: %v", hide(err))
+		render.Render(w, r, ErrValidatorUnavailable(nil))
+		return
+	}
+
+	// Look for the transcripts of an audiobook, and declare them in its manifest if configured
+	var transcripts []string
+	if filepath.Ext(inputPath) == ".audiobook" {
+		if transcripts, err = pack.FindTranscripts(inputPath); err != nil {
+			log.Errorf("EncryptEPUB: failed to read the audiobook: %v", hide(err))
+			render.Render(w, r, ErrInvalidPublication(fmt.Errorf("invalid publication: %w", hide(err))))
+			return
+		}
+		if a.Config.Encrypt.DeclareTranscripts && len(transcripts) > 0 {
+			if err := rewriteInPlace(inputPath, func(src, dst string) error {
+				return pack.DeclareTranscripts(src, dst, transcripts)
+			}); err != nil {
+				log.Errorf("EncryptEPUB: failed to declare the transcripts: %v", hide(err))
+				render.Render(w, r, ErrInvalidPublication(fmt.Errorf("invalid publication: %w", hide(err))))
+				return
+			}
+		}
+	}
+
+	// Apply the post-processing steps of the format to the working copy
+	if err := a.postProcess(r.Context(), inputPath); err != nil {
+		log.Errorf("EncryptEPUB: post-processing failed: %v", hide(err))
+		render.Render(w, r, ErrServer(errors.New("post-processing failed")))
+		return
+	}
+
+	// Run the metadata pass on the clear publication (EPUB only)
+	info := &meta.Info{}
+	if filepath.Ext(inputPath) == ".epub" {
+		if info, err = meta.Inspect(inputPath, a.Config.Encrypt.MaxSummaryLength); err != nil {
+			// the encryption will report a malformed EPUB
+			log.Warnf("EncryptEPUB: metadata pass failed: %v", hide(err))
+			info = &meta.Info{}
+		}
+	}
+	if a.Config.Encrypt.NormalizeIdentifiers {
+		info.Warnings = append(info.Warnings, meta.NormalizeIdentifiers(info.Identifiers)...)
+	}
+	var metrics *meta.ContentMetrics
+	if includeMetrics {
+		if metrics, err = meta.ReadContentMetrics(inputPath, a.Config.Encrypt.WordsPerMinute); err != nil {
+			log.Warnf("EncryptEPUB: unable to compute the content metrics: %v", hide(err))
+			metrics = &meta.ContentMetrics{}
+		}
+	}
+	cover, err := meta.FindCover(inputPath, coverOrder)
+	if err != nil {
+		log.Warnf("EncryptEPUB: unable to find the cover: %v", hide(err))
+	} else if cover != nil && len(cover.Conflicts) > 0 {
+		log.Infof("EncryptEPUB: cover %s chosen from %s, other declared covers: %s", cover.Path, cover.Source, strings.Join(cover.Conflicts, ", "))
+	} else if cover != nil {
+		log.Debugf("EncryptEPUB: cover %s chosen from %s", cover.Path, cover.Source)
+	}
+	var colors *meta.CoverColors
+	if coverColors && cover != nil {
+		if colors, err = cover.Colors(inputPath, meta.DefaultPaletteSize); err != nil {
+			log.Warnf("EncryptEPUB: unable to compute the cover colors: %v", hide(err))
+			info.Warnings = append(info.Warnings, "cover colors not available: "+hide(err).Error())
+		}
+	}
+	// other formats are fingerprinted from the whole file
+	if info.Fingerprint == "" {
+		if _, fp, err := fileSizeAndChecksum(inputPath); err == nil {
+			info.Fingerprint = fp
+		}
+	}
+	var digests map[string]string
+	if resourceDigests {
+		if isReadiumPackage(inputPath) {
+			if digests, err = pack.ResourceDigests(inputPath); err != nil {
+				log.Errorf("EncryptEPUB: failed to compute the resource digests: %v", hide(err))
+				render.Render(w, r, ErrInvalidPublication(fmt.Errorf("invalid publication: %w", hide(err))))
+				return
+			}
+		} else {
+			info.Warnings = append(info.Warnings, "resource digests are only available for Readium Packages")
+		}
+	}
+	if a.Config.Encrypt.RequireContent {
+		if err := meta.CheckContent(inputPath); err != nil {
+			log.Errorf("EncryptEPUB: the publication has no content: %v", hide(err))
+			render.Render(w, r, ErrInvalidPublication(fmt.Errorf("the publication has no content: %w", hide(err))))
+			return
+		}
+	}
+	// the content rating of the request prevails over the declared one
+	declaredRating := info.ContentRating
+	if rating := strings.TrimSpace(r.FormValue("content_rating")); rating != "" {
+		info.ContentRating = rating
+	}
+	if err := a.checkContentRating(r, declaredRating, info.ContentRating); err != nil {
+		log.Errorf("EncryptEPUB: %v", err)
+		render.Render(w, r, ErrInvalidPublication(err))
+		return
+	}
+	if rejectRemote && info.HasRemoteResources {
+		log.Errorf("EncryptEPUB: the publication references remote resources")
+		render.Render(w, r, ErrInvalidPublication(errors.New("the publication references remote resources")))
+		return
+	}
+
+	// 5. Generate UUID, unless an existing publication is re-encrypted
+	if contentID == "" {
+		contentID = uuid.New().String()
+	}
 
 	// 6. Create output directory
 	outputDir := filepath.Join(tempDir, "output")
-	if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
+	if err := os.Mkdir(outputDir, workDirMode); err != nil {
 		log.Errorf("EncryptEPUB: failed to create output dir: %v", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		render.Render(w, r, ErrServer(nil))
 		return
 	}
 
-	// 7. Encrypt the publication
-	// Parameters: contentID, contentKey, inputPath, tempRepo, outputRepo,
-	//             storageRepo, storageURL, storageFilename, extractCover, pdfNoMeta
-	publication, err := encrypt.ProcessEncryption(
-		contentID, "", inputPath, "", outputDir,
-		"", "", "", false, false,
-	)
+	// 7. Encrypt the publication, unless the client is gone
+	if clientGone(r, "encryption") {
+		return
+	}
+	opts := pack.Options{
+		CompressionLevel:    a.Config.Encrypt.CompressionLevel,
+		ClearPolicy:         clearPolicy,
+		FontPolicy:          fontPolicy,
+		MinEncryptSize:      a.Config.Encrypt.MinEncryptSize,
+		ContentKey:          contentKey,
+		NormalizeMediaTypes: a.Config.Encrypt.NormalizeMediaTypes,
+	}
+	publication, resources, warnings, err := processEncryption(contentID, inputPath, outputDir, opts)
 	if err != nil {
-		log.Errorf("EncryptEPUB: encryption failed: %v", err)
-		http.Error(w, "encryption failed: "+err.Error(), http.StatusInternalServerError)
+		log.Errorf("EncryptEPUB: encryption failed: %v", hide(err))
+		render.Render(w, r, ErrServer(fmt.Errorf("encryption failed: %w", hide(err))))
+		return
+	}
+	info.Warnings = append(info.Warnings, warnings...)
+	// the post-encryption steps rewrite or read the whole output
+	if clientGone(r, "packaging") {
 		return
 	}
 
-	// Use the title from the EPUB metadata if not provided in form
-	pubTitle := publication.Title
+	// Use the title from the EPUB metadata if not provided in form,
+	// with the prefix and suffix of the tenant
+	defaults := a.tenantDefaults(r)
+	pubTitle := defaults.TitlePrefix + publication.Title + defaults.TitleSuffix
 	if title != "" {
 		pubTitle = title
 	}
 
-	// 8. Read the encrypted file
 	encryptedPath := filepath.Join(outputDir, publication.FileName)
+
+	// Check that the encrypted output is where and what the encryption tool reports
+	if err := verifyEncryptedOutput(encryptedPath, publication.Size); err != nil {
+		log.Errorf("EncryptEPUB: inconsistent encryption output: %v", err)
+		if log.IsLevelEnabled(log.DebugLevel) {
+			keepTempDir = true
+			log.Debugf("EncryptEPUB: temp dir preserved at %s", tempDir)
+		}
+		render.Render(w, r, ErrServer(errors.New("encryption output verification failed")))
+		return
+	}
+
+	// Repackage the clear resources if a compression level is configured
+	// (EPUB publications are directly packaged at this level)
+	if level := a.Config.Encrypt.CompressionLevel; level != pack.DefaultCompression && publication.ContentType != epub.ContentType_EPUB {
+		log.Debugf("EncryptEPUB: repackaging with compression level %d", level)
+		if err := repackEncryptedFile(encryptedPath, pack.Options{CompressionLevel: level}); err != nil {
+			log.Errorf("EncryptEPUB: failed to repackage encrypted file: %v", err)
+			render.Render(w, r, ErrServer(nil))
+			return
+		}
+		publication.Size, publication.Checksum, err = fileSizeAndChecksum(encryptedPath)
+		if err != nil {
+			log.Errorf("EncryptEPUB: failed to read repackaged file: %v", err)
+			render.Render(w, r, ErrServer(nil))
+			return
+		}
+	}
+
+	// Embed the digests of the clear resources in the manifest
+	if digests != nil {
+		if clientGone(r, "embedding of the digests") {
+			return
+		}
+		if err := addDigestsToEncryptedFile(encryptedPath, digests); err != nil {
+			log.Errorf("EncryptEPUB: failed to add the resource digests: %v", err)
+			render.Render(w, r, ErrServer(nil))
+			return
+		}
+		publication.Size, publication.Checksum, err = fileSizeAndChecksum(encryptedPath)
+		if err != nil {
+			log.Errorf("EncryptEPUB: failed to read the encrypted file: %v", err)
+			render.Render(w, r, ErrServer(nil))
+			return
+		}
+	}
+
+	// Fix the timestamps of the entries, so that they do not leak the processing time
+	if a.Config.Encrypt.EntryTimestamp != "" {
+		if clientGone(r, "rewriting of the timestamps") {
+			return
+		}
+		modified, err := entryTimestamp(a.Config.Encrypt.EntryTimestamp, info)
+		if err != nil {
+			log.Errorf("EncryptEPUB: invalid configuration: %v", err)
+			render.Render(w, r, ErrServer(nil))
+			return
+		}
+		if err := setTimestampsOfEncryptedFile(encryptedPath, modified); err != nil {
+			log.Errorf("EncryptEPUB: failed to set the timestamps of the encrypted file: %v", err)
+			render.Render(w, r, ErrServer(nil))
+			return
+		}
+		publication.Size, publication.Checksum, err = fileSizeAndChecksum(encryptedPath)
+		if err != nil {
+			log.Errorf("EncryptEPUB: failed to read the encrypted file: %v", err)
+			render.Render(w, r, ErrServer(nil))
+			return
+		}
+	}
+
+	// Check that the output decrypts with the content key
+	if selfTest {
+		if clientGone(r, "self-test") {
+			return
+		}
+		if err := pack.SelfTest(inputPath, encryptedPath, publication.EncryptionKey); err != nil {
+			log.Errorf("EncryptEPUB: %v", hide(err))
+			if !errors.Is(err, pack.ErrSelfTest) {
+				render.Render(w, r, ErrServer(nil))
+				return
+			}
+			if log.IsLevelEnabled(log.DebugLevel) {
+				keepTempDir = true
+				log.Debugf("EncryptEPUB: temp dir preserved at %s", tempDir)
+			}
+			render.Render(w, r, ErrSelfTest(hide(err)))
+			return
+		}
+	}
+
+	// The encryption tool creates the output file with the process umask
+	if err := os.Chmod(encryptedPath, fileMode); err != nil {
+		log.Errorf("EncryptEPUB: failed to set the mode of the encrypted file: %v", err)
+		render.Render(w, r, ErrServer(nil))
+		return
+	}
+
+	// Hash the manifest of a Readium Package, so that clients can detect its changes
+	var manifestHash string
+	if publication.ContentType != epub.ContentType_EPUB {
+		if manifestHash, err = pack.ManifestHash(encryptedPath); err != nil {
+			log.Errorf("EncryptEPUB: failed to hash the manifest: %v", err)
+			render.Render(w, r, ErrServer(nil))
+			return
+		}
+	}
+
+	// Map the resources of an EPUB, from its encrypted manifest
+	var links []pack.ResourceLink
+	if resourceMap {
+		if publication.ContentType == epub.ContentType_EPUB {
+			if links, err = pack.ResourceMap(encryptedPath, resources); err != nil {
+				log.Errorf("EncryptEPUB: failed to map the resources: %v", err)
+				render.Render(w, r, ErrServer(nil))
+				return
+			}
+		} else {
+			info.Warnings = append(info.Warnings, "resource maps are only available for EPUBs")
+		}
+	}
+
+	// 8. Read the encrypted file
 	encryptedFile, err := os.Open(encryptedPath)
 	if err != nil {
 		log.Errorf("EncryptEPUB: failed to open encrypted file: %v", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		render.Render(w, r, ErrServer(nil))
 		return
 	}
 	defer encryptedFile.Close()
@@ -118,48 +728,417 @@ func (a *APICtrl) EncryptEPUB(w http.ResponseWriter, r *http.Request) {
 	if raw, err := hex.DecodeString(publication.Checksum); err == nil {
 		checksumB64 = base64.StdEncoding.EncodeToString(raw)
 	}
+	encryptedChecksum := checksumB64
+
+	sourceChecksum := base64.StdEncoding.EncodeToString(sourceHasher.Sum(nil))
+	checksumOf := checksumOfEncrypted
+	if a.Config.Encrypt.ChecksumOf == checksumOfSource {
+		checksumB64, checksumOf = sourceChecksum, checksumOfSource
+	}
 
 	metadata := EncryptResponse{
-		UUID:          publication.UUID,
-		EncryptionKey: base64.StdEncoding.EncodeToString(publication.EncryptionKey),
-		Size:          publication.Size,
-		Checksum:      checksumB64,
-		ContentType:   publication.ContentType,
-		Title:         pubTitle,
-		FileName:      publication.FileName,
+		UUID:                     publication.UUID,
+		EncryptionKey:            base64.StdEncoding.EncodeToString(publication.EncryptionKey),
+		Size:                     publication.Size,
+		Checksum:                 checksumB64,
+		ChecksumOf:               checksumOf,
+		SourceChecksum:           sourceChecksum,
+		ContentType:              publication.ContentType,
+		Title:                    pubTitle,
+		FileName:                 publication.FileName,
+		Provider:                 defaults.Provider,
+		Warnings:                 info.Warnings,
+		HasRemoteResources:       info.HasRemoteResources,
+		AccessibilityConformance: info.AccessibilityConformance,
+		AccessibilitySummary:     info.AccessibilitySummary,
+		AccessibilitySummaries:   info.AccessibilitySummaries,
+		AltTitles:                info.AltTitles,
+		Fingerprint:              info.Fingerprint,
+		Identifiers:              info.Identifiers,
+		PrimaryLanguage:          info.PrimaryLanguage,
+		HasPronunciationData:     info.HasPronunciationData,
+		HasTranscripts:           len(transcripts) > 0,
+		ContentRating:            info.ContentRating,
+		FixedLayout:              info.FixedLayout,
+		PageProgressionDirection: info.PageProgressionDirection,
+		Modified:                 optionalTime(info.Modified),
+		Created:                  optionalTime(info.Created),
+		ResourceCounts:           info.ResourceCounts,
+		ManifestHash:             manifestHash,
+	}
+	if pageList {
+		pages := info.PageList
+		if pages == nil {
+			pages = []meta.PageTarget{}
+		}
+		metadata.PageList = &pages
+	}
+	if spineProperties {
+		metadata.SpineProperties = info.SpineProperties
+	}
+	metadata.ProtectionLevel = a.protectionLevel(resources)
+	if resourceReport {
+		metadata.Resources = resources
+	}
+	metadata.ResourceMap = links
+	metadata.Metrics = metrics
+	metadata.Cover = cover
+	if colors != nil {
+		metadata.CoverColor, metadata.CoverPalette = colors.Color, colors.Palette
+	}
+	if masterKey != nil {
+		wrapped, err := keywrap.Wrap(masterKey, publication.EncryptionKey)
+		if err != nil {
+			log.Errorf("EncryptEPUB: failed to wrap the content key: %v", err)
+			render.Render(w, r, ErrServer(nil))
+			return
+		}
+		metadata.WrappedEncryptionKey = base64.StdEncoding.EncodeToString(wrapped)
 	}
 
+	if previous != nil {
+		metadata.Changes = publicationChanges(previous, pubTitle, publication.Size, encryptedChecksum)
+	}
+
+	a.ResponseFilter(&metadata)
 	metadataJSON, err := json.Marshal(metadata)
 	if err != nil {
 		log.Errorf("EncryptEPUB: failed to marshal metadata: %v", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		render.Render(w, r, ErrServer(nil))
 		return
 	}
 
+	// the output of a re-encryption is not delivered if its audit is lost, in fail-closed mode
+	if auditRecord != nil {
+		auditRecord.Result, auditRecord.Status = "success", http.StatusOK
+		if err := a.audit(*auditRecord); err != nil {
+			render.Render(w, r, ErrAuditUnavailable(nil))
+			return
+		}
+		audited = true
+	}
+
 	// 10. Set metadata in header, stream encrypted file as body
 	w.Header().Set("X-Encrypt-Metadata", string(metadataJSON))
 	w.Header().Set("Content-Type", publication.ContentType)
 	w.Header().Set("Content-Disposition", "attachment; filename=\""+publication.FileName+"\"")
 	w.WriteHeader(http.StatusOK)
 
-	if _, err := io.Copy(w, encryptedFile); err != nil {
+	// stop reading the file as soon as the client disconnects
+	if _, err := io.Copy(w, &contextReader{ctx: r.Context(), r: encryptedFile}); err != nil {
+		if r.Context().Err() != nil {
+			log.Warnf("EncryptEPUB: client disconnected while streaming, uuid=%s", publication.UUID)
+			metricEncryptOutcomes.Add(outcomeClientDisconnect, 1)
+			return
+		}
 		log.Errorf("EncryptEPUB: failed to stream encrypted file: %v", err)
+		metricEncryptOutcomes.Add(outcomeStreamError, 1)
 		return
 	}
+	metricEncryptOutcomes.Add(outcomeSuccess, 1)
 
-	log.Infof("EncryptEPUB: success, uuid=%s, title=%s, size=%d", publication.UUID, pubTitle, publication.Size)
+	log.Infof("EncryptEPUB: success, uuid=%s, title=%s, size=%d", publication.UUID, a.redacted(conf.RedactTitle, pubTitle), publication.Size)
 }
 
-// saveMultipartFile saves an uploaded multipart file to disk.
-func saveMultipartFile(src io.Reader, dst string) error {
+// publicationChanges compares the stored record of a re-encrypted publication with its new
+// title, size and checksum (of the encrypted publication, as stored).
+func publicationChanges(previous *stor.Publication, title string, size uint32, checksum string) *PublicationChanges {
+	changes := &PublicationChanges{}
+	if previous.Title != title {
+		changes.Title = &Change{Previous: previous.Title, New: title}
+	}
+	if previous.Size != size {
+		changes.Size = &Change{Previous: previous.Size, New: size}
+	}
+	if previous.Checksum != checksum {
+		changes.Checksum = &Change{Previous: previous.Checksum, New: checksum}
+	}
+	return changes
+}
+
+// clientGone checks if the client closed the connection before a step of the encryption,
+// in which case the remaining work is cancelled.
+func clientGone(r *http.Request, step string) bool {
+	if r.Context().Err() == nil {
+		return false
+	}
+	log.Warnf("EncryptEPUB: client disconnected before the %s", step)
+	metricEncryptOutcomes.Add(outcomeClientDisconnect, 1)
+	return true
+}
+
+// statusRecorder records the status code of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// bundleSupplements adds the supplementary files of a bundle request to the EPUB at inputPath.
+// It returns the path of the bundled EPUB, next to the input.
+func bundleSupplements(r *http.Request, inputPath string, mode os.FileMode) (string, error) {
+	if filepath.Ext(inputPath) != ".epub" {
+		return "", errors.New("the primary publication must be an EPUB")
+	}
+	headers := r.MultipartForm.File["supplements"]
+	if len(headers) == 0 {
+		return "", errors.New("missing 'supplements' field")
+	}
+
+	dir := filepath.Join(filepath.Dir(inputPath), "supplements")
+	if err := os.Mkdir(dir, workDirMode); err != nil {
+		return "", err
+	}
+	var supplements []pack.Supplement
+	for i, h := range headers {
+		name := filepath.Base(h.Filename)
+		if name == "." || name == string(filepath.Separator) {
+			return "", fmt.Errorf("invalid supplement name %q", h.Filename)
+		}
+		f, err := h.Open()
+		if err != nil {
+			return "", err
+		}
+		data, err := decodePart(f, h.Header)
+		if err != nil {
+			f.Close()
+			return "", fmt.Errorf("supplement %q: %w", name, err)
+		}
+		// saved under an index, the name may not be a valid file name on the server
+		path := filepath.Join(dir, strconv.Itoa(i))
+		err = saveMultipartFile(data, path, mode)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+		mediaType := mime.TypeByExtension(filepath.Ext(name))
+		if mediaType == "" {
+			mediaType = "application/octet-stream"
+		}
+		if mt, _, err := mime.ParseMediaType(mediaType); err == nil {
+			mediaType = mt
+		}
+		supplements = append(supplements, pack.Supplement{Name: name, Path: path, MediaType: mediaType})
+	}
+
+	bundlePath := inputPath + ".bundle.epub"
+	if err := pack.AddSupplements(inputPath, bundlePath, supplements); err != nil {
+		return "", err
+	}
+	return bundlePath, os.Chmod(bundlePath, mode)
+}
+
+// contextReader is a reader failing once its context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// decodePart returns the content of a multipart file, decoded according to its transfer encoding.
+// The standard library only decodes quoted-printable parts, and some clients send base64 parts.
+func decodePart(r io.Reader, header textproto.MIMEHeader) (io.Reader, error) {
+	switch enc := strings.ToLower(strings.TrimSpace(header.Get("Content-Transfer-Encoding"))); enc {
+	case "", "7bit", "8bit", "binary":
+		return r, nil
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r), nil
+	case "quoted-printable":
+		return quotedprintable.NewReader(r), nil
+	default:
+		return nil, fmt.Errorf("unsupported transfer encoding %q", enc)
+	}
+}
+
+// saveMultipartFile saves an uploaded multipart file to disk, with the given permissions.
+func saveMultipartFile(src io.Reader, dst string, mode os.FileMode) error {
 	if src == nil {
 		return errors.New("source is nil")
 	}
-	out, err := os.Create(dst)
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
 	if err != nil {
 		return err
 	}
 	defer out.Close()
+	// the mode passed at creation is altered by the umask
+	if err := out.Chmod(mode); err != nil {
+		return err
+	}
 	_, err = io.Copy(out, src)
 	return err
 }
+
+// newWorkDir creates a temp directory only accessible by the server.
+func newWorkDir(pattern string) (string, error) {
+	dir, err := os.MkdirTemp("", pattern)
+	if err != nil {
+		return "", err
+	}
+	if err := os.Chmod(dir, workDirMode); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// tempFileMode returns the permissions of temp files holding publications.
+func (a *APICtrl) tempFileMode() os.FileMode {
+	if a.Config.Encrypt.TempFileMode != 0 {
+		return a.Config.Encrypt.TempFileMode
+	}
+	return defaultTempFileMode
+}
+
+// encryptFile encrypts the publication at inputPath into outputDir.
+// EPUB publications are packaged by the server, which applies the options and reports
+// the processing of each resource, with warnings on obfuscated fonts; other formats are processed by the LCP encryption tool.
+func encryptFile(contentID, inputPath, outputDir string, opts pack.Options) (*encrypt.Publication, []pack.Resource, []string, error) {
+	if filepath.Ext(inputPath) != ".epub" {
+		// Parameters: contentID, contentKey, inputPath, tempRepo, outputRepo,
+		//             storageRepo, storageURL, storageFilename, extractCover, pdfNoMeta
+		var contentKey string
+		if opts.ContentKey != nil {
+			contentKey = base64.StdEncoding.EncodeToString(opts.ContentKey)
+		}
+		publication, err := encrypt.ProcessEncryption(
+			contentID, contentKey, inputPath, "", outputDir,
+			"", "", "", false, false,
+		)
+		return publication, nil, nil, err
+	}
+
+	publication := &encrypt.Publication{
+		UUID:        contentID,
+		InputPath:   inputPath,
+		OutputRepo:  outputDir,
+		FileName:    contentID + ".epub",
+		ContentType: epub.ContentType_EPUB,
+	}
+	outputPath := filepath.Join(outputDir, publication.FileName)
+	res, err := pack.EncryptEPUB(inputPath, outputPath, opts)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	publication.Title = res.Title
+	publication.EncryptionKey = res.Key
+	publication.Size, publication.Checksum, err = fileSizeAndChecksum(outputPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return publication, res.Resources, res.Warnings, nil
+}
+
+// verifyEncryptedOutput checks that the encrypted file exists and has the expected size.
+func verifyEncryptedOutput(path string, size uint32) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("missing encrypted file: %w", err)
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", fi.Name())
+	}
+	if fi.Size() != int64(size) {
+		return fmt.Errorf("size mismatch for %s: %d bytes, %d expected", fi.Name(), fi.Size(), size)
+	}
+	return nil
+}
+
+// repackEncryptedFile rewrites an encrypted container in place.
+func repackEncryptedFile(path string, opts pack.Options) error {
+	return rewriteInPlace(path, func(src, dst string) error {
+		return pack.Repack(src, dst, opts)
+	})
+}
+
+// addDigestsToEncryptedFile embeds resource digests in the manifest of an encrypted Readium Package.
+func addDigestsToEncryptedFile(path string, digests map[string]string) error {
+	return rewriteInPlace(path, func(src, dst string) error {
+		return pack.AddResourceDigests(src, dst, digests)
+	})
+}
+
+// rewriteInPlace rewrites a file through a temp file, replacing the original once complete.
+func rewriteInPlace(path string, rewrite func(src, dst string) error) error {
+	tmpPath := path + ".tmp"
+	if err := rewrite(path, tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// protectionLevel returns the protection level of a publication from its resource report.
+// Only EPUB publications have a report: other formats are fully protected.
+func (a *APICtrl) protectionLevel(resources []pack.Resource) string {
+	if resources == nil {
+		return pack.ProtectionFull
+	}
+	fullRatio, sampleRatio := defaultFullProtectionRatio, defaultSampleProtectionRatio
+	if a.Config.Encrypt.FullProtectionRatio > 0 {
+		fullRatio = a.Config.Encrypt.FullProtectionRatio
+	}
+	if a.Config.Encrypt.SampleProtectionRatio > 0 {
+		sampleRatio = a.Config.Encrypt.SampleProtectionRatio
+	}
+	return pack.ProtectionLevel(resources, fullRatio, sampleRatio)
+}
+
+// entryTimestamp returns the modification time of the entries of an encrypted file:
+// the publication date found by the metadata pass, or a fixed RFC 3339 time.
+// Publications without date get the earliest time a zip entry can hold.
+func entryTimestamp(value string, info *meta.Info) (time.Time, error) {
+	if value == pack.EntryTimestampPublicationDate {
+		return info.Published, nil
+	}
+	return pack.ParseEntryTimestamp(value)
+}
+
+// optionalTime returns a pointer to t, or nil if t is zero.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// setTimestampsOfEncryptedFile sets the modification time of the entries of an encrypted file.
+func setTimestampsOfEncryptedFile(path string, modified time.Time) error {
+	return rewriteInPlace(path, func(src, dst string) error {
+		return pack.SetTimestamps(src, dst, modified)
+	})
+}
+
+// isReadiumPackage checks if a file is a Readium Package, from its extension.
+func isReadiumPackage(path string) bool {
+	switch filepath.Ext(path) {
+	case ".audiobook", ".divina", ".webpub", ".rpf":
+		return true
+	}
+	return false
+}
+
+// fileSizeAndChecksum returns the size and hex-encoded SHA-256 checksum of a file,
+// as computed by ProcessEncryption.
+func fileSizeAndChecksum(path string) (uint32, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	hasher := sha256.New()
+	n, err := io.Copy(hasher, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return uint32(n), hex.EncodeToString(hasher.Sum(nil)), nil
+}
@@ -52,6 +52,67 @@ const RENEW_DATE = ERROR_BASE_URL + "renew/date" // unused
 // Error types defined for this server
 const REVOKE_ERROR = ERROR_BASE_URL + "revoke"
 
+// Machine-readable error codes
+const (
+	CodeInvalidRequest = "invalid_request"
+	CodeRender         = "render_error"
+	CodeServer         = "server_error"
+	CodeUnavailable    = "unavailable"
+	CodeConflict       = "conflict"
+	CodeNotFound       = "not_found"
+	CodeRegister       = "register_error"
+	CodeRenew          = "renew_error"
+	CodeReturn         = "return_error"
+	CodeRevoke         = "revoke_error"
+	// errors of the encryption endpoints
+	CodePayloadTooLarge      = "payload_too_large"
+	CodeForbidden            = "forbidden"
+	CodeBusy                 = "server_busy"
+	CodeInvalidPublication   = "invalid_publication"
+	CodeValidation           = "validation_failed"
+	CodeValidatorUnavailable = "validator_unavailable"
+	CodeKeyMismatch          = "key_mismatch"
+	CodeSelfTest             = "self_test_failed"
+	CodeAuditUnavailable     = "audit_unavailable"
+	// errors of the dashboard authentication
+	CodeUnauthorized = "unauthorized"
+	CodeTokenExpired = "token_expired"
+)
+
+// ErrorCode describes an error the API can return.
+type ErrorCode struct {
+	Code   string `json:"code"`
+	Status int    `json:"status"` // typical http status code
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+}
+
+// errorCodes is the source of truth of the errors returned by the API,
+// used by the error renderers and listed by the error codes endpoint.
+var errorCodes = []ErrorCode{
+	{CodeInvalidRequest, 400, "about:blank", "Invalid request"},
+	{CodeRender, 422, "about:blank", "Error rendering response"},
+	{CodeServer, 500, SERVER_ERROR, "An unexpected error has occurred"},
+	{CodeUnavailable, 502, "about:blank", "Stored resource unavailable"},
+	{CodeConflict, 409, "about:blank", "Concurrent operation in progress"},
+	{CodeNotFound, 404, "about:blank", "Resource not found"},
+	{CodeRegister, 400, REGISTER_ERROR, "Error registering a device"},
+	{CodeRenew, 400, RENEW_ERROR, "Error extending a license"},
+	{CodeReturn, 400, RETURN_ERROR, "Error returning a license"},
+	{CodeRevoke, 400, REVOKE_ERROR, "Error revoking / cancelling a license"},
+	{CodePayloadTooLarge, 413, "about:blank", "Payload too large"},
+	{CodeForbidden, 403, "about:blank", "Operation not permitted for the account"},
+	{CodeBusy, 503, "about:blank", "Server busy, retry later"},
+	{CodeInvalidPublication, 422, "about:blank", "Invalid publication"},
+	{CodeValidation, 422, "about:blank", "Publication rejected by the validator"},
+	{CodeValidatorUnavailable, 502, "about:blank", "Validator unavailable"},
+	{CodeKeyMismatch, 409, "about:blank", "Content key mismatch"},
+	{CodeSelfTest, 500, SERVER_ERROR, "Self-test of the encrypted publication failed"},
+	{CodeAuditUnavailable, 503, "about:blank", "Audit log unavailable, retry later"},
+	{CodeUnauthorized, 401, "about:blank", "Authentication required"},
+	{CodeTokenExpired, 401, "about:blank", "Token expired"},
+}
+
 // Error response payloads & renderers
 
 // ErrResponse renderer type for handling all sorts of errors.
@@ -67,6 +128,7 @@ type ErrResponse struct {
 	Type  string `json:"type"`
 	Title string `json:"title"`
 	//optional
+	Code     string `json:"code,omitempty"`   // machine-readable error code
 	Detail   string `json:"detail,omitempty"` // application-level error message
 	Instance string `json:"instance,omitempty"`
 }
@@ -76,78 +138,111 @@ func (e *ErrResponse) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
-func ErrInvalidRequest(err error) render.Renderer {
-	return &ErrResponse{
-		Err:            err,
-		HTTPStatusCode: 400,
-		Type:           "about:blank",
-		Title:          "Invalid request",
-		Detail:         err.Error(),
+// newErrResponse returns the error response corresponding to an error code.
+func newErrResponse(code string, err error) *ErrResponse {
+	for _, ec := range errorCodes {
+		if ec.Code == code {
+			e := &ErrResponse{
+				Err:            err,
+				HTTPStatusCode: ec.Status,
+				Type:           ec.Type,
+				Title:          ec.Title,
+				Code:           ec.Code,
+			}
+			if err != nil {
+				e.Detail = err.Error()
+			}
+			return e
+		}
 	}
+	panic("unknown error code " + code)
+}
+
+func ErrInvalidRequest(err error) render.Renderer {
+	return newErrResponse(CodeInvalidRequest, err)
 }
 
 func ErrRender(err error) render.Renderer {
-	return &ErrResponse{
-		Err:            err,
-		HTTPStatusCode: 422,
-		Type:           "about:blank",
-		Title:          "Error rendering response",
-		Detail:         err.Error(),
-	}
+	return newErrResponse(CodeRender, err)
 }
 
 func ErrServer(err error) render.Renderer {
-	return &ErrResponse{
-		Err:            err,
-		HTTPStatusCode: 500,
-		Type:           SERVER_ERROR,
-		Title:          "An unexpected error has occurred",
-		Detail:         err.Error(),
-	}
+	return newErrResponse(CodeServer, err)
+}
+
+func ErrUnavailable(err error) render.Renderer {
+	return newErrResponse(CodeUnavailable, err)
 }
 
-var ErrNotFound = &ErrResponse{
-	HTTPStatusCode: 404,
-	Type:           "about:blank",
-	Title:          "Resource not found",
+func ErrConflict(err error) render.Renderer {
+	return newErrResponse(CodeConflict, err)
 }
 
+var ErrNotFound = newErrResponse(CodeNotFound, nil)
+
 func ErrRegister(err error) render.Renderer {
-	return &ErrResponse{
-		Err:            err,
-		HTTPStatusCode: 400,
-		Type:           REGISTER_ERROR,
-		Title:          "Error registering a device",
-		Detail:         err.Error(),
-	}
+	return newErrResponse(CodeRegister, err)
 }
 
 func ErrRenew(err error) render.Renderer {
-	return &ErrResponse{
-		Err:            err,
-		HTTPStatusCode: 400,
-		Type:           RENEW_ERROR,
-		Title:          "Error extending a license",
-		Detail:         err.Error(),
-	}
+	return newErrResponse(CodeRenew, err)
 }
 
 func ErrReturn(err error) render.Renderer {
-	return &ErrResponse{
-		Err:            err,
-		HTTPStatusCode: 400,
-		Type:           RETURN_ERROR,
-		Title:          "Error returning a license",
-		Detail:         err.Error(),
-	}
+	return newErrResponse(CodeReturn, err)
 }
 
 func ErrRevoke(err error) render.Renderer {
-	return &ErrResponse{
-		Err:            err,
-		HTTPStatusCode: 400,
-		Type:           REVOKE_ERROR,
-		Title:          "Error revoking / cancelling a license",
-		Detail:         err.Error(),
-	}
+	return newErrResponse(CodeRevoke, err)
+}
+
+func ErrPayloadTooLarge(err error) render.Renderer {
+	return newErrResponse(CodePayloadTooLarge, err)
+}
+
+func ErrForbidden(err error) render.Renderer {
+	return newErrResponse(CodeForbidden, err)
+}
+
+func ErrBusy(err error) render.Renderer {
+	return newErrResponse(CodeBusy, err)
+}
+
+func ErrInvalidPublication(err error) render.Renderer {
+	return newErrResponse(CodeInvalidPublication, err)
+}
+
+func ErrValidation(err error) render.Renderer {
+	return newErrResponse(CodeValidation, err)
+}
+
+func ErrValidatorUnavailable(err error) render.Renderer {
+	return newErrResponse(CodeValidatorUnavailable, err)
+}
+
+func ErrKeyMismatch(err error) render.Renderer {
+	return newErrResponse(CodeKeyMismatch, err)
+}
+
+func ErrSelfTest(err error) render.Renderer {
+	return newErrResponse(CodeSelfTest, err)
+}
+
+func ErrAuditUnavailable(err error) render.Renderer {
+	return newErrResponse(CodeAuditUnavailable, err)
+}
+
+func ErrUnauthorized(err error) render.Renderer {
+	return newErrResponse(CodeUnauthorized, err)
+}
+
+func ErrTokenExpired(err error) render.Renderer {
+	return newErrResponse(CodeTokenExpired, err)
+}
+
+// ListErrorCodes lists the errors the API can return.
+// The list is static, it can be cached by clients.
+func (a *APICtrl) ListErrorCodes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	render.JSON(w, r, errorCodes)
 }
@@ -0,0 +1,22 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package api
+
+import "expvar"
+
+// Server metrics, published as JSON by the expvar handler.
+var (
+	// bytes currently reserved for in-memory multipart form buffers
+	metricUploadMemoryBytes = expvar.NewInt("upload_memory_bytes")
+	// uploads rejected because of the global in-memory cap
+	metricUploadMemoryRejected = expvar.NewInt("upload_memory_rejected")
+	// encryption requests which were served or interrupted by the client, by outcome
+	metricEncryptOutcomes = expvar.NewMap("encrypt_outcomes")
+)
+
+// Outcomes of the encryption requests
+const (
+	outcomeSuccess          = "success"
+	outcomeClientDisconnect = "client_disconnect" // the client closed the connection before the end of the response
+	outcomeStreamError      = "stream_error"
+)
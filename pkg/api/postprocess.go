@@ -0,0 +1,76 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package api
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PostProcessor is a step applied in place to the working copy of a publication, before its
+// metadata pass and its encryption, e.g. the linearization of a PDF. A step must keep the
+// publication renderable; it should return an error rather than leave a partial rewrite.
+type PostProcessor func(ctx context.Context, path string) error
+
+// NoPostProcessor is a step which leaves the publication unchanged.
+func NoPostProcessor(context.Context, string) error { return nil }
+
+// CheckPostProcessing checks that the steps listed in the post_processing configuration are registered.
+func (a *APICtrl) CheckPostProcessing() error {
+	for format, steps := range a.Config.Encrypt.PostProcessing {
+		for _, name := range steps {
+			if _, ok := a.PostProcessors[name]; !ok {
+				return fmt.Errorf("post_processing of %s: unknown step %q", format, name)
+			}
+		}
+	}
+	return nil
+}
+
+// postProcess applies to the publication at path the steps configured for its format,
+// identified by its file extension, in order.
+func (a *APICtrl) postProcess(ctx context.Context, path string) error {
+	format := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	steps := a.Config.Encrypt.PostProcessing[format]
+	if len(steps) == 0 {
+		return nil
+	}
+	for _, name := range steps {
+		step, ok := a.PostProcessors[name]
+		if !ok {
+			return fmt.Errorf("unknown step %q", name)
+		}
+		if err := step(ctx, path); err != nil {
+			return fmt.Errorf("step %q: %w", name, err)
+		}
+	}
+	if err := checkProcessedFile(path); err != nil {
+		return fmt.Errorf("steps %s: %w", strings.Join(steps, ", "), err)
+	}
+	return nil
+}
+
+// checkProcessedFile checks that a publication is still readable after its post-processing:
+// not empty and, for packaged formats, still a zip container.
+func checkProcessedFile(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if fi.Size() == 0 {
+		return errors.New("the publication is empty")
+	}
+	if filepath.Ext(path) != ".epub" && !isReadiumPackage(path) {
+		return nil
+	}
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("the publication is no longer a valid container: %w", err)
+	}
+	return zr.Close()
+}
@@ -5,15 +5,25 @@
 package api
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
+	"github.com/edrlab/lcp-server/pkg/conf"
+	"github.com/edrlab/lcp-server/pkg/meta"
 	"github.com/edrlab/lcp-server/pkg/stor"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
+	"github.com/readium/readium-lcp-server/epub"
 )
 
 // ListPublications lists publications present in the database.
@@ -102,6 +112,12 @@ func (a *APICtrl) CreatePublication(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	unlock := a.lockUUID(w, r, publication.UUID)
+	if unlock == nil {
+		return
+	}
+	defer unlock()
+
 	// db create
 	err := a.Store.Publication().Create(publication)
 	if err != nil {
@@ -110,7 +126,7 @@ func (a *APICtrl) CreatePublication(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Debug("Create Publication ", publication.Title)
+	log.Debug("Create Publication ", a.redacted(conf.RedactTitle, publication.Title))
 
 	render.Status(r, http.StatusCreated)
 	if err := render.Render(w, r, NewPublicationResponse(publication)); err != nil {
@@ -187,6 +203,11 @@ func (a *APICtrl) UpdatePublication(w http.ResponseWriter, r *http.Request) {
 	// get the existing publication
 	if publicationID := chi.URLParam(r, "publicationID"); publicationID != "" {
 		log.Debugf("Update Publication: %s", publicationID)
+		unlock := a.lockUUID(w, r, publicationID)
+		if unlock == nil {
+			return
+		}
+		defer unlock()
 		publication, err = a.Store.Publication().Get(publicationID)
 	} else {
 		render.Render(w, r, ErrInvalidRequest(errors.New("missing required publication ID"))) // publicationID is nil
@@ -223,6 +244,96 @@ func (a *APICtrl) UpdatePublication(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// RefreshPublicationMetadata re-extracts the metadata of a stored EPUB publication
+// and updates the publication in the database.
+// The package document of an encrypted EPUB stays clear; the encrypted content and key are not modified.
+func (a *APICtrl) RefreshPublicationMetadata(w http.ResponseWriter, r *http.Request) {
+
+	var publication *stor.Publication
+	var err error
+
+	// get the existing publication
+	publicationID := chi.URLParam(r, "publicationID")
+	if publicationID == "" {
+		render.Render(w, r, ErrInvalidRequest(errors.New("missing required publication ID")))
+		return
+	}
+	log.Debugf("Refresh Publication Metadata: %s", publicationID)
+	publication, err = a.Store.Publication().Get(publicationID)
+	// if the publication has been soft-deleted, it is considered not found
+	if err != nil || publication.DeletedAt.Valid {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+	if publication.ContentType != epub.ContentType_EPUB {
+		render.Render(w, r, ErrInvalidRequest(errors.New("metadata can only be refreshed for EPUB publications")))
+		return
+	}
+
+	// fetch the stored publication, without holding the lock on the publication
+	maxBytes := int64(defaultMaxFetchBytes)
+	if a.Config.MaxFetchBytes > 0 {
+		maxBytes = a.Config.MaxFetchBytes
+	}
+	href := publication.Href
+	path, err := fetchPublication(r.Context(), href, a.tempFileMode(), maxBytes)
+	if err != nil {
+		logErr := err
+		var ue *url.Error
+		if slices.Contains(a.Config.LogRedact, conf.RedactIdentifiers) && errors.As(err, &ue) {
+			logErr = ue.Err // without the URL
+		}
+		log.Errorf("Refresh Publication Metadata: failed to fetch %s: %v", a.redacted(conf.RedactIdentifiers, href), logErr)
+		render.Render(w, r, ErrUnavailable(err))
+		return
+	}
+	defer os.Remove(path)
+
+	// the stored file is unusable, not the request
+	md, err := meta.ReadMetadata(path)
+	if err != nil {
+		log.Errorf("Refresh Publication Metadata: failed to read the metadata: %v", err)
+		render.Render(w, r, ErrUnavailable(fmt.Errorf("invalid stored publication: %w", err)))
+		return
+	}
+
+	// update the current record, which may have changed during the fetch
+	unlock := a.lockUUID(w, r, publicationID)
+	if unlock == nil {
+		return
+	}
+	defer unlock()
+	publication, err = a.Store.Publication().Get(publicationID)
+	if err != nil || publication.DeletedAt.Valid {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+	if publication.Href != href {
+		render.Render(w, r, ErrConflict(errors.New("the publication was moved during the refresh")))
+		return
+	}
+
+	// set updated fields, the title is required
+	if md.Title != "" {
+		publication.Title = md.Title
+	}
+	publication.Description = md.Description
+	publication.Authors = strings.Join(md.Authors, ", ")
+	publication.Publishers = strings.Join(md.Publishers, ", ")
+
+	// db update
+	err = a.Store.Publication().Update(publication)
+	if err != nil {
+		render.Render(w, r, ErrServer(err))
+		return
+	}
+
+	if err := render.Render(w, r, NewPublicationResponse(publication)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
 // DeletePublication removes an existing Publication from the database.
 func (a *APICtrl) DeletePublication(w http.ResponseWriter, r *http.Request) {
 
@@ -232,6 +343,11 @@ func (a *APICtrl) DeletePublication(w http.ResponseWriter, r *http.Request) {
 	// get the existing publication
 	if publicationID := chi.URLParam(r, "publicationID"); publicationID != "" {
 		log.Debugf("Delete Publication: %s", publicationID)
+		unlock := a.lockUUID(w, r, publicationID)
+		if unlock == nil {
+			return
+		}
+		defer unlock()
 		publication, err = a.Store.Publication().Get(publicationID)
 	} else {
 		render.Render(w, r, ErrInvalidRequest(errors.New("missing required publication ID"))) // publicationID is nil
@@ -256,6 +372,50 @@ func (a *APICtrl) DeletePublication(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// defaultMaxFetchBytes is the default size limit of the stored publications fetched by the server.
+const defaultMaxFetchBytes = 512 << 20
+
+// fetchPublication downloads a stored publication into a temp file with the given permissions,
+// and returns its path. Publications larger than maxBytes are rejected.
+func fetchPublication(ctx context.Context, href string, mode os.FileMode, maxBytes int64) (string, error) {
+	client := &http.Client{Timeout: 2 * time.Minute}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, href, nil)
+	if err != nil {
+		return "", err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d fetching the publication", res.StatusCode)
+	}
+	if res.ContentLength > maxBytes {
+		return "", fmt.Errorf("the publication exceeds %d bytes", maxBytes)
+	}
+
+	out, err := os.CreateTemp("", "lcp-refresh-*.epub")
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+	if err := out.Chmod(mode); err != nil {
+		os.Remove(out.Name())
+		return "", err
+	}
+	// one more byte tells a publication over the limit
+	n, err := io.Copy(out, io.LimitReader(res.Body, maxBytes+1))
+	if err == nil && n > maxBytes {
+		err = fmt.Errorf("the publication exceeds %d bytes", maxBytes)
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return "", err
+	}
+	return out.Name(), nil
+}
+
 // --
 // Request and Response payloads for the REST api.
 // --
@@ -0,0 +1,41 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strings"
+)
+
+// redacted returns the value of a field as it must appear in the logs: the value itself,
+// or a short hash of the value if the field is listed in the log_redact configuration.
+// The hash lets log lines relative to the same value be correlated.
+func (a *APICtrl) redacted(field, value string) string {
+	if !slices.Contains(a.Config.LogRedact, field) {
+		return value
+	}
+	sum := sha256.Sum256([]byte(value))
+	return "[redacted:" + hex.EncodeToString(sum[:4]) + "]"
+}
+
+// redactedError returns an error whose message is the message of err, with the value of a field
+// replaced by its redacted form if the field is listed in the log_redact configuration.
+// The returned error wraps err.
+func (a *APICtrl) redactedError(field, value string, err error) error {
+	if err == nil || value == "" || !slices.Contains(a.Config.LogRedact, field) {
+		return err
+	}
+	return &redactError{err: err, msg: strings.ReplaceAll(err.Error(), value, a.redacted(field, value))}
+}
+
+// redactError is an error with a redacted message.
+type redactError struct {
+	err error
+	msg string
+}
+
+func (e *redactError) Error() string { return e.msg }
+
+func (e *redactError) Unwrap() error { return e.err }
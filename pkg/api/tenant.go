@@ -0,0 +1,82 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/edrlab/lcp-server/pkg/conf"
+	"github.com/edrlab/lcp-server/pkg/keywrap"
+)
+
+// tenantMasterKey returns the master key of the authenticated dashboard account (the tenant),
+// used for wrapping the content keys it generates. In single-tenant mode, i.e. when no master
+// key is configured, it returns nil.
+func (a *APICtrl) tenantMasterKey(r *http.Request) ([]byte, error) {
+	keys := a.Config.Encrypt.TenantMasterKeys
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	// set by the authentication middleware
+	tenant := r.Header.Get("X-Username")
+	encoded, ok := keys[tenant]
+	if tenant == "" || !ok {
+		return nil, fmt.Errorf("no master key configured for account %q", tenant)
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid master key for account %q: %w", tenant, err)
+	}
+	switch len(key) {
+	case 16, 24, 32:
+		return key, nil
+	}
+	return nil, fmt.Errorf("invalid master key length for account %q", tenant)
+}
+
+// unwrapContentKey unwraps an escrowed content key, base64-encoded, with the master key of the tenant.
+// Only AES-256 content keys are accepted.
+func unwrapContentKey(masterKey []byte, encoded string) ([]byte, error) {
+	wrapped, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(wrapped) == 0 {
+		return nil, errors.New("missing or malformed wrapped content key")
+	}
+	key, err := keywrap.Unwrap(masterKey, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unwrap the content key: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid content key length %d", len(key))
+	}
+	return key, nil
+}
+
+// checkContentRating checks that the content rating of a publication, declared or set by the request,
+// is permitted for the authenticated dashboard account. Accounts without a list of permitted ratings,
+// and unrated publications, are not restricted; restricted accounts cannot override a declared rating
+// with another one. Ratings are compared without case.
+func (a *APICtrl) checkContentRating(r *http.Request, declared, rating string) error {
+	tenant := r.Header.Get("X-Username")
+	permitted, ok := a.Config.Encrypt.TenantContentRatings[tenant]
+	if !ok || rating == "" {
+		return nil
+	}
+	if declared != "" && !strings.EqualFold(declared, rating) {
+		return fmt.Errorf("content rating %q does not match the declared rating %q, overrides are not permitted for account %q", rating, declared, tenant)
+	}
+	if slices.ContainsFunc(permitted, func(p string) bool { return strings.EqualFold(p, rating) }) {
+		return nil
+	}
+	return fmt.Errorf("content rating %q is not permitted for account %q", rating, tenant)
+}
+
+// tenantDefaults returns the defaults configured for the authenticated dashboard account,
+// zero values if none.
+func (a *APICtrl) tenantDefaults(r *http.Request) conf.TenantDefaults {
+	return a.Config.Encrypt.TenantDefaults[r.Header.Get("X-Username")]
+}
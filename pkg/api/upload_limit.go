@@ -0,0 +1,43 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package api
+
+import "sync"
+
+// maxFormMemory is the per-request amount of a multipart form kept in memory,
+// the remainder being stored in temp files.
+const maxFormMemory = 50 << 20
+
+// memoryBudget accounts for the in-memory multipart form buffers across requests.
+type memoryBudget struct {
+	mu   sync.Mutex
+	used int64
+}
+
+// reserve reserves n bytes if the total stays within max; a max of 0 means no limit.
+func (b *memoryBudget) reserve(n, max int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if max > 0 && b.used+n > max {
+		return false
+	}
+	b.used += n
+	metricUploadMemoryBytes.Add(n)
+	return true
+}
+
+// release gives back n bytes previously reserved.
+func (b *memoryBudget) release(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used -= n
+	metricUploadMemoryBytes.Add(-n)
+}
+
+// formMemory returns the amount of memory a multipart form may use while parsed.
+func formMemory(contentLength int64) int64 {
+	if contentLength > 0 && contentLength < maxFormMemory {
+		return contentLength
+	}
+	return maxFormMemory
+}
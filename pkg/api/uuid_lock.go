@@ -0,0 +1,93 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/render"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultLockTimeout is used when no lock timeout is configured.
+const defaultLockTimeout = 10 * time.Second
+
+// uuidLocks serializes concurrent operations on the same UUID.
+type uuidLocks struct {
+	mu    sync.Mutex
+	locks map[string]*uuidLock
+}
+
+// uuidLock is a lock on a UUID, removed from the map when nobody holds or waits for it.
+type uuidLock struct {
+	sem  chan struct{}
+	refs int
+}
+
+func newUUIDLocks() *uuidLocks {
+	return &uuidLocks{locks: make(map[string]*uuidLock)}
+}
+
+// lock acquires the lock on id, waiting at most timeout or until ctx is done.
+// It returns a function releasing the lock.
+func (l *uuidLocks) lock(ctx context.Context, id string, timeout time.Duration) (func(), error) {
+	l.mu.Lock()
+	lk, ok := l.locks[id]
+	if !ok {
+		lk = &uuidLock{sem: make(chan struct{}, 1)}
+		l.locks[id] = lk
+	}
+	lk.refs++
+	l.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case lk.sem <- struct{}{}:
+		return func() {
+			<-lk.sem
+			l.unref(id, lk)
+		}, nil
+	case <-timer.C:
+		l.unref(id, lk)
+		return nil, fmt.Errorf("another operation is in progress on %s", id)
+	case <-ctx.Done():
+		l.unref(id, lk)
+		return nil, ctx.Err()
+	}
+}
+
+// unref releases a reference to a lock.
+func (l *uuidLocks) unref(id string, lk *uuidLock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lk.refs--
+	if lk.refs == 0 {
+		delete(l.locks, id)
+	}
+}
+
+// lockUUID serializes the operations on a UUID.
+// It renders a conflict error and returns nil if the lock cannot be acquired in time.
+func (a *APICtrl) lockUUID(w http.ResponseWriter, r *http.Request, id string) func() {
+	timeout := defaultLockTimeout
+	if a.Config.LockTimeoutMs > 0 {
+		timeout = time.Duration(a.Config.LockTimeoutMs) * time.Millisecond
+	}
+	unlock, err := a.locks.lock(r.Context(), id, timeout)
+	if err != nil {
+		log.Warnf("Unable to lock %s: %v", id, err)
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		render.Render(w, r, ErrConflict(err))
+		return nil
+	}
+	return unlock
+}
@@ -0,0 +1,152 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultValidatorTimeout bounds the runtime of the external validator if validator_timeout_ms is not set.
+const defaultValidatorTimeout = time.Minute
+
+// maxValidatorOutput is the size of the validator output returned to the client.
+const maxValidatorOutput = 64 << 10
+
+// validationError is the verdict of an external validator rejecting a publication.
+type validationError struct {
+	output string
+}
+
+func (e *validationError) Error() string {
+	return "validation failed: " + e.output
+}
+
+// validate submits the publication at path to the configured external validator, if any.
+// A rejection is returned as a *validationError carrying the output of the validator;
+// other errors mean that the validator could not give a verdict.
+func (a *APICtrl) validate(ctx context.Context, path string) error {
+	timeout := defaultValidatorTimeout
+	if a.Config.Encrypt.ValidatorTimeoutMs > 0 {
+		timeout = time.Duration(a.Config.Encrypt.ValidatorTimeoutMs) * time.Millisecond
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	switch {
+	case len(a.Config.Encrypt.ValidatorCommand) > 0:
+		return runValidatorCommand(ctx, a.Config.Encrypt.ValidatorSandbox, a.Config.Encrypt.ValidatorCommand, path, a.tempFileMode())
+	case a.Config.Encrypt.ValidatorURL != "":
+		return callValidatorService(ctx, a.Config.Encrypt.ValidatorURL, path)
+	}
+	return nil
+}
+
+// runValidatorCommand runs a validator command on a copy of the publication, alone in a temp directory,
+// the path of the copy appended to its arguments. The command is prefixed by the sandbox wrapper if any,
+// "{dir}" in the arguments of the wrapper being replaced by the directory of the copy.
+// The command is not run by a shell, in the directory of the copy, and only inherits PATH from the
+// environment of the server: the secrets of the configuration are not exposed to it.
+// A non-zero exit status is a rejection; the directory of the copy is removed from the output.
+func runValidatorCommand(ctx context.Context, sandbox, command []string, path string, mode os.FileMode) error {
+	dir, err := newWorkDir("lcp-validate-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, filepath.Base(path))
+	if err := copyFile(path, input, mode); err != nil {
+		return err
+	}
+
+	args := make([]string, 0, len(sandbox)+len(command)+1)
+	for _, arg := range sandbox {
+		args = append(args, strings.ReplaceAll(arg, "{dir}", dir))
+	}
+	args = append(append(args, command...), input)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH")}
+	// the output pipes are not waited for after the process is killed
+	cmd.WaitDelay = time.Second
+	var output bytes.Buffer
+	cmd.Stdout = &limitedBuffer{buf: &output, n: maxValidatorOutput}
+	cmd.Stderr = cmd.Stdout
+
+	err = cmd.Run()
+	if ctx.Err() != nil {
+		return fmt.Errorf("validator timed out: %w", ctx.Err())
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		// the paths of the server are not returned to the client
+		verdict := strings.ReplaceAll(output.String(), dir+string(filepath.Separator), "")
+		return &validationError{output: strings.TrimSpace(strings.ReplaceAll(verdict, dir, "."))}
+	}
+	return err
+}
+
+// copyFile copies the file at src to dst, created with the given mode.
+func copyFile(src, dst string, mode os.FileMode) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return saveMultipartFile(f, dst, mode)
+}
+
+// callValidatorService posts the publication to a validator service.
+// A 4xx status is a rejection; the response body is the output of the validator.
+func callValidatorService(ctx context.Context, url, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, f)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("X-Filename", filepath.Base(path))
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	output, err := io.ReadAll(io.LimitReader(res.Body, maxValidatorOutput))
+	if err != nil {
+		return err
+	}
+	switch {
+	case res.StatusCode >= 400 && res.StatusCode < 500:
+		return &validationError{output: strings.TrimSpace(string(output))}
+	case res.StatusCode >= 300:
+		return fmt.Errorf("unexpected status %d from the validator", res.StatusCode)
+	}
+	return nil
+}
+
+// limitedBuffer keeps the first n bytes written to it, and discards the rest.
+type limitedBuffer struct {
+	buf *bytes.Buffer
+	n   int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.n - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
@@ -5,6 +5,10 @@
 package conf
 
 import (
+	"compress/flate"
+	"encoding/base64"
+	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -13,20 +17,41 @@ import (
 
 	"github.com/kelseyhightower/envconfig"
 	"gopkg.in/yaml.v2"
+
+	"github.com/edrlab/lcp-server/pkg/meta"
+	"github.com/edrlab/lcp-server/pkg/pack"
+)
+
+// Fields which can be redacted from the logs
+const (
+	RedactTitle       = "title"
+	RedactFilename    = "filename"
+	RedactIdentifiers = "identifiers" // URLs of the stored publications, which often embed an ISBN
+)
+
+// Handling of the failures of the audit sink
+const (
+	AuditBestEffort = "best_effort" // the failure is logged, the operation completes
+	AuditFailClosed = "fail_closed" // the operation is aborted with a 503 error
 )
 
 // LCP Server configuration
 type Config struct {
-	LogLevel      string `yaml:"log_level" envconfig:"loglevel"` // "debug", "info", "warn", "error"
-	PublicBaseUrl string `yaml:"public_base_url" envconfig:"publicbaseurl"`
-	Port          int    `yaml:"port"`
-	Dsn           string `yaml:"dsn"`
+	LogLevel      string   `yaml:"log_level" envconfig:"loglevel"` // "debug", "info", "warn", "error"
+	PublicBaseUrl string   `yaml:"public_base_url" envconfig:"publicbaseurl"`
+	Port          int      `yaml:"port"`
+	Dsn           string   `yaml:"dsn"`
+	LockTimeoutMs int      `yaml:"lock_timeout_ms" envconfig:"locktimeoutms"` // max wait for concurrent operations on the same UUID
+	LogRedact     []string `yaml:"log_redact" envconfig:"logredact"`          // fields hashed in the logs: "title", "filename", "identifiers"
+	MaxFetchBytes int64    `yaml:"max_fetch_bytes" envconfig:"maxfetchbytes"` // size limit of the stored publications fetched by the server
+	AuditMode     string   `yaml:"audit_mode" envconfig:"auditmode"`          // handling of audit write failures: "best_effort" (default) or "fail_closed"
 	Access        `yaml:"access"`
 	Certificate   `yaml:"certificate"`
 	License       `yaml:"license"`
 	Status        `yaml:"status"`
 	Dashboard     `yaml:"dashboard"`
 	JWT           `yaml:"jwt"`
+	Encrypt       `yaml:"encrypt"`
 	Resources     string `yaml:"resources"`
 }
 
@@ -36,8 +61,10 @@ type Access struct {
 }
 
 type Certificate struct {
-	Cert       string `yaml:"cert" envconfig:"certificate_cert"`              // Path
-	PrivateKey string `yaml:"private_key" envconfig:"certificate_privatekey"` // Path
+	Cert              string `yaml:"cert" envconfig:"certificate_cert"`                             // Path
+	PrivateKey        string `yaml:"private_key" envconfig:"certificate_privatekey"`                // Path
+	ExpiryWarningDays int    `yaml:"expiry_warning_days" envconfig:"certificate_expirywarningdays"` // warnings are logged this many days before the expiry, 30 if not set
+	AllowExpired      bool   `yaml:"allow_expired" envconfig:"certificate_allowexpired"`            // starts the server even if the certificate has expired
 }
 
 type License struct {
@@ -64,9 +91,48 @@ type JWT struct {
 	Admin     map[string]string `yaml:"admin" envconfig:"jwt_admin"` // list of admin usernames and passwords
 }
 
+type Encrypt struct {
+	CompressionLevel      int                       `yaml:"compression_level" envconfig:"encrypt_compressionlevel"`              // 0 (store only) to 9 (best), -1 keeps the packager default
+	MaxTotalInMemoryBytes int64                     `yaml:"max_total_in_memory_bytes" envconfig:"encrypt_maxtotalinmemorybytes"` // 0 means no limit
+	TempFileMode          os.FileMode               `yaml:"temp_file_mode" envconfig:"encrypt_tempfilemode"`                     // permissions of temp files, 0600 if not set
+	ClearPolicy           string                    `yaml:"clear_policy" envconfig:"encrypt_clearpolicy"`                        // EPUB resources left in clear: "preview" (default) or "required"
+	TenantMasterKeys      map[string]string         `yaml:"tenant_master_keys" envconfig:"encrypt_tenantmasterkeys"`             // dashboard account -> base64 AES key
+	WordsPerMinute        int                       `yaml:"words_per_minute" envconfig:"encrypt_wordsperminute"`                 // reading speed used for estimating reading times
+	MaxSummaryLength      int                       `yaml:"max_summary_length" envconfig:"encrypt_maxsummarylength"`             // max length of the accessibility summaries, in characters, 2000 if not set
+	EntryTimestamp        string                    `yaml:"entry_timestamp" envconfig:"encrypt_entrytimestamp"`                  // modification time of the output entries: "publication_date" or RFC 3339; left to the packager if not set
+	FullProtectionRatio   float64                   `yaml:"full_protection_ratio" envconfig:"encrypt_fullprotectionratio"`       // min ratio of encrypted resources of a fully protected EPUB, 0.8 if not set
+	SampleProtectionRatio float64                   `yaml:"sample_protection_ratio" envconfig:"encrypt_sampleprotectionratio"`   // max ratio of encrypted resources of a sample, 0.2 if not set
+	MaxBase64BodyBytes    int64                     `yaml:"max_base64_body_bytes" envconfig:"encrypt_maxbase64bodybytes"`        // size limit of base64 encryption payloads, 64 MB if not set
+	FontObfuscation       string                    `yaml:"font_obfuscation" envconfig:"encrypt_fontobfuscation"`                // fonts obfuscated in the source EPUB: "preserve" (default), "strip" or "encrypt"
+	NormalizeIdentifiers  bool                      `yaml:"normalize_identifiers" envconfig:"encrypt_normalizeidentifiers"`      // returns the canonical form of ISBN and DOI identifiers
+	NormalizeMediaTypes   bool                      `yaml:"normalize_media_types" envconfig:"encrypt_normalizemediatypes"`       // replaces the nonstandard media types of EPUB manifests by canonical ones
+	TenantContentRatings  map[string][]string       `yaml:"tenant_content_ratings" envconfig:"encrypt_tenantcontentratings"`     // dashboard account -> permitted content ratings
+	RequireContent        bool                      `yaml:"require_content" envconfig:"encrypt_requirecontent"`                  // rejects EPUBs whose spine documents have no text nor media
+	MinEncryptSize        int64                     `yaml:"min_encrypt_size" envconfig:"encrypt_minencryptsize"`                 // EPUB resources under this size (bytes) are left in clear, except spine documents
+	ChecksumOf            string                    `yaml:"checksum_of" envconfig:"encrypt_checksumof"`                          // subject of the checksum of the encrypt metadata: "encrypted" (default) or "source"
+	CoverOrder            []string                  `yaml:"cover_order" envconfig:"encrypt_coverorder"`                          // order of preference of the cover sources of EPUBs: "cover-image", "meta", "guide", "first-image"
+	TenantDefaults        map[string]TenantDefaults `yaml:"tenant_defaults" ignored:"true"`                                      // dashboard account -> branding defaults, configuration file only
+	PostProcessing        map[string][]string       `yaml:"post_processing" ignored:"true"`                                      // format (file extension) -> post-processing steps applied before the encryption, configuration file only
+	DeclareTranscripts    bool                      `yaml:"declare_transcripts" envconfig:"encrypt_declaretranscripts"`          // declares the WebVTT transcripts of audiobooks in their manifest
+	ValidatorCommand      []string                  `yaml:"validator_command" envconfig:"encrypt_validatorcommand"`              // external validator run on uploads, the path of the upload appended to its arguments
+	ValidatorSandbox      []string                  `yaml:"validator_sandbox" envconfig:"encrypt_validatorsandbox"`              // command prefix the validator command is run with, e.g. bwrap or nsjail; "{dir}" is the directory of the upload
+	ValidatorURL          string                    `yaml:"validator_url" envconfig:"encrypt_validatorurl"`                      // external validator service the uploads are posted to
+	ValidatorTimeoutMs    int                       `yaml:"validator_timeout_ms" envconfig:"encrypt_validatortimeoutms"`         // max runtime of the validator, 60000 if not set
+}
+
+// TenantDefaults are the defaults applied to the publications encrypted by a dashboard account,
+// e.g. a white-label storefront, when the request does not override them.
+type TenantDefaults struct {
+	Provider    string `yaml:"provider"`     // URL identifying the publication provider
+	TitlePrefix string `yaml:"title_prefix"` // added before the title read from the publication
+	TitleSuffix string `yaml:"title_suffix"` // added after the title read from the publication
+}
+
 func Init(configFile string) (*Config, error) {
 
 	var c Config
+	// 0 is a valid compression level, the default must be set before parsing
+	c.Encrypt.CompressionLevel = -1
 
 	if configFile != "" {
 		f, _ := filepath.Abs(configFile)
@@ -191,6 +257,84 @@ func Init(configFile string) (*Config, error) {
 		log.Println("⚠️  No dashboard account configured, using default account: admin/supersecret")
 	}
 
+	// Check the fields redacted from the logs
+	for _, field := range c.LogRedact {
+		switch field {
+		case RedactTitle, RedactFilename, RedactIdentifiers:
+		default:
+			return nil, fmt.Errorf("log_redact: unknown field %q", field)
+		}
+	}
+
+	switch c.AuditMode {
+	case "", AuditBestEffort, AuditFailClosed:
+	default:
+		return nil, fmt.Errorf("audit_mode: unknown value %q", c.AuditMode)
+	}
+
+	switch c.Encrypt.ChecksumOf {
+	case "", "encrypted", "source":
+	default:
+		return nil, fmt.Errorf("checksum_of: unknown value %q", c.Encrypt.ChecksumOf)
+	}
+
+	if c.Encrypt.CompressionLevel < pack.DefaultCompression || c.Encrypt.CompressionLevel > flate.BestCompression {
+		return nil, fmt.Errorf("compression_level: %d is not between 0 and 9", c.Encrypt.CompressionLevel)
+	}
+	if _, err := pack.ParseClearPolicy(c.Encrypt.ClearPolicy); err != nil {
+		return nil, fmt.Errorf("clear_policy: %w", err)
+	}
+	if _, err := pack.ParseFontPolicy(c.Encrypt.FontObfuscation); err != nil {
+		return nil, fmt.Errorf("font_obfuscation: %w", err)
+	}
+	if _, err := meta.ParseCoverOrder(c.Encrypt.CoverOrder); err != nil {
+		return nil, fmt.Errorf("cover_order: %w", err)
+	}
+	if c.Encrypt.EntryTimestamp != "" {
+		if _, err := pack.ParseEntryTimestamp(c.Encrypt.EntryTimestamp); err != nil {
+			return nil, fmt.Errorf("entry_timestamp: %w", err)
+		}
+	}
+
+	// Check the external validator
+	if len(c.Encrypt.ValidatorCommand) > 0 && c.Encrypt.ValidatorURL != "" {
+		return nil, fmt.Errorf("validator_command and validator_url are exclusive")
+	}
+	if len(c.Encrypt.ValidatorSandbox) > 0 && len(c.Encrypt.ValidatorCommand) == 0 {
+		return nil, fmt.Errorf("validator_sandbox requires validator_command")
+	}
+	if c.Encrypt.ValidatorURL != "" {
+		if u, err := url.Parse(c.Encrypt.ValidatorURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("validator_url: invalid URL %q", c.Encrypt.ValidatorURL)
+		}
+	}
+
+	// Check the tenant defaults
+	for tenant, d := range c.Encrypt.TenantDefaults {
+		if _, ok := c.JWT.Admin[tenant]; !ok {
+			return nil, fmt.Errorf("tenant defaults of %q: no such dashboard account", tenant)
+		}
+		if d.Provider != "" {
+			if u, err := url.Parse(d.Provider); err != nil || u.Scheme == "" || u.Host == "" {
+				return nil, fmt.Errorf("tenant defaults of %q: invalid provider URL %q", tenant, d.Provider)
+			}
+		}
+	}
+
+	// Check the master keys of the tenants; the keys themselves are not logged
+	for tenant, encoded := range c.Encrypt.TenantMasterKeys {
+		if _, ok := c.JWT.Admin[tenant]; !ok {
+			return nil, fmt.Errorf("tenant master key of %q: no such dashboard account", tenant)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("tenant master key of %q: invalid base64 value", tenant)
+		}
+		if l := len(key); l != 16 && l != 24 && l != 32 {
+			return nil, fmt.Errorf("tenant master key of %q: %d bytes, expected 16, 24 or 32", tenant, l)
+		}
+	}
+
 	// Log configured dashboard accounts (without passwords for security)
 	log.Printf("📋 Configured dashboard accounts: %d", len(c.JWT.Admin))
 	for name := range c.JWT.Admin {
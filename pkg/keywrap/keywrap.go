@@ -0,0 +1,80 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+// Package keywrap implements the AES key wrap algorithm (RFC 3394), used for protecting
+// content keys with a master key.
+package keywrap
+
+import (
+	"crypto/aes"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+)
+
+// defaultIV is the initial value defined by RFC 3394, section 2.2.3.1
+var defaultIV = []byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6}
+
+// ErrUnwrap is returned when a wrapped key fails the integrity check,
+// e.g. because it has been wrapped with another key.
+var ErrUnwrap = errors.New("keywrap: integrity check failed")
+
+// Wrap wraps a key with a key encryption key (AES-128, 192 or 256).
+// The key length must be a multiple of 8 bytes, at least 16 bytes.
+func Wrap(kek, key []byte) ([]byte, error) {
+	if len(key)%8 != 0 || len(key) < 16 {
+		return nil, errors.New("keywrap: invalid key length")
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	n := len(key) / 8
+	out := make([]byte, 8+len(key))
+	copy(out[8:], key)
+	a := make([]byte, 8)
+	copy(a, defaultIV)
+	b := make([]byte, 16)
+	for j := 0; j < 6; j++ {
+		for i := 1; i <= n; i++ {
+			copy(b, a)
+			copy(b[8:], out[i*8:i*8+8])
+			block.Encrypt(b, b)
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(a, binary.BigEndian.Uint64(b[:8])^t)
+			copy(out[i*8:], b[8:])
+		}
+	}
+	copy(out, a)
+	return out, nil
+}
+
+// Unwrap unwraps a key wrapped with the key encryption key.
+func Unwrap(kek, wrapped []byte) ([]byte, error) {
+	if len(wrapped)%8 != 0 || len(wrapped) < 24 {
+		return nil, errors.New("keywrap: invalid wrapped key length")
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	n := len(wrapped)/8 - 1
+	out := make([]byte, len(wrapped)-8)
+	copy(out, wrapped[8:])
+	a := make([]byte, 8)
+	copy(a, wrapped[:8])
+	b := make([]byte, 16)
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(b, binary.BigEndian.Uint64(a)^t)
+			copy(b[8:], out[(i-1)*8:i*8])
+			block.Decrypt(b, b)
+			copy(a, b[:8])
+			copy(out[(i-1)*8:], b[8:])
+		}
+	}
+	if subtle.ConstantTimeCompare(a, defaultIV) != 1 {
+		return nil, ErrUnwrap
+	}
+	return out, nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package keywrap
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// test vectors from RFC 3394, section 4
+func TestWrapVectors(t *testing.T) {
+	cases := []struct{ kek, key, wrapped string }{
+		{"000102030405060708090A0B0C0D0E0F", "00112233445566778899AABBCCDDEEFF",
+			"1FA68B0A8112B447AEF34BD8FB5A7B829D3E862371D2CFE5"},
+		{"000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F", "00112233445566778899AABBCCDDEEFF",
+			"64E8C3F9CE0F5BA263E9777905818A2A93C8191E7D6E8AE7"},
+		{"000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F", "00112233445566778899AABBCCDDEEFF000102030405060708090A0B0C0D0E0F",
+			"28C9F404C4B810F4CBCCB35CFB87F8263F5786E2D80ED326CBC7F0E71A99F43BFB988B9B7A02DD21"},
+	}
+	for _, c := range cases {
+		wrapped, err := Wrap(unhex(c.kek), unhex(c.key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(wrapped, unhex(c.wrapped)) {
+			t.Errorf("Wrap: expected %s, got %X", c.wrapped, wrapped)
+		}
+		key, err := Unwrap(unhex(c.kek), wrapped)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(key, unhex(c.key)) {
+			t.Errorf("Unwrap: expected %s, got %X", c.key, key)
+		}
+	}
+}
+
+func TestUnwrapWithAnotherKey(t *testing.T) {
+	wrapped, err := Wrap(bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Unwrap(bytes.Repeat([]byte{3}, 32), wrapped); !errors.Is(err, ErrUnwrap) {
+		t.Errorf("Expected an integrity error, got %v", err)
+	}
+}
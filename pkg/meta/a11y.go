@@ -0,0 +1,99 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import (
+	"slices"
+	"strings"
+)
+
+const (
+	conformsToProperty = "dcterms:conformsTo"
+	summaryProperty    = "schema:accessibilitySummary"
+)
+
+// DefaultMaxSummaryLength is the default maximum length of an accessibility summary, in characters.
+const DefaultMaxSummaryLength = 2000
+
+// EPUB Accessibility 1.0 declares its conformance as a link to the specification,
+// identified here without its scheme.
+var a11yConformanceLinks = map[string]string{
+	"www.idpf.org/epub/a11y/accessibility-20170105.html#wcag-a":   "EPUB Accessibility 1.0 - WCAG 2.0 Level A",
+	"www.idpf.org/epub/a11y/accessibility-20170105.html#wcag-aa":  "EPUB Accessibility 1.0 - WCAG 2.0 Level AA",
+	"www.idpf.org/epub/a11y/accessibility-20170105.html#wcag-aaa": "EPUB Accessibility 1.0 - WCAG 2.0 Level AAA",
+}
+
+// accessibilityConformance returns the EPUB Accessibility conformance level declared
+// by the publication, e.g. "EPUB Accessibility 1.1 - WCAG 2.1 Level AA", or an empty string.
+func (ep *epubFile) accessibilityConformance() string {
+	m := ep.pkg.Metadata
+
+	// EPUB 3 meta property, or EPUB 2 meta name / content
+	for _, mt := range m.Metas {
+		if mt.Property == conformsToProperty && mt.Refines == "" {
+			if v := strings.TrimSpace(mt.Value); v != "" {
+				return v
+			}
+		}
+		if mt.Name == conformsToProperty {
+			if v := strings.TrimSpace(mt.Content); v != "" {
+				return v
+			}
+		}
+	}
+	// EPUB Accessibility 1.0 link
+	for _, l := range m.Links {
+		if !slices.Contains(strings.Fields(l.Rel), conformsToProperty) {
+			continue
+		}
+		href := strings.TrimSpace(l.Href)
+		key := strings.TrimPrefix(strings.TrimPrefix(href, "http://"), "https://")
+		if level, ok := a11yConformanceLinks[key]; ok {
+			return level
+		}
+		if href != "" {
+			return href
+		}
+	}
+	// conformsTo element
+	if values := trimAll(m.ConformsTo); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// accessibilitySummaries returns the accessibility summary declared by the publication, verbatim,
+// and its variants keyed by language, for the summaries declaring their language. Summaries longer
+// than maxLength characters are truncated, and truncated is then set.
+func (ep *epubFile) accessibilitySummaries(maxLength int) (summary string, variants map[string]string, truncated bool) {
+	for _, mt := range ep.pkg.Metadata.Metas {
+		var value string
+		switch {
+		case mt.Property == summaryProperty && mt.Refines == "":
+			value = mt.Value
+		case mt.Name == summaryProperty:
+			value = mt.Content
+		}
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if runes := []rune(value); len(runes) > maxLength {
+			value, truncated = string(runes[:maxLength]), true
+		}
+		if summary == "" {
+			summary = value
+		}
+		if mt.Lang == "" {
+			continue
+		}
+		if variants == nil {
+			variants = make(map[string]string)
+		}
+		// the first summary of a language wins
+		if _, ok := variants[mt.Lang]; !ok {
+			variants[mt.Lang] = value
+		}
+	}
+	return summary, variants, truncated
+}
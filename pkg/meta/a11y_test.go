@@ -0,0 +1,103 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import (
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/edrlab/lcp-server/pkg/test"
+)
+
+// a11yOPF returns a package document with the given accessibility metadata.
+func a11yOPF(metadata string) string {
+	return test.OPF(`<dc:title>Accessible</dc:title>
+		`+metadata,
+		`<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>`,
+		`<spine><itemref idref="nav"/></spine>`)
+}
+
+func TestAccessibilityConformance(t *testing.T) {
+	cases := []struct {
+		name     string
+		metadata string
+		expected string
+	}{
+		{"none", ``, ""},
+		{"epub3 meta", `<meta property="dcterms:conformsTo"> EPUB Accessibility 1.1 - WCAG 2.1 Level AA </meta>`,
+			"EPUB Accessibility 1.1 - WCAG 2.1 Level AA"},
+		{"refined meta", `<meta property="dcterms:conformsTo" refines="#nav">EPUB Accessibility 1.1 - WCAG 2.1 Level A</meta>`, ""},
+		{"epub2 meta", `<meta name="dcterms:conformsTo" content="EPUB Accessibility 1.1 - WCAG 2.2 Level AAA"/>`,
+			"EPUB Accessibility 1.1 - WCAG 2.2 Level AAA"},
+		{"a11y 1.0 link", `<link rel="dcterms:conformsTo" href="http://www.idpf.org/epub/a11y/accessibility-20170105.html#wcag-aa"/>`,
+			"EPUB Accessibility 1.0 - WCAG 2.0 Level AA"},
+		{"unknown link", `<link rel="dcterms:conformsTo" href="https://example.com/profile"/>`,
+			"https://example.com/profile"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			info := inspectFiles(t, map[string]string{
+				"OEBPS/content.opf": a11yOPF(c.metadata),
+				"OEBPS/nav.xhtml":   `<html><body><nav></nav></body></html>`,
+			})
+			if info.AccessibilityConformance != c.expected {
+				t.Errorf("Expected %q, got %q", c.expected, info.AccessibilityConformance)
+			}
+		})
+	}
+}
+
+func TestAccessibilitySummary(t *testing.T) {
+	long := strings.Repeat("é", DefaultMaxSummaryLength+10)
+	cases := []struct {
+		name      string
+		metadata  string
+		summary   string
+		variants  map[string]string
+		truncated bool
+	}{
+		{"none", ``, "", nil, false},
+		{"epub3 meta", `<meta property="schema:accessibilitySummary">
+			This publication  meets WCAG 2.1 AA. </meta>`, "This publication  meets WCAG 2.1 AA.", nil, false},
+		{"epub2 meta", `<meta name="schema:accessibilitySummary" content="No known hazards."/>`, "No known hazards.", nil, false},
+		{"languages", `<meta property="schema:accessibilitySummary" xml:lang="en">Fully accessible.</meta>
+			<meta property="schema:accessibilitySummary" xml:lang="fr">Entièrement accessible.</meta>
+			<meta property="schema:accessibilitySummary" xml:lang="fr">Ignored.</meta>`,
+			"Fully accessible.", map[string]string{"en": "Fully accessible.", "fr": "Entièrement accessible."}, false},
+		{"refined meta", `<meta property="schema:accessibilitySummary" refines="#nav">Not the publication.</meta>`, "", nil, false},
+		{"too long", `<meta property="schema:accessibilitySummary">` + long + `</meta>`, long[:2*DefaultMaxSummaryLength], nil, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			info := inspectFiles(t, map[string]string{
+				"OEBPS/content.opf": a11yOPF(c.metadata),
+				"OEBPS/nav.xhtml":   `<html><body><nav></nav></body></html>`,
+			})
+			if info.AccessibilitySummary != c.summary || !maps.Equal(info.AccessibilitySummaries, c.variants) {
+				t.Errorf("Expected %q %q, got %q %q", c.summary, c.variants, info.AccessibilitySummary, info.AccessibilitySummaries)
+			}
+			truncated := slices.ContainsFunc(info.Warnings, func(w string) bool { return strings.Contains(w, "truncated") })
+			if truncated != c.truncated {
+				t.Errorf("Unexpected warnings %q", info.Warnings)
+			}
+		})
+	}
+}
+
+func TestAccessibilitySummaryMaxLength(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.epub")
+	test.WriteEPUB(t, path, map[string]string{
+		"OEBPS/content.opf": a11yOPF(`<meta property="schema:accessibilitySummary">Fully accessible.</meta>`),
+		"OEBPS/nav.xhtml":   `<html><body><nav></nav></body></html>`,
+	})
+	info, err := Inspect(path, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.AccessibilitySummary != "Fully" || !slices.Contains(info.Warnings, "accessibility summary truncated to 5 characters") {
+		t.Errorf("Expected a summary truncated to 5 characters, got %q (%q)", info.AccessibilitySummary, info.Warnings)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+
+	"golang.org/x/net/html"
+)
+
+// Elements which give content to a document without text, e.g. the pages of a comic
+var mediaElements = map[string]bool{
+	"img": true, "image": true, "svg": true, "video": true, "audio": true,
+	"object": true, "embed": true, "canvas": true, "iframe": true,
+}
+
+// Errors returned by CheckContent
+var (
+	ErrEmptySpine     = errors.New("the spine is empty")
+	ErrNoDocument     = errors.New("the spine references no content document")
+	ErrEmptyDocuments = errors.New("the documents of the spine have no content")
+)
+
+// CheckContent checks that the EPUB at path has content: at least one document of its spine
+// has text, or embeds an image or another media. Other formats are not checked.
+func CheckContent(path string) error {
+	if filepath.Ext(path) != ".epub" {
+		return nil
+	}
+	ep, err := openEPUB(path)
+	if err != nil {
+		return err
+	}
+	defer ep.Close()
+
+	if len(ep.pkg.Spine.Itemrefs) == 0 {
+		return ErrEmptySpine
+	}
+	documents := 0
+	for _, itemref := range ep.pkg.Spine.Itemrefs {
+		item, ok := ep.item(itemref.IDRef)
+		if !ok {
+			continue
+		}
+		switch item.MediaType {
+		case "application/xhtml+xml", "text/html", "image/svg+xml":
+		default:
+			continue
+		}
+		data, err := ep.read(ep.itemPath(item))
+		if err != nil {
+			continue
+		}
+		documents++
+		if hasContent(data) {
+			return nil
+		}
+	}
+	if documents == 0 {
+		return ErrNoDocument
+	}
+	return ErrEmptyDocuments
+}
+
+// hasContent checks if an (X)HTML or SVG document has text or media. The text of
+// the head and of scripts and styles does not count.
+func hasContent(data []byte) bool {
+	inHead, skip := false, 0
+	z := html.NewTokenizer(bytes.NewReader(data))
+	for {
+		switch tt := z.Next(); tt {
+		case html.ErrorToken:
+			return false
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			selfClosing := tt == html.SelfClosingTagToken
+			switch string(name) {
+			case "head":
+				inHead = !selfClosing
+			case "script", "style", "title":
+				if !selfClosing {
+					skip++
+				}
+			default:
+				if !inHead && mediaElements[string(name)] {
+					return true
+				}
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "head":
+				inHead = false
+			case "script", "style", "title":
+				if skip > 0 {
+					skip--
+				}
+			}
+		case html.TextToken:
+			if !inHead && skip == 0 && textWordCount(z.Text()) > 0 {
+				return true
+			}
+		}
+	}
+}
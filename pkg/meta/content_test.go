@@ -0,0 +1,47 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/edrlab/lcp-server/pkg/test"
+)
+
+func TestCheckContent(t *testing.T) {
+	chapter := `<item id="ch1" href="chapter1.xhtml" media-type="application/xhtml+xml"/>`
+	spine := `<spine><itemref idref="ch1"/></spine>`
+	cases := []struct {
+		name     string
+		manifest string
+		spine    string
+		chapter  string
+		err      error
+	}{
+		{"text", chapter, spine, `<html><body><p>Once upon a time</p></body></html>`, nil},
+		{"image", chapter, spine, `<html><body><div><img src="page1.jpg"/></div></body></html>`, nil},
+		{"empty spine", chapter, `<spine/>`, `<html><body><p>Not in the spine</p></body></html>`, ErrEmptySpine},
+		{"no document", `<item id="ch1" href="chapter1.xhtml" media-type="text/plain"/>`, spine, `Text`, ErrNoDocument},
+		{"missing document", chapter, spine, "", ErrNoDocument},
+		{"empty body", chapter, spine, `<html><head><title>Title</title><style>p {}</style></head><body> <p/> </body></html>`, ErrEmptyDocuments},
+		{"script only", chapter, spine, `<html><body><script>document.write("text")</script></body></html>`, ErrEmptyDocuments},
+	}
+	for _, c := range cases {
+		files := map[string]string{"OEBPS/content.opf": test.OPF(`<dc:title>Content</dc:title>`, c.manifest, c.spine)}
+		if c.chapter != "" {
+			files["OEBPS/chapter1.xhtml"] = c.chapter
+		}
+		path := filepath.Join(t.TempDir(), "test.epub")
+		test.WriteEPUB(t, path, files)
+		if err := CheckContent(path); !errors.Is(err, c.err) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.err, err)
+		}
+	}
+
+	// other formats are not checked
+	if err := CheckContent("test.pdf"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
@@ -0,0 +1,322 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import (
+	"archive/zip"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/gif" // decoders of the cover formats
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// DefaultPaletteSize is the number of colors of a cover palette.
+const DefaultPaletteSize = 5
+
+// Bounds of the processing of a cover image
+const (
+	maxCoverPixels  = 50_000_000 // larger images are not decoded
+	maxCoverSamples = 64         // pixels sampled per row and column
+)
+
+// CoverColors are the dominant color and the palette of a cover image, as "#rrggbb" values.
+type CoverColors struct {
+	Color   string
+	Palette []string // most frequent colors first, starting with the dominant color
+}
+
+// Sources of the cover image of an EPUB, which may disagree
+const (
+	CoverSourceProperty   = "cover-image" // manifest item with the cover-image property (EPUB 3)
+	CoverSourceMeta       = "meta"        // manifest item referenced by a meta element named cover (EPUB 2)
+	CoverSourceGuide      = "guide"       // guide reference of type cover, or the first image of the page it references
+	CoverSourceFirstImage = "first-image" // first image of the manifest
+	// the cover of a Readium Package is the link of its manifest with a "cover" relation
+	CoverSourceManifest = "manifest"
+)
+
+// DefaultCoverOrder is the default order of preference of the sources of an EPUB cover.
+var DefaultCoverOrder = []string{CoverSourceProperty, CoverSourceMeta, CoverSourceGuide, CoverSourceFirstImage}
+
+// Cover is the cover image chosen for a publication.
+type Cover struct {
+	Path   string `json:"path"`
+	Source string `json:"source"`
+	// Conflicts are the other images declared as the cover, if the declarations disagree
+	Conflicts []string `json:"conflicts,omitempty"`
+}
+
+// ParseCoverOrder checks an order of preference of the cover sources. An empty order gives DefaultCoverOrder.
+func ParseCoverOrder(order []string) ([]string, error) {
+	if len(order) == 0 {
+		return DefaultCoverOrder, nil
+	}
+	for _, source := range order {
+		if !slices.Contains(DefaultCoverOrder, source) {
+			return nil, fmt.Errorf("unknown cover source %q", source)
+		}
+	}
+	return order, nil
+}
+
+// FindCover chooses the cover image of the publication at path: for an EPUB, the first candidate
+// found in order (DefaultCoverOrder if empty), for a Readium Package, the link of its manifest with
+// a "cover" relation. It returns nil if the publication has no cover.
+func FindCover(path string, order []string) (*Cover, error) {
+	order, err := ParseCoverOrder(order)
+	if err != nil {
+		return nil, err
+	}
+	switch filepath.Ext(path) {
+	case ".epub":
+		ep, err := openEPUB(path)
+		if err != nil {
+			return nil, err
+		}
+		defer ep.Close()
+		return ep.cover(order), nil
+	case ".audiobook", ".divina", ".webpub", ".rpf":
+		zr, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		cover, err := manifestCoverPath(&zr.Reader)
+		if err != nil || cover == "" {
+			return nil, err
+		}
+		return &Cover{Path: cover, Source: CoverSourceManifest}, nil
+	}
+	return nil, nil
+}
+
+// ReadCoverColors computes the colors of the cover of the publication at path, chosen in the
+// default order. It returns nil if the publication has no cover.
+func ReadCoverColors(path string, paletteSize int) (*CoverColors, error) {
+	cover, err := FindCover(path, nil)
+	if err != nil || cover == nil {
+		return nil, err
+	}
+	return cover.Colors(path, paletteSize)
+}
+
+// Colors computes the colors of the cover image, read from the publication at path.
+// The image is downsampled before the colors are counted, so that the cost does not depend
+// on its resolution.
+func (c *Cover) Colors(path string, paletteSize int) (*CoverColors, error) {
+	if paletteSize <= 0 {
+		paletteSize = DefaultPaletteSize
+	}
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	f, err := zr.Open(c.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return imageColors(data, paletteSize)
+}
+
+// cover returns the first candidate cover found in order, nil if none.
+// The other declared covers are reported if they disagree.
+func (ep *epubFile) cover(order []string) *Cover {
+	candidates := ep.coverCandidates()
+	var cover *Cover
+	for _, source := range order {
+		if p, ok := candidates[source]; ok {
+			cover = &Cover{Path: p, Source: source}
+			break
+		}
+	}
+	if cover == nil {
+		return nil
+	}
+	// the first image is not a declaration
+	for _, source := range []string{CoverSourceProperty, CoverSourceMeta, CoverSourceGuide} {
+		if p, ok := candidates[source]; ok && p != cover.Path && !slices.Contains(cover.Conflicts, p) {
+			cover.Conflicts = append(cover.Conflicts, p)
+		}
+	}
+	return cover
+}
+
+// coverCandidates returns the path of the cover image found from each source.
+func (ep *epubFile) coverCandidates() map[string]string {
+	candidates := make(map[string]string)
+	// EPUB 2 declares its cover image in a meta element
+	coverID := ""
+	for _, m := range ep.pkg.Metadata.Metas {
+		if m.Name == "cover" {
+			coverID = m.Content
+		}
+	}
+	for _, item := range ep.pkg.Manifest {
+		if _, ok := candidates[CoverSourceProperty]; !ok && slices.Contains(strings.Fields(item.Properties), "cover-image") {
+			candidates[CoverSourceProperty] = ep.itemPath(item)
+		}
+		if coverID != "" && item.ID == coverID {
+			candidates[CoverSourceMeta] = ep.itemPath(item)
+		}
+		if _, ok := candidates[CoverSourceFirstImage]; !ok && strings.HasPrefix(item.MediaType, "image/") {
+			candidates[CoverSourceFirstImage] = ep.itemPath(item)
+		}
+	}
+	for _, ref := range ep.pkg.Guide {
+		if ref.Type != "cover" {
+			continue
+		}
+		if p := ep.guideCover(resolve(ep.opfPath, ref.Href)); p != "" {
+			candidates[CoverSourceGuide] = p
+		}
+		break
+	}
+	return candidates
+}
+
+// guideCover returns the cover image referenced by the guide: the image itself,
+// or the first image of the page it references.
+func (ep *epubFile) guideCover(ref string) string {
+	for _, item := range ep.pkg.Manifest {
+		if ep.itemPath(item) != ref {
+			continue
+		}
+		if strings.HasPrefix(item.MediaType, "image/") {
+			return ref
+		}
+		break
+	}
+	data, err := ep.read(ref)
+	if err != nil {
+		return ""
+	}
+	z := html.NewTokenizer(bytes.NewReader(data))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			if string(name) != "img" && string(name) != "image" {
+				continue
+			}
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				switch string(key) {
+				case "src", "href", "xlink:href":
+					return resolve(ref, string(val))
+				}
+			}
+		}
+	}
+}
+
+// manifestCoverPath returns the path of the cover of a Readium Package, if any.
+func manifestCoverPath(zr *zip.Reader) (string, error) {
+	f, err := zr.Open(rwpManifest)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	type link struct {
+		Href string   `json:"href"`
+		Rel  []string `json:"rel"`
+	}
+	var manifest struct {
+		Links        []link `json:"links"`
+		ReadingOrder []link `json:"readingOrder"`
+		Resources    []link `json:"resources"`
+	}
+	if err := json.NewDecoder(f).Decode(&manifest); err != nil {
+		return "", err
+	}
+	for _, l := range slices.Concat(manifest.Resources, manifest.ReadingOrder, manifest.Links) {
+		if slices.Contains(l.Rel, "cover") {
+			return resolve(rwpManifest, l.Href), nil
+		}
+	}
+	return "", nil
+}
+
+// imageColors decodes an image and computes its colors from a grid of sampled pixels.
+// Pixels are grouped by color, at 4 bits per channel; transparent pixels are ignored.
+func imageColors(data []byte, paletteSize int) (*CoverColors, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported cover image: %w", err)
+	}
+	if cfg.Width*cfg.Height > maxCoverPixels {
+		return nil, fmt.Errorf("cover image too large: %dx%d", cfg.Width, cfg.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid cover image: %w", err)
+	}
+
+	type bucket struct {
+		key              int
+		count            int
+		red, green, blue int
+	}
+	buckets := make(map[int]*bucket)
+	b := img.Bounds()
+	stepX := max(1, b.Dx()/maxCoverSamples)
+	stepY := max(1, b.Dy()/maxCoverSamples)
+	for y := b.Min.Y; y < b.Max.Y; y += stepY {
+		for x := b.Min.X; x < b.Max.X; x += stepX {
+			r, g, bl, a := img.At(x, y).RGBA()
+			if a < 0x8000 {
+				continue
+			}
+			// back to 8 bit channels, without premultiplied alpha
+			r, g, bl = r*0xff/a, g*0xff/a, bl*0xff/a
+			key := int(r>>4)<<8 | int(g>>4)<<4 | int(bl>>4)
+			bk, ok := buckets[key]
+			if !ok {
+				bk = &bucket{key: key}
+				buckets[key] = bk
+			}
+			bk.count++
+			bk.red += int(r)
+			bk.green += int(g)
+			bk.blue += int(bl)
+		}
+	}
+	if len(buckets) == 0 {
+		return nil, nil
+	}
+
+	sorted := make([]*bucket, 0, len(buckets))
+	for _, bk := range buckets {
+		sorted = append(sorted, bk)
+	}
+	slices.SortFunc(sorted, func(a, b *bucket) int {
+		if c := cmp.Compare(b.count, a.count); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.key, b.key)
+	})
+	colors := &CoverColors{}
+	for _, bk := range sorted[:min(paletteSize, len(sorted))] {
+		colors.Palette = append(colors.Palette, fmt.Sprintf("#%02x%02x%02x", bk.red/bk.count, bk.green/bk.count, bk.blue/bk.count))
+	}
+	colors.Color = colors.Palette[0]
+	return colors, nil
+}
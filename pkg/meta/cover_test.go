@@ -0,0 +1,152 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import (
+	"archive/zip"
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/edrlab/lcp-server/pkg/test"
+)
+
+// testCover returns a PNG image, red on its top three quarters and blue below.
+func testCover(t testing.TB, width, height int) string {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.RGBA{0xff, 0, 0, 0xff}
+			if y >= height*3/4 {
+				c = color.RGBA{0, 0, 0xff, 0xff}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestReadCoverColorsEPUB(t *testing.T) {
+	cover := testCover(t, 400, 600)
+	cases := map[string]string{
+		"EPUB 3": test.OPF(`<dc:title>Cover</dc:title>`,
+			`<item id="img" href="images/cover.png" media-type="image/png" properties="cover-image"/>`,
+			`<spine/>`),
+		"EPUB 2": test.OPF(`<dc:title>Cover</dc:title><meta name="cover" content="img"/>`,
+			`<item id="img" href="images/cover.png" media-type="image/png"/>`,
+			`<spine/>`),
+	}
+	for name, opf := range cases {
+		path := filepath.Join(t.TempDir(), "test.epub")
+		test.WriteEPUB(t, path, map[string]string{"OEBPS/content.opf": opf, "OEBPS/images/cover.png": cover})
+		colors, err := ReadCoverColors(path, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if colors == nil || colors.Color != "#ff0000" || !slices.Equal(colors.Palette, []string{"#ff0000", "#0000ff"}) {
+			t.Errorf("%s: unexpected colors %+v", name, colors)
+		}
+	}
+}
+
+func TestReadCoverColorsAudiobook(t *testing.T) {
+	path := writeZip(t, [][2]string{
+		{"manifest.json", `{"metadata":{},"readingOrder":[{"href":"1.mp3"}],"resources":[{"href":"cover.png","rel":["cover"]}]}`},
+		{"cover.png", testCover(t, 20, 20)},
+	}, zip.Deflate, time.Now())
+	audiobook := path[:len(path)-len(".epub")] + ".audiobook"
+	if err := os.Rename(path, audiobook); err != nil {
+		t.Fatal(err)
+	}
+	colors, err := ReadCoverColors(audiobook, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if colors == nil || colors.Color != "#ff0000" || len(colors.Palette) != 1 {
+		t.Errorf("Unexpected colors %+v", colors)
+	}
+}
+
+func TestReadCoverColorsNoCover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.epub")
+	test.WriteEPUB(t, path, nil)
+	colors, err := ReadCoverColors(path, 0)
+	if err != nil || colors != nil {
+		t.Errorf("Expected no colors, got %+v (%v)", colors, err)
+	}
+
+	// a transparent cover has no colors
+	img := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if colors, err := imageColors(buf.Bytes(), 5); err != nil || colors != nil {
+		t.Errorf("Expected no colors, got %+v (%v)", colors, err)
+	}
+
+	if _, err := imageColors([]byte("not an image"), 5); err == nil {
+		t.Error("Expected an error for an invalid image")
+	}
+}
+
+// conflictingCovers is an EPUB whose cover-image property, EPUB 2 meta and guide disagree.
+var conflictingCovers = map[string]string{
+	"OEBPS/content.opf": test.OPF(`<dc:title>Covers</dc:title><meta name="cover" content="meta-cover"/>`,
+		`<item id="figure" href="images/figure.png" media-type="image/png"/>
+		<item id="new-cover" href="images/cover.png" media-type="image/png" properties="cover-image"/>
+		<item id="meta-cover" href="images/old-cover.png" media-type="image/png"/>
+		<item id="page" href="cover.xhtml" media-type="application/xhtml+xml"/>`,
+		`<spine><itemref idref="page"/></spine>
+		<guide><reference type="cover" href="cover.xhtml" title="Cover"/></guide>`),
+	"OEBPS/cover.xhtml": `<html><body><svg xmlns:xlink="http://www.w3.org/1999/xlink"><image xlink:href="images/scan.png"/></svg></body></html>`,
+}
+
+func TestFindCover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.epub")
+	test.WriteEPUB(t, path, conflictingCovers)
+	cases := []struct {
+		order     []string
+		path      string
+		source    string
+		conflicts []string
+	}{
+		{nil, "OEBPS/images/cover.png", CoverSourceProperty, []string{"OEBPS/images/old-cover.png", "OEBPS/images/scan.png"}},
+		{[]string{CoverSourceGuide, CoverSourceProperty}, "OEBPS/images/scan.png", CoverSourceGuide, []string{"OEBPS/images/cover.png", "OEBPS/images/old-cover.png"}},
+		{[]string{CoverSourceMeta}, "OEBPS/images/old-cover.png", CoverSourceMeta, []string{"OEBPS/images/cover.png", "OEBPS/images/scan.png"}},
+		{[]string{CoverSourceFirstImage}, "OEBPS/images/figure.png", CoverSourceFirstImage, []string{"OEBPS/images/cover.png", "OEBPS/images/old-cover.png", "OEBPS/images/scan.png"}},
+	}
+	for _, c := range cases {
+		cover, err := FindCover(path, c.order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cover == nil || cover.Path != c.path || cover.Source != c.source || !slices.Equal(cover.Conflicts, c.conflicts) {
+			t.Errorf("%q: unexpected cover %+v", c.order, cover)
+		}
+	}
+
+	// a guide reference to the image itself, agreeing with the cover-image property
+	test.WriteEPUB(t, path, map[string]string{
+		"OEBPS/content.opf": test.OPF(`<dc:title>Cover</dc:title>`,
+			`<item id="img" href="images/cover.png" media-type="image/png" properties="cover-image"/>`,
+			`<spine/><guide><reference type="cover" href="images/cover.png"/></guide>`),
+	})
+	if cover, err := FindCover(path, []string{CoverSourceGuide}); err != nil || cover == nil || cover.Source != CoverSourceGuide || cover.Conflicts != nil {
+		t.Errorf("Unexpected cover %+v (%v)", cover, err)
+	}
+
+	if _, err := FindCover(path, []string{"thumbnail"}); err == nil {
+		t.Error("Expected an error for an unknown cover source")
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// dateLayouts are the W3CDTF forms of dc:date, from the most precise, then the variants found in EPUBs:
+// times without time zone, with a space separator, and compact or slashed dates.
+var dateLayouts = []string{time.RFC3339, "2006-01-02T15:04Z07:00", "2006-01-02", "2006-01", "2006",
+	"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05Z07:00", "2006-01-02 15:04:05", "2006/01/02", "20060102"}
+
+// publicationDate returns the publication date of the package document, zero if it is missing or invalid.
+// EPUB 2 dates qualified by another event (creation, modification) are ignored.
+func (ep *epubFile) publicationDate() time.Time {
+	for _, d := range ep.pkg.Metadata.Dates {
+		if d.Event != "" && d.Event != "publication" {
+			continue
+		}
+		if t, ok := parseDate(d.Value); ok {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// packageDate returns the date of the meta property (EPUB 3) of the package, else the first date qualified
+// by event (EPUB 2), zero if none. An unparseable date is reported as a warning and ignored.
+func (ep *epubFile) packageDate(info *Info, property, event string) time.Time {
+	var values []string
+	for _, mt := range ep.pkg.Metadata.Metas {
+		if mt.Property == property && mt.Refines == "" {
+			values = append(values, mt.Value)
+		}
+	}
+	for _, d := range ep.pkg.Metadata.Dates {
+		if d.Event == event {
+			values = append(values, d.Value)
+		}
+	}
+	for _, v := range values {
+		if t, ok := parseDate(v); ok {
+			return t
+		}
+		info.warn(fmt.Sprintf("unparseable %s date %q", event, strings.TrimSpace(v)))
+	}
+	return time.Time{}
+}
+
+// modificationDate returns the last modification date of the publication: dcterms:modified,
+// else an EPUB 2 date of the modification event; zero if none.
+func (ep *epubFile) modificationDate(info *Info) time.Time {
+	return ep.packageDate(info, "dcterms:modified", "modification")
+}
+
+// creationDate returns the creation date of the publication: dcterms:created, else an EPUB 2
+// date of the creation event, else the publication date; zero if none.
+func (ep *epubFile) creationDate(info *Info) time.Time {
+	if t := ep.packageDate(info, "dcterms:created", "creation"); !t.IsZero() {
+		return t
+	}
+	return info.Published
+}
+
+// parseDate parses a W3CDTF date, as UTC if it has no time zone.
+func parseDate(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
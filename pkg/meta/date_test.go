@@ -0,0 +1,81 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/edrlab/lcp-server/pkg/test"
+)
+
+func TestPublicationDate(t *testing.T) {
+	cases := []struct {
+		name     string
+		metadata string
+		expected time.Time
+	}{
+		{"none", ``, time.Time{}},
+		{"day", `<dc:date>2019-06-21</dc:date>`, time.Date(2019, 6, 21, 0, 0, 0, 0, time.UTC)},
+		{"year", `<dc:date> 1864 </dc:date>`, time.Date(1864, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"time zone", `<dc:date>2019-06-21T10:00:00+02:00</dc:date>`, time.Date(2019, 6, 21, 8, 0, 0, 0, time.UTC)},
+		{"invalid", `<dc:date>June 2019</dc:date>`, time.Time{}},
+		{"epub2 events", `<dc:date opf:event="modification" xmlns:opf="http://www.idpf.org/2007/opf">2020-01-01</dc:date>
+			<dc:date opf:event="publication" xmlns:opf="http://www.idpf.org/2007/opf">2018-05-04</dc:date>`,
+			time.Date(2018, 5, 4, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			info := inspectFiles(t, map[string]string{
+				"OEBPS/content.opf": test.OPF(`<dc:title>Dated</dc:title>`+c.metadata,
+					`<item id="ch1" href="chapter1.xhtml" media-type="application/xhtml+xml"/>`,
+					`<spine><itemref idref="ch1"/></spine>`),
+				"OEBPS/chapter1.xhtml": `<html><body><p>Chapter</p></body></html>`,
+			})
+			if !info.Published.Equal(c.expected) {
+				t.Errorf("Expected %v, got %v", c.expected, info.Published)
+			}
+		})
+	}
+}
+
+func TestModifiedCreated(t *testing.T) {
+	cases := []struct {
+		name     string
+		metadata string
+		modified time.Time
+		created  time.Time
+		warning  string
+	}{
+		{"none", ``, time.Time{}, time.Time{}, ""},
+		{"epub3", `<meta property="dcterms:modified">2021-03-04T05:06:07Z</meta>
+			<meta property="dcterms:created">2019-06-21</meta><dc:date>2020-01-01</dc:date>`,
+			time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC), time.Date(2019, 6, 21, 0, 0, 0, 0, time.UTC), ""},
+		{"publication date", `<dc:date>2020-01-01</dc:date>`,
+			time.Time{}, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), ""},
+		{"epub2 events", `<dc:date opf:event="modification" xmlns:opf="http://www.idpf.org/2007/opf">2020/02/03</dc:date>
+			<dc:date opf:event="creation" xmlns:opf="http://www.idpf.org/2007/opf">2018-05-04 10:00:00</dc:date>`,
+			time.Date(2020, 2, 3, 0, 0, 0, 0, time.UTC), time.Date(2018, 5, 4, 10, 0, 0, 0, time.UTC), ""},
+		{"no time zone", `<meta property="dcterms:modified">2021-03-04T05:06:07</meta>`,
+			time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC), time.Time{}, ""},
+		{"unparseable", `<meta property="dcterms:modified">last week</meta><meta property="dcterms:modified">2021-03-04T05:06:07Z</meta>`,
+			time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC), time.Time{}, `unparseable modification date "last week"`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			info := inspectFiles(t, map[string]string{
+				"OEBPS/content.opf": test.OPF(`<dc:title>Dated</dc:title>`+c.metadata,
+					`<item id="ch1" href="chapter1.xhtml" media-type="application/xhtml+xml"/>`,
+					`<spine><itemref idref="ch1"/></spine>`),
+				"OEBPS/chapter1.xhtml": `<html><body><p>Chapter</p></body></html>`,
+			})
+			if !info.Modified.Equal(c.modified) || !info.Created.Equal(c.created) {
+				t.Errorf("Expected %v and %v, got %v and %v", c.modified, c.created, info.Modified, info.Created)
+			}
+			if warnings := strings.Join(info.Warnings, "\n"); c.warning != "" && !strings.Contains(warnings, c.warning) {
+				t.Errorf("Expected the warning %q, got %q", c.warning, info.Warnings)
+			}
+		})
+	}
+}
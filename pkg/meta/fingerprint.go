@@ -0,0 +1,59 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Files ignored by the fingerprint, as they are not part of the content of the publication
+// or are generated by the packaging and protection tools.
+var fingerprintIgnored = map[string]bool{
+	"META-INF/encryption.xml": true,
+	"META-INF/signatures.xml": true,
+	"META-INF/rights.xml":     true,
+	"META-INF/license.lcpl":   true,
+}
+
+// fingerprint computes a hash of the clear resources of the publication,
+// independent of the zip packaging: entry order, compression, timestamps and comments
+// have no effect.
+//
+// Resource paths are normalized to Unicode NFC and sorted; directories and files
+// listed in fingerprintIgnored are skipped. The fingerprint is the hex-encoded SHA-256
+// of the lines "<path> <hex SHA-256 of the uncompressed content>\n".
+func (ep *epubFile) fingerprint() (string, error) {
+	type entry struct{ name, hash string }
+	var entries []entry
+	for _, f := range ep.zr.File {
+		name := norm.NFC.String(f.Name)
+		if strings.HasSuffix(name, "/") || fingerprintIgnored[name] {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return "", err
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, rc)
+		rc.Close()
+		if err != nil {
+			return "", fmt.Errorf("unable to read %s: %w", f.Name, err)
+		}
+		entries = append(entries, entry{name, hex.EncodeToString(h.Sum(nil))})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+
+	h := sha256.New()
+	for _, e := range entries {
+		fmt.Fprintf(h, "%s %s\n", e.name, e.hash)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
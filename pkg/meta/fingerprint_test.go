@@ -0,0 +1,80 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/edrlab/lcp-server/pkg/test"
+)
+
+// writeZip writes the given entries, in order, with the given compression method and time.
+func writeZip(t *testing.T, entries [][2]string, method uint16, modified time.Time) string {
+	path := filepath.Join(t.TempDir(), "test.epub")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, e := range entries {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: e[0], Method: method, Modified: modified})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(e[1]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func fingerprint(t *testing.T, path string) string {
+	info, err := Inspect(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Fingerprint == "" {
+		t.Fatal("Missing fingerprint")
+	}
+	return info.Fingerprint
+}
+
+func TestFingerprint(t *testing.T) {
+	entries := [][2]string{
+		{"mimetype", "application/epub+zip"},
+		{"META-INF/container.xml", test.ContainerXML},
+		{"OEBPS/content.opf", test.DefaultOPF},
+		{"OEBPS/nav.xhtml", `<html><body><nav></nav></body></html>`},
+		{"OEBPS/chapter1.xhtml", `<html><body><p>Hello</p></body></html>`},
+	}
+	reference := fingerprint(t, writeZip(t, entries, zip.Deflate, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)))
+
+	// same content, different packaging
+	reversed := make([][2]string, len(entries))
+	for i, e := range entries {
+		reversed[len(entries)-1-i] = e
+	}
+	withEncryption := append(append([][2]string{}, entries...), [2]string{"META-INF/encryption.xml", "<encryption/>"})
+	for name, path := range map[string]string{
+		"stored":     writeZip(t, entries, zip.Store, time.Now()),
+		"reordered":  writeZip(t, reversed, zip.Deflate, time.Now()),
+		"encryption": writeZip(t, withEncryption, zip.Deflate, time.Now()),
+	} {
+		if fp := fingerprint(t, path); fp != reference {
+			t.Errorf("%s: expected the same fingerprint, got %s", name, fp)
+		}
+	}
+
+	// different content
+	changed := append([][2]string{}, entries...)
+	changed[4][1] = `<html><body><p>Hello!</p></body></html>`
+	if fp := fingerprint(t, writeZip(t, changed, zip.Deflate, time.Now())); fp == reference {
+		t.Error("Expected a different fingerprint for a different content")
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Identifier schemes recognized by NormalizeIdentifiers
+const (
+	SchemeISBN = "isbn"
+	SchemeDOI  = "doi"
+)
+
+// Identifier is an identifier of a publication (dc:identifier).
+type Identifier struct {
+	Value string `json:"value"` // as declared
+	// Scheme is the recognized scheme, empty if unknown
+	Scheme string `json:"scheme,omitempty"`
+	// Normalized is the canonical form of a valid identifier: ISBN-13 digits, or a lowercase DOI
+	Normalized string `json:"normalized,omitempty"`
+
+	declared string // scheme declared in the package document
+}
+
+// ONIX codes of the identifier-type refinements (codelist 5)
+var onixSchemes = map[string]string{
+	"02": SchemeISBN, // ISBN-10
+	"06": SchemeDOI,
+	"15": SchemeISBN, // ISBN-13
+}
+
+// identifiers returns the identifiers of the package document, with their declared scheme:
+// the opf:scheme attribute in EPUB 2, an identifier-type refinement in EPUB 3.
+func (ep *epubFile) identifiers() []Identifier {
+	m := ep.pkg.Metadata
+	var ids []Identifier
+	for _, id := range m.Identifiers {
+		value := strings.TrimSpace(id.Value)
+		if value == "" {
+			continue
+		}
+		declared := strings.ToLower(id.Scheme)
+		for _, mt := range m.Metas {
+			if id.ID == "" || mt.Property != "identifier-type" || mt.Refines != "#"+id.ID {
+				continue
+			}
+			if s, ok := onixSchemes[strings.TrimSpace(mt.Value)]; ok && strings.HasPrefix(mt.Scheme, "onix:codelist5") {
+				declared = s
+			}
+		}
+		ids = append(ids, Identifier{Value: value, declared: declared})
+	}
+	return ids
+}
+
+// Forms of the identifiers
+var (
+	isbnPrefix = regexp.MustCompile(`(?i)^(urn:isbn:|isbn(-1[03])?:?\s*)`)
+	doiPrefix  = regexp.MustCompile(`(?i)^(urn:doi:|doi:\s*|https?://(dx\.)?doi\.org/)`)
+	doiForm    = regexp.MustCompile(`^10\.\d{4,9}/\S+$`)
+	isbnForm   = regexp.MustCompile(`^(\d{9}[\dX]|97[89]\d{10})$`)
+)
+
+// NormalizeIdentifiers recognizes the scheme of the identifiers and sets their normalized form:
+// ISBN-10 are converted to ISBN-13, DOI are lowercased, without their resolver prefix.
+// An ISBN with an invalid check digit is not normalized; a warning is returned instead.
+func NormalizeIdentifiers(ids []Identifier) (warnings []string) {
+	for i := range ids {
+		id := &ids[i]
+		if doi, ok := parseDOI(id.Value, id.declared == SchemeDOI); ok {
+			id.Scheme, id.Normalized = SchemeDOI, doi
+			continue
+		}
+		isbn, ok := parseISBN(id.Value, id.declared == SchemeISBN)
+		if !ok {
+			continue
+		}
+		id.Scheme = SchemeISBN
+		if normalized, valid := isbn13(isbn); valid {
+			id.Normalized = normalized
+		} else {
+			warnings = append(warnings, fmt.Sprintf("invalid ISBN check digit in identifier %q", id.Value))
+		}
+	}
+	return warnings
+}
+
+// parseDOI returns the lowercase DOI of a value, prefixed or declared as a DOI.
+// DOI are case-insensitive.
+func parseDOI(value string, declared bool) (string, bool) {
+	doi := doiPrefix.ReplaceAllString(value, "")
+	if doi == value && !declared && !strings.HasPrefix(value, "10.") {
+		return "", false
+	}
+	doi = strings.ToLower(strings.TrimSpace(doi))
+	return doi, doiForm.MatchString(doi)
+}
+
+// parseISBN returns the digits of an ISBN: a value prefixed or declared as an ISBN,
+// or 13 digits starting with an EAN prefix of books.
+func parseISBN(value string, declared bool) (string, bool) {
+	isbn := isbnPrefix.ReplaceAllString(value, "")
+	prefixed := isbn != value
+	isbn = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(isbn))
+	if !isbnForm.MatchString(isbn) {
+		return "", false
+	}
+	return isbn, prefixed || declared || len(isbn) == 13
+}
+
+// isbn13 returns the ISBN-13 form of an ISBN, and checks its check digit.
+func isbn13(isbn string) (string, bool) {
+	if len(isbn) == 10 {
+		sum := 0
+		for i, c := range isbn {
+			d := int(c - '0')
+			if c == 'X' {
+				d = 10
+			}
+			sum += (10 - i) * d
+		}
+		if sum%11 != 0 {
+			return "", false
+		}
+		base := "978" + isbn[:9]
+		return base + string(rune('0'+ean13CheckDigit(base))), true
+	}
+	if !strings.ContainsRune(isbn, 'X') && ean13CheckDigit(isbn[:12]) == int(isbn[12]-'0') {
+		return isbn, true
+	}
+	return "", false
+}
+
+// ean13CheckDigit computes the check digit of the 12 first digits of an EAN-13.
+func ean13CheckDigit(digits string) int {
+	sum := 0
+	for i, c := range digits {
+		w := 1
+		if i%2 == 1 {
+			w = 3
+		}
+		sum += w * int(c-'0')
+	}
+	return (10 - sum%10) % 10
+}
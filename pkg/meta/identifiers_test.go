@@ -0,0 +1,65 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/edrlab/lcp-server/pkg/test"
+)
+
+func TestNormalizeIdentifiers(t *testing.T) {
+	cases := []struct {
+		id         Identifier
+		scheme     string
+		normalized string
+		warning    bool
+	}{
+		{Identifier{Value: "urn:isbn:978-0-306-40615-7"}, SchemeISBN, "9780306406157", false},
+		{Identifier{Value: "ISBN 0-306-40615-2"}, SchemeISBN, "9780306406157", false},
+		{Identifier{Value: "080442957X", declared: SchemeISBN}, SchemeISBN, "9780804429573", false},
+		{Identifier{Value: "9780306406157"}, SchemeISBN, "9780306406157", false},
+		{Identifier{Value: "urn:isbn:9780306406158"}, SchemeISBN, "", true},
+		{Identifier{Value: "isbn:0306406153"}, SchemeISBN, "", true},
+		{Identifier{Value: "doi:10.1000/ABC.123"}, SchemeDOI, "10.1000/abc.123", false},
+		{Identifier{Value: "https://doi.org/10.1000/XYZ"}, SchemeDOI, "10.1000/xyz", false},
+		{Identifier{Value: "10.1000/XYZ"}, SchemeDOI, "10.1000/xyz", false},
+		{Identifier{Value: "urn:uuid:4b2c3d60-2c7a-4b8e-9d0f-0c5a2f1b7e41"}, "", "", false},
+		// not prefixed nor declared, 10 digits are not recognized as an ISBN
+		{Identifier{Value: "0306406152"}, "", "", false},
+	}
+	for _, c := range cases {
+		ids := []Identifier{c.id}
+		warnings := NormalizeIdentifiers(ids)
+		if ids[0].Scheme != c.scheme || ids[0].Normalized != c.normalized || ids[0].Value != c.id.Value {
+			t.Errorf("%q: expected %q %q, got %+v", c.id.Value, c.scheme, c.normalized, ids[0])
+		}
+		if (len(warnings) > 0) != c.warning {
+			t.Errorf("%q: unexpected warnings %q", c.id.Value, warnings)
+		}
+	}
+}
+
+func TestDeclaredIdentifierSchemes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.epub")
+	test.WriteEPUB(t, path, map[string]string{
+		"OEBPS/content.opf": test.OPF(`<dc:identifier id="isbn">0-306-40615-2</dc:identifier>
+			<meta refines="#isbn" property="identifier-type" scheme="onix:codelist5">02</meta>
+			<dc:identifier xmlns:opf="http://www.idpf.org/2007/opf" opf:scheme="ISBN">080442957X</dc:identifier>
+			<dc:title>Identifiers</dc:title>`, ``, `<spine/>`),
+	})
+	info, err := Inspect(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Identifiers) != 3 {
+		t.Fatalf("Expected 3 identifiers, got %+v", info.Identifiers)
+	}
+	NormalizeIdentifiers(info.Identifiers)
+	for i, expected := range []string{"", "9780306406157", "9780804429573"} {
+		if info.Identifiers[i].Normalized != expected {
+			t.Errorf("Identifier %d: expected %q, got %+v", i, expected, info.Identifiers[i])
+		}
+	}
+}
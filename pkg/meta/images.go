@@ -0,0 +1,135 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"image"
+	"io"
+)
+
+// maxImages is the number of images inspected in a publication; larger sets are sampled.
+const maxImages = 500
+
+// headerSize is the size of the image headers read for their resolution.
+const headerSize = 64 * 1024
+
+// Raster image types whose dimensions can be read
+var rasterTypes = map[string]bool{"image/jpeg": true, "image/png": true, "image/gif": true}
+
+// ImageInfo gives the dimensions of an image resource, and its resolution when declared.
+type ImageInfo struct {
+	Path   string `json:"path"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	XDPI   int    `json:"x_dpi,omitempty"`
+	YDPI   int    `json:"y_dpi,omitempty"`
+}
+
+// imagePaths returns the paths of the raster images declared in the manifest of the EPUB.
+func (ep *epubFile) imagePaths() []string {
+	var paths []string
+	for _, item := range ep.pkg.Manifest {
+		if rasterTypes[item.MediaType] {
+			paths = append(paths, ep.itemPath(item))
+		}
+	}
+	return paths
+}
+
+// packageImagePaths returns the paths of the raster images of the manifest of a Readium Package.
+func packageImagePaths(zr *zip.Reader) ([]string, error) {
+	f, err := zr.Open(rwpManifest)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	type link struct {
+		Href string `json:"href"`
+		Type string `json:"type"`
+	}
+	var manifest struct {
+		ReadingOrder []link `json:"readingOrder"`
+		Resources    []link `json:"resources"`
+	}
+	if err := json.NewDecoder(f).Decode(&manifest); err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, l := range append(manifest.ReadingOrder, manifest.Resources...) {
+		if rasterTypes[l.Type] {
+			paths = append(paths, resolve(rwpManifest, l.Href))
+		}
+	}
+	return paths, nil
+}
+
+// readImages reads the dimensions of the images at paths. Only the headers of the images are read.
+// If there are more than maxImages images, evenly spaced images are inspected and sampled is set.
+// Missing or invalid images are skipped.
+func readImages(open func(string) (io.ReadCloser, error), paths []string) (images []ImageInfo, sampled bool) {
+	if len(paths) > maxImages {
+		sample := make([]string, maxImages)
+		for i := range sample {
+			sample[i] = paths[i*len(paths)/maxImages]
+		}
+		paths, sampled = sample, true
+	}
+	for _, p := range paths {
+		if info, ok := readImage(open, p); ok {
+			images = append(images, info)
+		}
+	}
+	return images, sampled
+}
+
+// readImage reads the dimensions and resolution of an image.
+func readImage(open func(string) (io.ReadCloser, error), path string) (ImageInfo, bool) {
+	rc, err := open(path)
+	if err != nil {
+		return ImageInfo{}, false
+	}
+	defer rc.Close()
+	br := bufio.NewReaderSize(rc, headerSize)
+	header, _ := br.Peek(headerSize)
+	x, y := imageResolution(header)
+	cfg, _, err := image.DecodeConfig(br)
+	if err != nil {
+		return ImageInfo{}, false
+	}
+	return ImageInfo{Path: path, Width: cfg.Width, Height: cfg.Height, XDPI: x, YDPI: y}, true
+}
+
+// imageResolution returns the resolution (dots per inch) declared in the header of a JPEG (JFIF segment)
+// or PNG (pHYs chunk) image, 0 if not declared.
+func imageResolution(header []byte) (x, y int) {
+	switch {
+	case bytes.HasPrefix(header, []byte{0xff, 0xd8, 0xff, 0xe0}) && len(header) >= 18 && string(header[6:11]) == "JFIF\x00":
+		density := func(b []byte) int { return int(binary.BigEndian.Uint16(b)) }
+		switch header[13] {
+		case 1: // dots per inch
+			return density(header[14:]), density(header[16:])
+		case 2: // dots per centimeter
+			return int(float64(density(header[14:]))*2.54 + 0.5), int(float64(density(header[16:]))*2.54 + 0.5)
+		}
+	case bytes.HasPrefix(header, []byte("\x89PNG\r\n\x1a\n")):
+		// chunks: length, type, data, CRC; pHYs comes before the image data
+		for b := header[8:]; len(b) >= 8; {
+			n := int(binary.BigEndian.Uint32(b))
+			typ := string(b[4:8])
+			if typ == "IDAT" || n < 0 || len(b) < 12+n {
+				break
+			}
+			if typ == "pHYs" && n == 9 && b[16] == 1 { // pixels per meter
+				ppm := func(b []byte) int { return int(float64(binary.BigEndian.Uint32(b))*0.0254 + 0.5) }
+				return ppm(b[8:]), ppm(b[12:])
+			}
+			b = b[12+n:]
+		}
+	}
+	return 0, 0
+}
@@ -0,0 +1,110 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/edrlab/lcp-server/pkg/test"
+)
+
+// pngWithResolution returns a PNG image with a pHYs chunk, in pixels per meter.
+func pngWithResolution(t testing.TB, width, height int, ppm uint32) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 9)
+	binary.BigEndian.PutUint32(data, ppm)
+	binary.BigEndian.PutUint32(data[4:], ppm)
+	data[8] = 1
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, "pHYs"...)
+	chunk = append(chunk, data...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	// after the signature and the IHDR chunk
+	encoded := buf.Bytes()
+	return append(append(append([]byte{}, encoded[:33]...), chunk...), encoded[33:]...)
+}
+
+func TestImageResolution(t *testing.T) {
+	jfif := []byte{0xff, 0xd8, 0xff, 0xe0, 0, 16, 'J', 'F', 'I', 'F', 0, 1, 1, 1, 0, 150, 0, 150}
+	dpcm := []byte{0xff, 0xd8, 0xff, 0xe0, 0, 16, 'J', 'F', 'I', 'F', 0, 1, 1, 2, 0, 118, 0, 118}
+	cases := []struct {
+		name   string
+		header []byte
+		x, y   int
+	}{
+		{"JFIF dpi", jfif, 150, 150},
+		{"JFIF dpcm", dpcm, 300, 300},
+		{"PNG", pngWithResolution(t, 2, 2, 11811), 300, 300},
+		{"PNG without pHYs", pngWithResolution(t, 2, 2, 0)[:33], 0, 0},
+		{"unknown", []byte("GIF89a"), 0, 0},
+	}
+	for _, c := range cases {
+		if x, y := imageResolution(c.header); x != c.x || y != c.y {
+			t.Errorf("%s: expected %dx%d dpi, got %dx%d", c.name, c.x, c.y, x, y)
+		}
+	}
+}
+
+func TestReadContentMetricsImages(t *testing.T) {
+	var jpg, gf bytes.Buffer
+	if err := jpeg.Encode(&jpg, image.NewGray(image.Rect(0, 0, 30, 40)), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := gif.Encode(&gf, image.NewGray(image.Rect(0, 0, 5, 6)), nil); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "test.epub")
+	test.WriteEPUB(t, path, map[string]string{
+		"OEBPS/content.opf": test.OPF(`<dc:title>Images</dc:title>`,
+			`<item id="i1" href="images/scan.png" media-type="image/png"/>
+			<item id="i2" href="images/photo.jpg" media-type="image/jpeg"/>
+			<item id="i3" href="images/anim.gif" media-type="image/gif"/>
+			<item id="i4" href="images/broken.png" media-type="image/png"/>
+			<item id="i5" href="images/figure.svg" media-type="image/svg+xml"/>`,
+			`<spine/>`),
+		"OEBPS/images/scan.png":   string(pngWithResolution(t, 1000, 1400, 11811)),
+		"OEBPS/images/photo.jpg":  jpg.String(),
+		"OEBPS/images/anim.gif":   gf.String(),
+		"OEBPS/images/broken.png": "not an image",
+		"OEBPS/images/figure.svg": "<svg/>",
+	})
+	m, err := ReadContentMetrics(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ImageInfo{
+		{Path: "OEBPS/images/scan.png", Width: 1000, Height: 1400, XDPI: 300, YDPI: 300},
+		{Path: "OEBPS/images/photo.jpg", Width: 30, Height: 40},
+		{Path: "OEBPS/images/anim.gif", Width: 5, Height: 6},
+	}
+	if m.ImageCount != 4 || m.ImagesSampled || fmt.Sprint(m.Images) != fmt.Sprint(expected) {
+		t.Errorf("Unexpected images %+v", m)
+	}
+}
+
+func TestReadImagesSampling(t *testing.T) {
+	img := pngWithResolution(t, 1, 1, 0)
+	paths := make([]string, 1200)
+	for i := range paths {
+		paths[i] = fmt.Sprintf("image%d.png", i)
+	}
+	images, sampled := readImages(func(string) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(img)), nil
+	}, paths)
+	if !sampled || len(images) != maxImages || images[0].Path != "image0.png" || images[maxImages-1].Path != "image1197.png" {
+		t.Errorf("Unexpected sample: %t, %d images", sampled, len(images))
+	}
+}
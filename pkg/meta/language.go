@@ -0,0 +1,102 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Pronunciation data: PLS lexicons and SSML attributes of content documents
+const (
+	plsMediaType  = "application/pls+xml"
+	ssmlNamespace = "http://www.w3.org/2001/10/synthesis"
+)
+
+// rtlLanguages are the languages written right to left, and rtlScripts the scripts of language tags
+// written right to left, e.g. az-Arab.
+var (
+	rtlLanguages = []string{"ar", "arc", "ckb", "dv", "fa", "he", "iw", "ps", "sd", "syr", "ug", "ur", "yi"}
+	rtlScripts   = []string{"arab", "hebr", "syrc", "thaa", "nkoo", "adlm"}
+)
+
+// pageProgressionDirection returns the direction of the publication, ltr or rtl: the page-progression-direction
+// of the spine, else the direction of the primary language. Unknown values are reported as warnings and ignored.
+func (ep *epubFile) pageProgressionDirection(info *Info) string {
+	switch dir := strings.ToLower(strings.TrimSpace(ep.pkg.Spine.PageProgressionDirection)); dir {
+	case "ltr", "rtl":
+		return dir
+	case "", "default":
+	default:
+		info.warn(fmt.Sprintf("unknown page-progression-direction %q", dir))
+	}
+	// an explicit script, e.g. az-Arab or ku-Latn, prevails over the language
+	subtags := strings.Split(strings.ToLower(info.PrimaryLanguage), "-")
+	if len(subtags) > 1 && len(subtags[1]) == 4 {
+		if slices.Contains(rtlScripts, subtags[1]) {
+			return "rtl"
+		}
+		return "ltr"
+	}
+	if slices.Contains(rtlLanguages, subtags[0]) {
+		return "rtl"
+	}
+	return "ltr"
+}
+
+// primaryLanguage returns the first language declared in the package document, or an empty string.
+func (ep *epubFile) primaryLanguage() string {
+	if languages := trimAll(ep.pkg.Metadata.Languages); len(languages) > 0 {
+		return languages[0]
+	}
+	return ""
+}
+
+// hasPronunciationData checks if the publication provides pronunciation hints:
+// a PLS lexicon in its manifest, or SSML phonemes (ssml:ph) in a content document.
+func (ep *epubFile) hasPronunciationData() bool {
+	for _, item := range ep.pkg.Manifest {
+		if item.MediaType == plsMediaType {
+			return true
+		}
+	}
+	for _, item := range ep.pkg.Manifest {
+		if item.MediaType != "application/xhtml+xml" {
+			continue
+		}
+		data, err := ep.read(ep.itemPath(item))
+		if err != nil || !bytes.Contains(data, []byte(ssmlNamespace)) {
+			continue
+		}
+		if hasSSMLPhonemes(data) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasSSMLPhonemes checks if an XHTML document has an element with an SSML ph attribute,
+// whatever the prefix bound to the SSML namespace.
+func hasSSMLPhonemes(data []byte) bool {
+	z := html.NewTokenizer(bytes.NewReader(data))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return false
+		case html.StartTagToken, html.SelfClosingTagToken:
+			for {
+				key, _, more := z.TagAttr()
+				if strings.HasSuffix(string(key), ":ph") {
+					return true
+				}
+				if !more {
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/edrlab/lcp-server/pkg/test"
+)
+
+func TestPrimaryLanguage(t *testing.T) {
+	info := inspectFiles(t, map[string]string{
+		"OEBPS/content.opf": test.OPF(`<dc:title>Languages</dc:title>
+			<dc:language> </dc:language><dc:language>fr-CA</dc:language><dc:language>en</dc:language>`, ``, `<spine/>`),
+	})
+	if info.PrimaryLanguage != "fr-CA" {
+		t.Errorf("Expected fr-CA, got %q", info.PrimaryLanguage)
+	}
+}
+
+func TestPronunciationData(t *testing.T) {
+	chapter := `<item id="ch1" href="chapter1.xhtml" media-type="application/xhtml+xml"/>`
+	cases := []struct {
+		name     string
+		manifest string
+		chapter  string
+		expected bool
+	}{
+		{"none", chapter, `<html><body><p>Hello</p></body></html>`, false},
+		{"PLS lexicon", chapter + `<item id="pls" href="lexicon.pls" media-type="application/pls+xml"/>`,
+			`<html><body><p>Hello</p></body></html>`, true},
+		{"SSML phoneme", chapter, `<html xmlns:ssml="http://www.w3.org/2001/10/synthesis"><body>
+			<p><span ssml:ph="təˈmɑːtəʊ">tomato</span></p></body></html>`, true},
+		{"other prefix", chapter, `<html xmlns:s="http://www.w3.org/2001/10/synthesis"><body>
+			<p><span s:ph="təˈmɑːtəʊ" s:alphabet="ipa">tomato</span></p></body></html>`, true},
+		{"SSML namespace only", chapter, `<html xmlns:ssml="http://www.w3.org/2001/10/synthesis"><body><p>Hello</p></body></html>`, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			info := inspectFiles(t, map[string]string{
+				"OEBPS/content.opf":    test.OPF(`<dc:title>Pronunciation</dc:title>`, c.manifest, `<spine><itemref idref="ch1"/></spine>`),
+				"OEBPS/chapter1.xhtml": c.chapter,
+			})
+			if info.HasPronunciationData != c.expected {
+				t.Errorf("Expected %t, got %t", c.expected, info.HasPronunciationData)
+			}
+		})
+	}
+}
+
+func TestPageProgressionDirection(t *testing.T) {
+	cases := []struct {
+		name     string
+		language string
+		spine    string
+		expected string
+	}{
+		{"unspecified", "en", `<spine>`, "ltr"},
+		{"no language", "", `<spine>`, "ltr"},
+		{"declared rtl", "en", `<spine page-progression-direction="rtl">`, "rtl"},
+		{"declared ltr", "ar", `<spine page-progression-direction="ltr">`, "ltr"},
+		{"default", "he-IL", `<spine page-progression-direction="default">`, "rtl"},
+		{"Arabic", "ar", `<spine>`, "rtl"},
+		{"Persian", "FA", `<spine>`, "rtl"},
+		{"Arabic script", "az-Arab", `<spine>`, "rtl"},
+		{"Latin script", "ug-Latn", `<spine>`, "ltr"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			info := inspectFiles(t, map[string]string{
+				"OEBPS/content.opf": test.OPF(`<dc:title>Direction</dc:title><dc:language>`+c.language+`</dc:language>`,
+					`<item id="ch1" href="chapter1.xhtml" media-type="application/xhtml+xml"/>`,
+					c.spine+`<itemref idref="ch1"/></spine>`),
+			})
+			if info.PageProgressionDirection != c.expected {
+				t.Errorf("Expected %s, got %q", c.expected, info.PageProgressionDirection)
+			}
+		})
+	}
+
+	info := inspectFiles(t, map[string]string{
+		"OEBPS/content.opf": test.OPF(`<dc:title>Direction</dc:title><dc:language>he</dc:language>`,
+			`<item id="ch1" href="chapter1.xhtml" media-type="application/xhtml+xml"/>`,
+			`<spine page-progression-direction="rlt"><itemref idref="ch1"/></spine>`),
+	})
+	if info.PageProgressionDirection != "rtl" || !strings.Contains(strings.Join(info.Warnings, "\n"), `unknown page-progression-direction "rlt"`) {
+		t.Errorf("Expected the direction of the language and a warning, got %q (%q)", info.PageProgressionDirection, info.Warnings)
+	}
+}
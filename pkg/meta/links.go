@@ -0,0 +1,81 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// maxLinkDocuments is the number of content documents whose hyperlinks are checked.
+const maxLinkDocuments = 1000
+
+// internalLinks counts the internal hyperlinks of the content documents, and the links
+// whose target is not a resource of the package. Only the first maxLinkDocuments documents
+// of the manifest are checked; sampled is then set.
+func (ep *epubFile) internalLinks() (links, broken int, sampled bool) {
+	documents := 0
+	for _, item := range ep.pkg.Manifest {
+		switch item.MediaType {
+		case "application/xhtml+xml", "text/html", "image/svg+xml":
+		default:
+			continue
+		}
+		if documents == maxLinkDocuments {
+			return links, broken, true
+		}
+		documents++
+		name := ep.itemPath(item)
+		data, err := ep.read(name)
+		if err != nil {
+			continue
+		}
+		for _, href := range markupHyperlinks(data) {
+			if !isInternal(href) {
+				continue
+			}
+			links++
+			// a fragment only targets the document itself
+			if target := resolve(name, href); !strings.HasPrefix(href, "#") && ep.files[target] == nil {
+				broken++
+			}
+		}
+	}
+	return links, broken, false
+}
+
+// markupHyperlinks returns the targets of the hyperlinks (a and area elements) of an (X)HTML or SVG document.
+func markupHyperlinks(data []byte) []string {
+	var hrefs []string
+	z := html.NewTokenizer(bytes.NewReader(data))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return hrefs
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			if string(name) != "a" && string(name) != "area" {
+				continue
+			}
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				if string(key) == "href" || string(key) == "xlink:href" {
+					hrefs = append(hrefs, strings.TrimSpace(string(val)))
+				}
+			}
+		}
+	}
+}
+
+// isInternal checks if a hyperlink targets the package: it is relative and not empty.
+func isInternal(href string) bool {
+	if href == "" || strings.HasPrefix(href, "//") {
+		return false
+	}
+	u, err := url.Parse(href)
+	return err == nil && u.Scheme == ""
+}
@@ -0,0 +1,35 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/edrlab/lcp-server/pkg/test"
+)
+
+func TestInternalLinks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.epub")
+	test.WriteEPUB(t, path, map[string]string{
+		"OEBPS/content.opf": test.OPF(`<dc:title>Links</dc:title>`,
+			`<item id="ch1" href="text/chapter1.xhtml" media-type="application/xhtml+xml"/>
+			<item id="ch2" href="text/chapter2.xhtml" media-type="application/xhtml+xml"/>
+			<item id="map" href="images/map.svg" media-type="image/svg+xml"/>`,
+			`<spine><itemref idref="ch1"/><itemref idref="ch2"/></spine>`),
+		"OEBPS/text/chapter1.xhtml": `<html><body>
+<a href="chapter2.xhtml#s1">next</a> <a href="#top">top</a> <a href="../images/map.svg">map</a>
+<a href="missing.xhtml">broken</a> <a href="https://example.com/">remote</a> <a href="mailto:a@example.com">mail</a>
+</body></html>`,
+		"OEBPS/text/chapter2.xhtml": `<html><body><map><area href="chapter%31.xhtml"/></map><a>no target</a></body></html>`,
+		"OEBPS/images/map.svg":      `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink"><a xlink:href="../text/gone.xhtml"><rect/></a></svg>`,
+	})
+
+	m, err := ReadContentMetrics(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.InternalLinks != 6 || m.BrokenInternalLinks != 2 || m.LinksSampled {
+		t.Errorf("Expected 6 internal links, 2 broken, got %d, %d (sampled %v)", m.InternalLinks, m.BrokenInternalLinks, m.LinksSampled)
+	}
+}
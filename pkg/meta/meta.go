@@ -0,0 +1,143 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+// Package meta extracts information from a clear publication, before its encryption.
+// Descriptive metadata can also be read from an encrypted EPUB, as its package document stays clear.
+package meta
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Metadata is the descriptive metadata of a publication.
+type Metadata struct {
+	Title       string
+	Description string
+	Authors     []string
+	Publishers  []string
+	Languages   []string
+}
+
+// Info aggregates the information gathered by the metadata pass.
+type Info struct {
+	Warnings                 []string
+	HasRemoteResources       bool
+	AccessibilityConformance string
+	// AccessibilitySummary is the accessibility summary declared in the package document, empty if none
+	AccessibilitySummary string
+	// AccessibilitySummaries are the variants of the accessibility summary, keyed by language
+	AccessibilitySummaries map[string]string
+	// Published is the publication date declared in the package document, zero if none
+	Published time.Time
+	// Modified is the last modification date declared in the package document, zero if none
+	Modified time.Time
+	// Created is the creation date declared in the package document, else the publication date
+	Created time.Time
+	// AltTitles are the variants of the title in other scripts, keyed by language
+	AltTitles map[string]string
+	// Fingerprint identifies the content of the publication, whatever its packaging
+	Fingerprint string
+	// Identifiers are the identifiers declared in the package document
+	Identifiers []Identifier
+	// PrimaryLanguage is the first language declared in the package document, empty if none
+	PrimaryLanguage string
+	// HasPronunciationData is set if the publication has a PLS lexicon or SSML phonemes
+	HasPronunciationData bool
+	// ContentRating is the age or content rating declared by the publication, empty if none
+	ContentRating string
+	// PageList are the print page equivalents of the publication, in reading order
+	PageList []PageTarget
+	// SpineProperties are the effective rendition properties of the spine items, in reading order
+	SpineProperties []SpineProperties
+	// FixedLayout is set if the package is fixed-layout (rendition:layout pre-paginated), reflowable by default
+	FixedLayout bool
+	// PageProgressionDirection is the direction of the publication, ltr or rtl, ltr by default
+	PageProgressionDirection string
+	// ResourceCounts are the numbers of resources of the manifest, by type (documents, images, audio, etc.)
+	ResourceCounts map[string]int
+}
+
+// Inspect runs the metadata pass on the EPUB file at path. Accessibility summaries are truncated
+// to maxSummaryLength characters (DefaultMaxSummaryLength if 0).
+func Inspect(path string, maxSummaryLength int) (*Info, error) {
+	if maxSummaryLength <= 0 {
+		maxSummaryLength = DefaultMaxSummaryLength
+	}
+	ep, err := openEPUB(path)
+	if err != nil {
+		return nil, err
+	}
+	defer ep.Close()
+
+	info := &Info{
+		AccessibilityConformance: ep.accessibilityConformance(),
+		AltTitles:                ep.altTitles(),
+		Published:                ep.publicationDate(),
+		Identifiers:              ep.identifiers(),
+		ContentRating:            ep.contentRating(),
+		PrimaryLanguage:          ep.primaryLanguage(),
+		HasPronunciationData:     ep.hasPronunciationData(),
+		PageList:                 ep.pageList(),
+		ResourceCounts:           ep.resourceCounts(),
+	}
+	var truncated bool
+	info.AccessibilitySummary, info.AccessibilitySummaries, truncated = ep.accessibilitySummaries(maxSummaryLength)
+	if truncated {
+		info.Warnings = append(info.Warnings, fmt.Sprintf("accessibility summary truncated to %d characters", maxSummaryLength))
+	}
+	rendition := ep.renditionProperties(info)
+	info.FixedLayout = rendition["layout"] == "pre-paginated"
+	info.SpineProperties = ep.spineProperties(rendition, info)
+	info.PageProgressionDirection = ep.pageProgressionDirection(info)
+	info.Modified = ep.modificationDate(info)
+	info.Created = ep.creationDate(info)
+	checkRemoteResources(ep, info)
+	fp, err := ep.fingerprint()
+	if err != nil {
+		return nil, err
+	}
+	info.Fingerprint = fp
+	return info, nil
+}
+
+// ReadMetadata returns the descriptive metadata of the EPUB file at path.
+func ReadMetadata(path string) (*Metadata, error) {
+	ep, err := openEPUB(path)
+	if err != nil {
+		return nil, err
+	}
+	defer ep.Close()
+	return ep.metadata(), nil
+}
+
+// metadata extracts the descriptive metadata from the package document.
+func (ep *epubFile) metadata() *Metadata {
+	m := ep.pkg.Metadata
+	md := &Metadata{
+		Description: strings.TrimSpace(m.Description),
+		Authors:     trimAll(m.Creators),
+		Publishers:  trimAll(m.Publishers),
+		Languages:   trimAll(m.Languages),
+	}
+	if titles := trimAll(m.titles()); len(titles) > 0 {
+		md.Title = titles[0]
+	}
+	return md
+}
+
+// trimAll trims the values of a list and removes empty ones.
+func trimAll(values []string) []string {
+	var res []string
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// warn adds a warning to the info.
+func (info *Info) warn(msg string) {
+	info.Warnings = append(info.Warnings, msg)
+}
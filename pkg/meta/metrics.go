@@ -0,0 +1,200 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"path/filepath"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// DefaultWordsPerMinute is the average silent reading speed used for estimating reading times.
+const DefaultWordsPerMinute = 250
+
+// rwpManifest is the manifest of a Readium Web Publication (audiobook)
+const rwpManifest = "manifest.json"
+
+// ContentMetrics are statistics on the content of a publication.
+// Values are zero when they cannot be computed.
+type ContentMetrics struct {
+	WordCount                int `json:"word_count"`
+	EstimatedDurationSeconds int `json:"estimated_duration_seconds"`
+	// Images are the raster images of the publication, with their dimensions
+	Images []ImageInfo `json:"images,omitempty"`
+	// ImageCount is the number of raster images; if it exceeds maxImages, Images is a sample
+	ImageCount    int  `json:"image_count,omitempty"`
+	ImagesSampled bool `json:"images_sampled,omitempty"`
+	// InternalLinks counts the hyperlinks between the resources of an EPUB, BrokenInternalLinks
+	// those whose target is missing; LinksSampled is set if only part of the documents are checked
+	InternalLinks       int  `json:"internal_links"`
+	BrokenInternalLinks int  `json:"broken_internal_links"`
+	LinksSampled        bool `json:"links_sampled,omitempty"`
+}
+
+// ReadContentMetrics computes the content metrics of the publication at path:
+// the reading time of an EPUB is estimated from the word count of its spine documents,
+// at wordsPerMinute (DefaultWordsPerMinute if 0); the duration of an audiobook is the sum
+// of the durations declared for its tracks. The raster images of EPUBs and Readium Packages
+// are listed with their dimensions. The internal hyperlinks of EPUBs are counted, with those
+// whose target is missing.
+func ReadContentMetrics(path string, wordsPerMinute int) (*ContentMetrics, error) {
+	if wordsPerMinute <= 0 {
+		wordsPerMinute = DefaultWordsPerMinute
+	}
+	metrics := &ContentMetrics{}
+	switch filepath.Ext(path) {
+	case ".epub":
+		ep, err := openEPUB(path)
+		if err != nil {
+			return nil, err
+		}
+		defer ep.Close()
+		words := ep.wordCount()
+		metrics.WordCount = words
+		metrics.EstimatedDurationSeconds = words * 60 / wordsPerMinute
+		paths := ep.imagePaths()
+		metrics.ImageCount = len(paths)
+		metrics.Images, metrics.ImagesSampled = readImages(ep.open, paths)
+		metrics.InternalLinks, metrics.BrokenInternalLinks, metrics.LinksSampled = ep.internalLinks()
+	case ".audiobook", ".divina", ".webpub", ".rpf":
+		if filepath.Ext(path) == ".audiobook" {
+			seconds, err := audiobookDuration(path)
+			if err != nil {
+				return nil, err
+			}
+			metrics.EstimatedDurationSeconds = seconds
+		}
+		zr, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		paths, err := packageImagePaths(&zr.Reader)
+		if err != nil {
+			return nil, err
+		}
+		metrics.ImageCount = len(paths)
+		metrics.Images, metrics.ImagesSampled = readImages(func(name string) (io.ReadCloser, error) {
+			return zr.Open(name)
+		}, paths)
+	}
+	return metrics, nil
+}
+
+// wordCount counts the words of the documents of the spine.
+func (ep *epubFile) wordCount() int {
+	count := 0
+	for _, itemref := range ep.pkg.Spine.Itemrefs {
+		item, ok := ep.item(itemref.IDRef)
+		if !ok {
+			continue
+		}
+		switch item.MediaType {
+		case "application/xhtml+xml", "text/html":
+		default:
+			continue
+		}
+		if data, err := ep.read(ep.itemPath(item)); err == nil {
+			count += markupWordCount(data)
+		}
+	}
+	return count
+}
+
+// markupWordCount counts the words of the body of an (X)HTML document.
+// Ideographs and kana, written without spaces, count as one word each.
+func markupWordCount(data []byte) int {
+	count := 0
+	inBody, skip := false, 0
+	z := html.NewTokenizer(bytes.NewReader(data))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return count
+		case html.StartTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "body":
+				inBody = true
+			case "script", "style":
+				skip++
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "script", "style":
+				if skip > 0 {
+					skip--
+				}
+			}
+		case html.TextToken:
+			if inBody && skip == 0 {
+				count += textWordCount(z.Text())
+			}
+		}
+	}
+}
+
+// textWordCount counts the words of a text.
+func textWordCount(text []byte) int {
+	count := 0
+	inWord := false
+	for _, r := range string(text) {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana):
+			count++
+			inWord = false
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if !inWord {
+				count++
+				inWord = true
+			}
+		case r == '\'' || r == '’' || r == '-':
+			// inside a word
+		default:
+			inWord = false
+		}
+	}
+	return count
+}
+
+// audiobookDuration sums the durations (in seconds) of the reading order of an audiobook.
+// If tracks have no duration, the duration of the publication is used.
+func audiobookDuration(path string) (int, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return 0, err
+	}
+	defer zr.Close()
+	f, err := zr.Open(rwpManifest)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var manifest struct {
+		Metadata struct {
+			Duration float64 `json:"duration"`
+		} `json:"metadata"`
+		ReadingOrder []struct {
+			Duration float64 `json:"duration"`
+		} `json:"readingOrder"`
+	}
+	if err := json.NewDecoder(f).Decode(&manifest); err != nil {
+		return 0, err
+	}
+	total := 0.0
+	for _, link := range manifest.ReadingOrder {
+		total += link.Duration
+	}
+	if total == 0 {
+		total = manifest.Metadata.Duration
+	}
+	return int(math.Round(total)), nil
+}
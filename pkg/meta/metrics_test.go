@@ -0,0 +1,97 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/edrlab/lcp-server/pkg/test"
+)
+
+func TestTextWordCount(t *testing.T) {
+	cases := []struct {
+		text  string
+		count int
+	}{
+		{"", 0},
+		{"Hello, world!", 2},
+		{"  l'été   well-known 2025 ", 3},
+		{"吾輩は猫である", 7},
+		{"LCP で保護", 4},
+	}
+	for _, c := range cases {
+		if got := textWordCount([]byte(c.text)); got != c.count {
+			t.Errorf("%q: expected %d words, got %d", c.text, c.count, got)
+		}
+	}
+}
+
+func TestMarkupWordCount(t *testing.T) {
+	doc := `<html><head><title>Not counted</title><style>p { color: red }</style></head>
+<body><h1>One two</h1><p>three <em>four</em></p><script>var notCounted = 1;</script></body></html>`
+	if got := markupWordCount([]byte(doc)); got != 4 {
+		t.Errorf("Expected 4 words, got %d", got)
+	}
+}
+
+func TestReadContentMetricsEPUB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.epub")
+	test.WriteEPUB(t, path, map[string]string{
+		"OEBPS/content.opf": test.OPF(`<dc:title>Metrics</dc:title>`,
+			`<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+			<item id="ch1" href="chapter1.xhtml" media-type="application/xhtml+xml"/>
+			<item id="ch2" href="chapter2.xhtml" media-type="application/xhtml+xml"/>`,
+			`<spine><itemref idref="ch1"/><itemref idref="ch2"/></spine>`),
+		// not in the spine
+		"OEBPS/nav.xhtml":      `<html><body><nav>One two three</nav></body></html>`,
+		"OEBPS/chapter1.xhtml": `<html><body><p>one two three four five</p></body></html>`,
+		"OEBPS/chapter2.xhtml": `<html><body><p>six seven eight nine ten</p></body></html>`,
+	})
+
+	m, err := ReadContentMetrics(path, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.WordCount != 10 || m.EstimatedDurationSeconds != 30 {
+		t.Errorf("Expected 10 words and 30 seconds, got %+v", m)
+	}
+}
+
+func TestReadContentMetricsAudiobook(t *testing.T) {
+	cases := []struct {
+		manifest string
+		seconds  int
+	}{
+		{`{"metadata":{"duration":100},"readingOrder":[{"href":"1.mp3","duration":60.4},{"href":"2.mp3","duration":30.3}]}`, 91},
+		{`{"metadata":{"duration":100},"readingOrder":[{"href":"1.mp3"}]}`, 100},
+		{`{"metadata":{},"readingOrder":[{"href":"1.mp3"}]}`, 0},
+	}
+	for _, c := range cases {
+		path := writeZip(t, [][2]string{{"manifest.json", c.manifest}}, zip.Deflate, time.Now())
+		audiobook := path[:len(path)-len(".epub")] + ".audiobook"
+		if err := os.Rename(path, audiobook); err != nil {
+			t.Fatal(err)
+		}
+		m, err := ReadContentMetrics(audiobook, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.WordCount != 0 || m.EstimatedDurationSeconds != c.seconds {
+			t.Errorf("Expected %d seconds, got %+v", c.seconds, m)
+		}
+	}
+}
+
+func TestReadContentMetricsOther(t *testing.T) {
+	m, err := ReadContentMetrics("test.pdf", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.WordCount != 0 || m.EstimatedDurationSeconds != 0 {
+		t.Errorf("Expected no metrics, got %+v", m)
+	}
+}
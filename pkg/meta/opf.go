@@ -0,0 +1,217 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+const containerFile = "META-INF/container.xml"
+
+// container is the structure of META-INF/container.xml
+type container struct {
+	Rootfiles []struct {
+		FullPath  string `xml:"full-path,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+// opfPackage is the structure of the package document.
+// Elements are matched by local name, whatever their namespace.
+type opfPackage struct {
+	Version  string         `xml:"version,attr"`
+	Metadata opfMetadata    `xml:"metadata"`
+	Manifest []opfItem      `xml:"manifest>item"`
+	Spine    opfSpine       `xml:"spine"`
+	Guide    []opfReference `xml:"guide>reference"`
+}
+
+// opfMetadata is the package metadata
+type opfMetadata struct {
+	Identifiers []opfIdentifier `xml:"identifier"`
+	Titles      []opfTitle      `xml:"title"`
+	Creators    []string        `xml:"creator"`
+	Publishers  []string        `xml:"publisher"`
+	Description string          `xml:"description"`
+	Dates       []opfDate       `xml:"date"`
+	Languages   []string        `xml:"language"`
+	ConformsTo  []string        `xml:"conformsTo"`
+	Metas       []opfMeta       `xml:"meta"`
+	Links       []opfLink       `xml:"link"`
+}
+
+// opfIdentifier is a dc:identifier element; EPUB 2 may declare its scheme in an attribute
+type opfIdentifier struct {
+	ID     string `xml:"id,attr"`
+	Scheme string `xml:"scheme,attr"`
+	Value  string `xml:",chardata"`
+}
+
+// opfTitle is a dc:title element
+type opfTitle struct {
+	ID    string `xml:"id,attr"`
+	Value string `xml:",chardata"`
+}
+
+// opfDate is a dc:date element; EPUB 2 qualifies dates with an event
+type opfDate struct {
+	Event string `xml:"event,attr"`
+	Value string `xml:",chardata"`
+}
+
+// opfMeta is an EPUB 3 (property) or EPUB 2 (name / content) meta element
+type opfMeta struct {
+	Property string `xml:"property,attr"`
+	Refines  string `xml:"refines,attr"`
+	Name     string `xml:"name,attr"`
+	Content  string `xml:"content,attr"`
+	Scheme   string `xml:"scheme,attr"`
+	Lang     string `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+	Value    string `xml:",chardata"`
+}
+
+// opfLink is a metadata link element
+type opfLink struct {
+	Rel  string `xml:"rel,attr"`
+	Href string `xml:"href,attr"`
+}
+
+// opfItem is a manifest item
+type opfItem struct {
+	ID         string `xml:"id,attr"`
+	Href       string `xml:"href,attr"`
+	MediaType  string `xml:"media-type,attr"`
+	Properties string `xml:"properties,attr"`
+}
+
+// opfSpine is the default reading order
+type opfSpine struct {
+	PageProgressionDirection string       `xml:"page-progression-direction,attr"`
+	Itemrefs                 []opfItemref `xml:"itemref"`
+}
+
+// opfItemref is a spine item
+type opfItemref struct {
+	IDRef      string `xml:"idref,attr"`
+	Linear     string `xml:"linear,attr"`
+	Properties string `xml:"properties,attr"`
+}
+
+// opfReference is an EPUB 2 guide reference
+type opfReference struct {
+	Type string `xml:"type,attr"`
+	Href string `xml:"href,attr"`
+}
+
+// epubFile gives access to the resources and package document of an EPUB.
+type epubFile struct {
+	zr       *zip.ReadCloser
+	files    map[string]*zip.File
+	opfPath  string
+	basePath string
+	pkg      opfPackage
+}
+
+// openEPUB opens an EPUB file and parses its first package document.
+func openEPUB(name string) (*epubFile, error) {
+	zr, err := zip.OpenReader(name)
+	if err != nil {
+		return nil, err
+	}
+	ep := &epubFile{zr: zr, files: make(map[string]*zip.File)}
+	for _, f := range zr.File {
+		ep.files[f.Name] = f
+	}
+
+	var c container
+	if err := ep.decodeXML(containerFile, &c); err != nil {
+		zr.Close()
+		return nil, err
+	}
+	if len(c.Rootfiles) == 0 {
+		zr.Close()
+		return nil, errors.New("no package document declared in the container file")
+	}
+	ep.opfPath = c.Rootfiles[0].FullPath
+	ep.basePath = path.Dir(ep.opfPath)
+	if err := ep.decodeXML(ep.opfPath, &ep.pkg); err != nil {
+		zr.Close()
+		return nil, err
+	}
+	return ep, nil
+}
+
+// Close closes the underlying zip file.
+func (ep *epubFile) Close() error {
+	return ep.zr.Close()
+}
+
+// open opens a resource of the EPUB, from its path in the container.
+func (ep *epubFile) open(name string) (io.ReadCloser, error) {
+	f, ok := ep.files[name]
+	if !ok {
+		return nil, errors.New("resource not found: " + name)
+	}
+	return f.Open()
+}
+
+// read returns the content of a resource of the EPUB.
+func (ep *epubFile) read(name string) ([]byte, error) {
+	rc, err := ep.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// decodeXML parses an XML resource of the EPUB into v.
+func (ep *epubFile) decodeXML(name string, v any) error {
+	rc, err := ep.open(name)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	xd := xml.NewDecoder(rc)
+	// deal with non utf-8 xml files
+	xd.CharsetReader = charset.NewReaderLabel
+	return xd.Decode(v)
+}
+
+// resolve returns the path in the container of a reference found in a resource,
+// without its fragment. The reference is relative to the resource path.
+func resolve(from, ref string) string {
+	if i := strings.IndexByte(ref, '#'); i >= 0 {
+		ref = ref[:i]
+	}
+	if unescaped, err := url.PathUnescape(ref); err == nil {
+		ref = unescaped
+	}
+	if strings.HasPrefix(ref, "/") {
+		return strings.TrimPrefix(path.Clean(ref), "/")
+	}
+	return path.Join(path.Dir(from), ref)
+}
+
+// item returns the manifest item with the given id.
+func (ep *epubFile) item(id string) (opfItem, bool) {
+	for _, item := range ep.pkg.Manifest {
+		if item.ID == id {
+			return item, true
+		}
+	}
+	return opfItem{}, false
+}
+
+// itemPath returns the path in the container of a manifest item.
+func (ep *epubFile) itemPath(item opfItem) string {
+	return resolve(ep.opfPath, item.Href)
+}
@@ -0,0 +1,162 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Media types of the EPUB 2 navigation documents listing the print pages
+const (
+	ncxMediaType     = "application/x-dtbncx+xml"
+	pageMapMediaType = "application/oebps-page-map+xml"
+)
+
+// PageTarget is a print page equivalent of an EPUB: the label of the page in the print
+// edition, and the location of its start, as a path in the container with a fragment.
+type PageTarget struct {
+	Label string `json:"label"`
+	Href  string `json:"href"`
+}
+
+// pageList returns the print page equivalents of the publication, in reading order:
+// the page-list nav of an EPUB 3, else the page list of the NCX or the page map of an EPUB 2.
+func (ep *epubFile) pageList() []PageTarget {
+	for _, item := range ep.pkg.Manifest {
+		if !slices.Contains(strings.Fields(item.Properties), "nav") {
+			continue
+		}
+		name := ep.itemPath(item)
+		if data, err := ep.read(name); err == nil {
+			if pages := navPageList(data, name); len(pages) > 0 {
+				return pages
+			}
+		}
+	}
+	for _, item := range ep.pkg.Manifest {
+		var pages []PageTarget
+		switch item.MediaType {
+		case ncxMediaType:
+			pages = ep.ncxPageList(ep.itemPath(item))
+		case pageMapMediaType:
+			pages = ep.pageMap(ep.itemPath(item))
+		}
+		if len(pages) > 0 {
+			return pages
+		}
+	}
+	return nil
+}
+
+// navPageList returns the links of the page-list nav element of the navigation document at name.
+func navPageList(data []byte, name string) []PageTarget {
+	var pages []PageTarget
+	depth := 0 // of nav elements, inside the page list
+	var page *PageTarget
+	z := html.NewTokenizer(bytes.NewReader(data))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return pages
+		case html.StartTagToken:
+			tag, _ := z.TagName()
+			switch string(tag) {
+			case "nav":
+				if depth > 0 || slices.Contains(strings.Fields(tagAttr(z, "epub:type")), "page-list") {
+					depth++
+				}
+			case "a":
+				if href := tagAttr(z, "href"); depth > 0 && href != "" {
+					page = &PageTarget{Href: resolveFragment(name, href)}
+				}
+			}
+		case html.TextToken:
+			if page != nil {
+				page.Label += string(z.Text())
+			}
+		case html.EndTagToken:
+			tag, _ := z.TagName()
+			switch string(tag) {
+			case "nav":
+				if depth > 0 {
+					depth--
+				}
+			case "a":
+				if page != nil {
+					page.Label = strings.Join(strings.Fields(page.Label), " ")
+					pages = append(pages, *page)
+					page = nil
+				}
+			}
+		}
+	}
+}
+
+// tagAttr returns the value of an attribute of the current tag of a tokenizer.
+// It must be called once per tag, as it consumes the attributes.
+func tagAttr(z *html.Tokenizer, name string) string {
+	for {
+		key, val, more := z.TagAttr()
+		if string(key) == name {
+			return string(val)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// ncxPageList returns the page targets of the NCX document at name.
+func (ep *epubFile) ncxPageList(name string) []PageTarget {
+	var ncx struct {
+		PageTargets []struct {
+			Label   string `xml:"navLabel>text"`
+			Content struct {
+				Src string `xml:"src,attr"`
+			} `xml:"content"`
+		} `xml:"pageList>pageTarget"`
+	}
+	if err := ep.decodeXML(name, &ncx); err != nil {
+		return nil
+	}
+	var pages []PageTarget
+	for _, pt := range ncx.PageTargets {
+		if pt.Content.Src != "" {
+			pages = append(pages, PageTarget{Label: strings.TrimSpace(pt.Label), Href: resolveFragment(name, pt.Content.Src)})
+		}
+	}
+	return pages
+}
+
+// pageMap returns the pages of the (Adobe) page map document at name.
+func (ep *epubFile) pageMap(name string) []PageTarget {
+	var pm struct {
+		Pages []struct {
+			Name string `xml:"name,attr"`
+			Href string `xml:"href,attr"`
+		} `xml:"page"`
+	}
+	if err := ep.decodeXML(name, &pm); err != nil {
+		return nil
+	}
+	var pages []PageTarget
+	for _, p := range pm.Pages {
+		if p.Href != "" {
+			pages = append(pages, PageTarget{Label: strings.TrimSpace(p.Name), Href: resolveFragment(name, p.Href)})
+		}
+	}
+	return pages
+}
+
+// resolveFragment resolves a reference like resolve, keeping its fragment.
+func resolveFragment(from, ref string) string {
+	fragment := ""
+	if i := strings.IndexByte(ref, '#'); i >= 0 {
+		fragment = ref[i:]
+	}
+	return resolve(from, ref) + fragment
+}
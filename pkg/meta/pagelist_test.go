@@ -0,0 +1,59 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/edrlab/lcp-server/pkg/test"
+)
+
+func TestPageList(t *testing.T) {
+	expected := []PageTarget{
+		{Label: "i", Href: "OEBPS/text/front.xhtml#pi"},
+		{Label: "42", Href: "OEBPS/text/chapter1.xhtml#p42"},
+	}
+	cases := []struct {
+		name     string
+		files    map[string]string
+		expected []PageTarget
+	}{
+		{"none", map[string]string{
+			"OEBPS/content.opf": test.OPF(`<dc:title>Pages</dc:title>`,
+				`<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>`, `<spine/>`),
+			"OEBPS/nav.xhtml": `<html><body><nav epub:type="toc"><ol><li><a href="text/chapter1.xhtml">Chapter</a></li></ol></nav></body></html>`,
+		}, nil},
+		{"EPUB 3 nav", map[string]string{
+			"OEBPS/content.opf": test.OPF(`<dc:title>Pages</dc:title>`,
+				`<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>`, `<spine/>`),
+			"OEBPS/nav.xhtml": `<html xmlns:epub="http://www.idpf.org/2007/ops"><body>
+				<nav epub:type="toc"><ol><li><a href="text/chapter1.xhtml">Chapter</a></li></ol></nav>
+				<nav epub:type="page-list" hidden=""><ol>
+					<li><a href="text/front.xhtml#pi">i</a></li>
+					<li><a href="text/chapter1.xhtml#p42"><span>4</span>2</a></li>
+				</ol></nav></body></html>`,
+		}, expected},
+		{"NCX", map[string]string{
+			"OEBPS/content.opf": test.OPF(`<dc:title>Pages</dc:title>`,
+				`<item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>`, `<spine toc="ncx"/>`),
+			"OEBPS/toc.ncx": `<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/"><pageList>
+				<pageTarget type="front" value="1"><navLabel><text>i</text></navLabel><content src="text/front.xhtml#pi"/></pageTarget>
+				<pageTarget type="normal" value="42"><navLabel><text> 42 </text></navLabel><content src="text/chapter1.xhtml#p42"/></pageTarget>
+			</pageList></ncx>`,
+		}, expected},
+		{"page map", map[string]string{
+			"OEBPS/content.opf": test.OPF(`<dc:title>Pages</dc:title>`,
+				`<item id="map" href="page-map.xml" media-type="application/oebps-page-map+xml"/>`, `<spine page-map="map"/>`),
+			"OEBPS/page-map.xml": `<page-map xmlns="http://www.idpf.org/2007/opf">
+				<page name="i" href="text/front.xhtml#pi"/><page name="42" href="text/chapter1.xhtml#p42"/></page-map>`,
+		}, expected},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := inspectFiles(t, c.files).PageList; !slices.Equal(got, c.expected) {
+				t.Errorf("Expected %+v, got %+v", c.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import "strings"
+
+// Properties declaring the content rating of a publication
+var ratingProperties = []string{"schema:contentRating", "contentRating"}
+
+// contentRating returns the content rating declared by the publication, e.g. "PG-13", or an empty string.
+// The rating is declared with the schema.org contentRating property, in an EPUB 3 meta property
+// or an EPUB 2 meta name / content.
+func (ep *epubFile) contentRating() string {
+	for _, mt := range ep.pkg.Metadata.Metas {
+		for _, p := range ratingProperties {
+			if mt.Property == p && mt.Refines == "" {
+				if v := strings.TrimSpace(mt.Value); v != "" {
+					return v
+				}
+			}
+			if mt.Name == p {
+				if v := strings.TrimSpace(mt.Content); v != "" {
+					return v
+				}
+			}
+		}
+	}
+	return ""
+}
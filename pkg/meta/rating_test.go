@@ -0,0 +1,32 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/edrlab/lcp-server/pkg/test"
+)
+
+func TestContentRating(t *testing.T) {
+	cases := map[string]string{
+		`<meta property="schema:contentRating"> PG-13 </meta>`:        "PG-13",
+		`<meta name="schema:contentRating" content="Teen"/>`:          "Teen",
+		`<meta property="schema:contentRating" refines="#t">X</meta>`: "",
+		``: "",
+	}
+	for metadata, expected := range cases {
+		path := filepath.Join(t.TempDir(), "test.epub")
+		test.WriteEPUB(t, path, map[string]string{
+			"OEBPS/content.opf": test.OPF(`<dc:title>Rating</dc:title>`+metadata, ``, `<spine/>`),
+		})
+		info, err := Inspect(path, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.ContentRating != expected {
+			t.Errorf("%s: expected %q, got %q", metadata, expected, info.ContentRating)
+		}
+	}
+}
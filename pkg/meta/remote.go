@@ -0,0 +1,134 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// maxRemoteWarnings limits the number of warnings relative to remote resources,
+// as the response metadata is returned in an HTTP header.
+const maxRemoteWarnings = 20
+
+// CSS references: url(...) and @import "..."
+var cssURLRegexp = regexp.MustCompile(`url\(\s*['"]?([^'")\s]+)|@import\s+['"]([^'"]+)['"]`)
+
+// checkRemoteResources looks for remote (non-relative) references to resources,
+// in the manifest and in content documents and style sheets.
+// Hyperlinks (a@href) are not resources and are ignored.
+func checkRemoteResources(ep *epubFile, info *Info) {
+	var remotes []string
+	seen := make(map[string]bool)
+	add := func(from, ref string) {
+		if !isRemote(ref) || seen[ref] {
+			return
+		}
+		seen[ref] = true
+		remotes = append(remotes, fmt.Sprintf("remote resource referenced in %s: %s", from, ref))
+	}
+
+	for _, item := range ep.pkg.Manifest {
+		if isRemote(item.Href) {
+			add(ep.opfPath, item.Href)
+			continue
+		}
+		name := ep.itemPath(item)
+		switch item.MediaType {
+		case "application/xhtml+xml", "text/html", "image/svg+xml":
+			if data, err := ep.read(name); err == nil {
+				for _, ref := range markupResourceRefs(data) {
+					add(name, ref)
+				}
+			}
+		case "text/css":
+			if data, err := ep.read(name); err == nil {
+				for _, ref := range cssResourceRefs(string(data)) {
+					add(name, ref)
+				}
+			}
+		}
+	}
+
+	if len(remotes) == 0 {
+		return
+	}
+	info.HasRemoteResources = true
+	for i, msg := range remotes {
+		if i == maxRemoteWarnings {
+			info.warn(fmt.Sprintf("%d more remote resources", len(remotes)-maxRemoteWarnings))
+			break
+		}
+		info.warn(msg)
+	}
+}
+
+// markupResourceRefs returns the references to resources found in an (X)HTML or SVG document.
+func markupResourceRefs(data []byte) []string {
+	var refs []string
+	z := html.NewTokenizer(bytes.NewReader(data))
+	inStyle := false
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return refs
+		case html.TextToken:
+			if inStyle {
+				refs = append(refs, cssResourceRefs(string(z.Text()))...)
+			}
+		case html.EndTagToken:
+			inStyle = false
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			inStyle = tok.Data == "style"
+			for _, attr := range tok.Attr {
+				switch attr.Key {
+				case "src", "poster", "data":
+					refs = append(refs, attr.Val)
+				case "href", "xlink:href":
+					// hyperlinks are not resources
+					if tok.Data != "a" {
+						refs = append(refs, attr.Val)
+					}
+				case "style":
+					refs = append(refs, cssResourceRefs(attr.Val)...)
+				}
+			}
+		}
+	}
+}
+
+// cssResourceRefs returns the references to resources found in a style sheet.
+func cssResourceRefs(css string) []string {
+	var refs []string
+	for _, m := range cssURLRegexp.FindAllStringSubmatch(css, -1) {
+		if m[1] != "" {
+			refs = append(refs, m[1])
+		} else {
+			refs = append(refs, m[2])
+		}
+	}
+	return refs
+}
+
+// isRemote checks if a reference is an absolute URL pointing outside the package.
+func isRemote(ref string) bool {
+	ref = strings.TrimSpace(ref)
+	if strings.HasPrefix(ref, "//") {
+		return true
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "ftp":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/edrlab/lcp-server/pkg/test"
+)
+
+// inspectFiles runs the metadata pass on an EPUB made of the given files.
+func inspectFiles(t *testing.T, files map[string]string) *Info {
+	path := filepath.Join(t.TempDir(), "test.epub")
+	test.WriteEPUB(t, path, files)
+	info, err := Inspect(path, 0)
+	if err != nil {
+		t.Fatalf("Inspect failed: %v", err)
+	}
+	return info
+}
+
+func TestNoRemoteResources(t *testing.T) {
+	info := inspectFiles(t, map[string]string{
+		"OEBPS/nav.xhtml":      `<html><body><nav><a href="chapter1.xhtml">Chapter</a></nav></body></html>`,
+		"OEBPS/chapter1.xhtml": `<html><body><p>See <a href="https://example.com">the site</a>.</p><img src="images/pic.png"/><img src="data:image/png;base64,AAAA"/></body></html>`,
+	})
+	if info.HasRemoteResources {
+		t.Errorf("Unexpected remote resources: %v", info.Warnings)
+	}
+	if len(info.Warnings) != 0 {
+		t.Errorf("Unexpected warnings: %v", info.Warnings)
+	}
+}
+
+func TestRemoteResources(t *testing.T) {
+	opf := test.OPF(`<dc:title>Remote</dc:title>`,
+		`<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+		<item id="ch1" href="chapter1.xhtml" media-type="application/xhtml+xml" properties="remote-resources"/>
+		<item id="css" href="style.css" media-type="text/css"/>
+		<item id="audio" href="https://cdn.example.com/track.mp3" media-type="audio/mpeg"/>`,
+		`<spine><itemref idref="ch1"/></spine>`)
+	info := inspectFiles(t, map[string]string{
+		"OEBPS/content.opf": opf,
+		"OEBPS/nav.xhtml":   `<html><body><nav><a href="chapter1.xhtml">Chapter</a></nav></body></html>`,
+		"OEBPS/chapter1.xhtml": `<html><head><link rel="stylesheet" href="//fonts.example.com/css"/>
+			<style>body { background: url("http://img.example.com/bg.jpg"); }</style></head>
+			<body><img src="https://img.example.com/pic.png"/></body></html>`,
+		"OEBPS/style.css": `@import "https://fonts.example.com/font.css"; p { font-family: local; }`,
+	})
+	if !info.HasRemoteResources {
+		t.Fatal("Remote resources not detected")
+	}
+	expected := []string{
+		"https://cdn.example.com/track.mp3",
+		"//fonts.example.com/css",
+		"http://img.example.com/bg.jpg",
+		"https://img.example.com/pic.png",
+		"https://fonts.example.com/font.css",
+	}
+	if len(info.Warnings) != len(expected) {
+		t.Fatalf("Expected %d warnings, got %v", len(expected), info.Warnings)
+	}
+	all := strings.Join(info.Warnings, "\n")
+	for _, ref := range expected {
+		if !strings.Contains(all, ref) {
+			t.Errorf("Missing warning for %s", ref)
+		}
+	}
+}
+
+func TestRemoteResourcesLimit(t *testing.T) {
+	var body strings.Builder
+	for i := 0; i < maxRemoteWarnings+5; i++ {
+		body.WriteString(`<img src="https://img.example.com/` + strings.Repeat("x", i+1) + `.png"/>`)
+	}
+	info := inspectFiles(t, map[string]string{
+		"OEBPS/chapter1.xhtml": "<html><body>" + body.String() + "</body></html>",
+	})
+	if len(info.Warnings) != maxRemoteWarnings+1 {
+		t.Errorf("Expected %d warnings, got %d", maxRemoteWarnings+1, len(info.Warnings))
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// SpineProperties are the effective rendition properties of a spine item: the global
+// rendition properties of the package, overridden by the properties of the item.
+type SpineProperties struct {
+	Href        string `json:"href"` // path in the container
+	Layout      string `json:"layout"`
+	Orientation string `json:"orientation"`
+	Spread      string `json:"spread"`
+	Flow        string `json:"flow"`
+	// PageSpread is the side of the spread where the item is rendered: left, right or center
+	PageSpread string `json:"page_spread,omitempty"`
+}
+
+// maxRenditionWarnings limits the number of warnings relative to unknown rendition properties,
+// as the response metadata is returned in an HTTP header.
+const maxRenditionWarnings = 20
+
+// renditionValues are the known values of the rendition properties, the default value first.
+var renditionValues = map[string][]string{
+	"layout":      {"reflowable", "pre-paginated"},
+	"orientation": {"auto", "landscape", "portrait"},
+	"spread":      {"auto", "none", "landscape", "portrait", "both"},
+	"flow":        {"auto", "paginated", "scrolled-continuous", "scrolled-doc"},
+}
+
+// renditionProperties returns the global rendition properties of the package, by name, defaulted
+// when unspecified. Unknown values are reported as warnings and ignored.
+func (ep *epubFile) renditionProperties(info *Info) map[string]string {
+	var unknown []string
+	global := make(map[string]string)
+	for name, values := range renditionValues {
+		global[name] = values[0]
+	}
+	for _, mt := range ep.pkg.Metadata.Metas {
+		name, ok := strings.CutPrefix(mt.Property, "rendition:")
+		if !ok || mt.Refines != "" {
+			continue
+		}
+		values, known := renditionValues[name]
+		if !known {
+			continue
+		}
+		if v := strings.TrimSpace(mt.Value); slices.Contains(values, v) {
+			global[name] = v
+		} else {
+			unknown = append(unknown, fmt.Sprintf("unknown value %q of rendition:%s", v, name))
+		}
+	}
+	warnUnknownRendition(info, unknown)
+	return global
+}
+
+// spineProperties returns the effective rendition properties of the items of the spine, in reading order.
+// Unknown rendition properties of an item are reported as warnings and ignored.
+func (ep *epubFile) spineProperties(global map[string]string, info *Info) []SpineProperties {
+	var props []SpineProperties
+	var unknown []string
+	for _, itemref := range ep.pkg.Spine.Itemrefs {
+		item, ok := ep.item(itemref.IDRef)
+		if !ok {
+			continue
+		}
+		p := SpineProperties{
+			Href:        ep.itemPath(item),
+			Layout:      global["layout"],
+			Orientation: global["orientation"],
+			Spread:      global["spread"],
+			Flow:        global["flow"],
+		}
+		for _, property := range strings.Fields(itemref.Properties) {
+			if !p.override(property) && strings.HasPrefix(property, "rendition:") {
+				unknown = append(unknown, fmt.Sprintf("unknown spine property %q of %s", property, p.Href))
+			}
+		}
+		props = append(props, p)
+	}
+	warnUnknownRendition(info, unknown)
+	return props
+}
+
+// warnUnknownRendition reports unknown rendition properties as warnings, up to maxRenditionWarnings.
+func warnUnknownRendition(info *Info, unknown []string) {
+	for i, msg := range unknown {
+		if i == maxRenditionWarnings {
+			info.warn(fmt.Sprintf("%d more unknown rendition properties", len(unknown)-maxRenditionWarnings))
+			break
+		}
+		info.warn(msg)
+	}
+}
+
+// override applies a spine item property, e.g. rendition:layout-pre-paginated or page-spread-left.
+// It returns false if the property is not a known rendition property.
+func (p *SpineProperties) override(property string) bool {
+	switch property {
+	case "page-spread-left", "rendition:page-spread-left":
+		p.PageSpread = "left"
+		return true
+	case "page-spread-right", "rendition:page-spread-right":
+		p.PageSpread = "right"
+		return true
+	case "rendition:page-spread-center":
+		p.PageSpread = "center"
+		return true
+	}
+	for name, values := range renditionValues {
+		v, ok := strings.CutPrefix(property, "rendition:"+name+"-")
+		if !ok || !slices.Contains(values, v) {
+			continue
+		}
+		switch name {
+		case "layout":
+			p.Layout = v
+		case "orientation":
+			p.Orientation = v
+		case "spread":
+			p.Spread = v
+		case "flow":
+			p.Flow = v
+		}
+		return true
+	}
+	return false
+}
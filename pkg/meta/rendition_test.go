@@ -0,0 +1,94 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/edrlab/lcp-server/pkg/test"
+)
+
+func TestSpineProperties(t *testing.T) {
+	info := inspectFiles(t, map[string]string{
+		"OEBPS/content.opf": test.OPF(`<dc:title>Fixed layout</dc:title>
+			<meta property="rendition:layout">pre-paginated</meta>
+			<meta property="rendition:spread">landscape</meta>
+			<meta property="rendition:orientation">sideways</meta>`,
+			`<item id="cover" href="cover.xhtml" media-type="application/xhtml+xml"/>
+			<item id="p1" href="page1.xhtml" media-type="application/xhtml+xml"/>
+			<item id="p2" href="page2.xhtml" media-type="application/xhtml+xml"/>
+			<item id="notes" href="notes.xhtml" media-type="application/xhtml+xml"/>`,
+			`<spine>
+				<itemref idref="cover" properties="rendition:page-spread-center rendition:spread-none"/>
+				<itemref idref="p1" properties="page-spread-left"/>
+				<itemref idref="p2" properties="page-spread-right rendition:orientation-portrait rendition:align-x-center"/>
+				<itemref idref="notes" properties="rendition:layout-reflowable rendition:flow-scrolled-doc"/>
+			</spine>`),
+	})
+	expected := []SpineProperties{
+		{Href: "OEBPS/cover.xhtml", Layout: "pre-paginated", Orientation: "auto", Spread: "none", Flow: "auto", PageSpread: "center"},
+		{Href: "OEBPS/page1.xhtml", Layout: "pre-paginated", Orientation: "auto", Spread: "landscape", Flow: "auto", PageSpread: "left"},
+		{Href: "OEBPS/page2.xhtml", Layout: "pre-paginated", Orientation: "portrait", Spread: "landscape", Flow: "auto", PageSpread: "right"},
+		{Href: "OEBPS/notes.xhtml", Layout: "reflowable", Orientation: "auto", Spread: "landscape", Flow: "scrolled-doc"},
+	}
+	if !slices.Equal(info.SpineProperties, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, info.SpineProperties)
+	}
+	if !info.FixedLayout {
+		t.Error("Expected a fixed-layout package")
+	}
+	warnings := strings.Join(info.Warnings, "\n")
+	if !strings.Contains(warnings, `unknown value "sideways" of rendition:orientation`) ||
+		!strings.Contains(warnings, `unknown spine property "rendition:align-x-center" of OEBPS/page2.xhtml`) {
+		t.Errorf("Expected warnings on the unknown values, got %q", info.Warnings)
+	}
+}
+
+func TestSpinePropertiesReflowable(t *testing.T) {
+	info := inspectFiles(t, map[string]string{
+		"OEBPS/content.opf": test.OPF(`<dc:title>Reflowable</dc:title>`,
+			`<item id="ch1" href="chapter1.xhtml" media-type="application/xhtml+xml"/>`,
+			`<spine><itemref idref="ch1"/></spine>`),
+	})
+	expected := []SpineProperties{{Href: "OEBPS/chapter1.xhtml", Layout: "reflowable", Orientation: "auto", Spread: "auto", Flow: "auto"}}
+	if !slices.Equal(info.SpineProperties, expected) || len(info.Warnings) != 0 {
+		t.Errorf("Expected %+v without warnings, got %+v (%q)", expected, info.SpineProperties, info.Warnings)
+	}
+	if info.FixedLayout {
+		t.Error("Expected a reflowable package by default")
+	}
+}
+
+func TestSpinePropertiesWarningsCap(t *testing.T) {
+	var items, itemrefs strings.Builder
+	for i := range maxRenditionWarnings + 5 {
+		fmt.Fprintf(&items, `<item id="p%d" href="page%d.xhtml" media-type="application/xhtml+xml"/>`, i, i)
+		fmt.Fprintf(&itemrefs, `<itemref idref="p%d" properties="rendition:layout-unknown"/>`, i)
+	}
+	info := inspectFiles(t, map[string]string{
+		"OEBPS/content.opf": test.OPF(`<dc:title>Unknown</dc:title>`, items.String(), "<spine>"+itemrefs.String()+"</spine>"),
+	})
+	if len(info.SpineProperties) != maxRenditionWarnings+5 {
+		t.Errorf("Expected %d spine items, got %d", maxRenditionWarnings+5, len(info.SpineProperties))
+	}
+	if len(info.Warnings) != maxRenditionWarnings+1 || info.Warnings[maxRenditionWarnings] != "5 more unknown rendition properties" {
+		t.Errorf("Expected %d warnings and a summary, got %q", maxRenditionWarnings, info.Warnings)
+	}
+}
+
+func TestFixedLayout(t *testing.T) {
+	for layout, fixed := range map[string]bool{"pre-paginated": true, "reflowable": false, " pre-paginated ": true} {
+		info := inspectFiles(t, map[string]string{
+			"OEBPS/content.opf": test.OPF(`<dc:title>Layout</dc:title>
+				<meta property="rendition:layout">`+layout+`</meta>`,
+				`<item id="ch1" href="chapter1.xhtml" media-type="application/xhtml+xml"/>`,
+				`<spine><itemref idref="ch1" properties="rendition:layout-reflowable"/></spine>`),
+		})
+		if info.FixedLayout != fixed {
+			t.Errorf("Expected fixed layout %v for %q, got %v", fixed, layout, info.FixedLayout)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import (
+	"mime"
+	"strings"
+)
+
+// Resource types counted in the manifest of a publication
+const (
+	ResourceDocuments = "documents"
+	ResourceImages    = "images"
+	ResourceAudio     = "audio"
+	ResourceVideo     = "video"
+	ResourceFonts     = "fonts"
+	ResourceStyles    = "styles"
+	ResourceOther     = "other" // NCX, scripts, media overlays, etc.
+)
+
+// resourceCounts returns the number of resources of each type declared in the manifest.
+// Every type is present, with a zero count if the publication has none.
+func (ep *epubFile) resourceCounts() map[string]int {
+	counts := map[string]int{
+		ResourceDocuments: 0, ResourceImages: 0, ResourceAudio: 0, ResourceVideo: 0,
+		ResourceFonts: 0, ResourceStyles: 0, ResourceOther: 0,
+	}
+	for _, item := range ep.pkg.Manifest {
+		counts[resourceType(item.MediaType)]++
+	}
+	return counts
+}
+
+// resourceType returns the type of a resource from its media type.
+func resourceType(mediaType string) string {
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if mt, _, err := mime.ParseMediaType(mediaType); err == nil {
+		mediaType = mt
+	}
+	switch {
+	case mediaType == "application/xhtml+xml", mediaType == "text/html":
+		return ResourceDocuments
+	case strings.HasPrefix(mediaType, "image/"):
+		return ResourceImages
+	case strings.HasPrefix(mediaType, "audio/"):
+		return ResourceAudio
+	case strings.HasPrefix(mediaType, "video/"):
+		return ResourceVideo
+	case strings.HasPrefix(mediaType, "font/"), strings.HasPrefix(mediaType, "application/font-"),
+		strings.HasPrefix(mediaType, "application/x-font-"), mediaType == "application/vnd.ms-opentype":
+		return ResourceFonts
+	case mediaType == "text/css":
+		return ResourceStyles
+	}
+	return ResourceOther
+}
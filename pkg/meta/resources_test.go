@@ -0,0 +1,46 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import (
+	"maps"
+	"testing"
+
+	"github.com/edrlab/lcp-server/pkg/test"
+)
+
+// a media-rich EPUB, with audio and video clips and a media overlay
+var mediaRichOPF = test.OPF(`<dc:title>Media</dc:title>`,
+	`<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+	<item id="ch1" href="chapter1.xhtml" media-type="application/xhtml+xml" media-overlay="mo1"/>
+	<item id="ch2" href="chapter2.html" media-type="text/html"/>
+	<item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+	<item id="css" href="style.css" media-type="text/css"/>
+	<item id="cover" href="cover.jpg" media-type="image/jpeg" properties="cover-image"/>
+	<item id="map" href="map.svg" media-type="image/svg+xml"/>
+	<item id="font1" href="font.otf" media-type="application/vnd.ms-opentype"/>
+	<item id="font2" href="font.woff2" media-type="font/woff2"/>
+	<item id="clip1" href="clip1.mp3" media-type="audio/mpeg"/>
+	<item id="clip2" href="clip2.m4a" media-type="Audio/MP4; codecs=mp4a"/>
+	<item id="video" href="intro.mp4" media-type="video/mp4"/>
+	<item id="mo1" href="chapter1.smil" media-type="application/smil+xml"/>
+	<item id="js" href="quiz.js" media-type="application/javascript"/>`,
+	`<spine><itemref idref="ch1"/><itemref idref="ch2"/></spine>`)
+
+func TestResourceCounts(t *testing.T) {
+	info := inspectFiles(t, map[string]string{"OEBPS/content.opf": mediaRichOPF})
+	expected := map[string]int{"documents": 3, "images": 2, "audio": 2, "video": 1, "fonts": 2, "styles": 1, "other": 3}
+	if !maps.Equal(info.ResourceCounts, expected) {
+		t.Errorf("Expected %v, got %v", expected, info.ResourceCounts)
+	}
+
+	info = inspectFiles(t, map[string]string{
+		"OEBPS/content.opf": test.OPF(`<dc:title>Text</dc:title>`,
+			`<item id="ch1" href="chapter1.xhtml" media-type="application/xhtml+xml"/>`,
+			`<spine><itemref idref="ch1"/></spine>`),
+	})
+	expected = map[string]int{"documents": 1, "images": 0, "audio": 0, "video": 0, "fonts": 0, "styles": 0, "other": 0}
+	if !maps.Equal(info.ResourceCounts, expected) {
+		t.Errorf("Expected %v, got %v", expected, info.ResourceCounts)
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import "strings"
+
+// titles returns the values of the title elements.
+func (m opfMetadata) titles() []string {
+	values := make([]string, len(m.Titles))
+	for i, t := range m.Titles {
+		values[i] = t.Value
+	}
+	return values
+}
+
+// altTitles returns the alternate-script refinements of the primary title, keyed by language.
+// It returns nil if the title has no alternate, which is always the case in EPUB 2.
+func (ep *epubFile) altTitles() map[string]string {
+	m := ep.pkg.Metadata
+	var id string
+	for _, t := range m.Titles {
+		if strings.TrimSpace(t.Value) != "" {
+			id = t.ID
+			break
+		}
+	}
+	if id == "" {
+		return nil
+	}
+
+	var alts map[string]string
+	for _, mt := range m.Metas {
+		value := strings.TrimSpace(mt.Value)
+		if mt.Property != "alternate-script" || mt.Refines != "#"+id || mt.Lang == "" || value == "" {
+			continue
+		}
+		if alts == nil {
+			alts = make(map[string]string)
+		}
+		// the first variant of a language wins
+		if _, ok := alts[mt.Lang]; !ok {
+			alts[mt.Lang] = value
+		}
+	}
+	return alts
+}
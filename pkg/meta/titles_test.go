@@ -0,0 +1,43 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package meta
+
+import (
+	"maps"
+	"testing"
+
+	"github.com/edrlab/lcp-server/pkg/test"
+)
+
+func TestAltTitles(t *testing.T) {
+	cases := []struct {
+		name     string
+		metadata string
+		expected map[string]string
+	}{
+		{"none", `<dc:title id="t1">Plain</dc:title>`, nil},
+		{"no title id", `<dc:title>Plain</dc:title>
+			<meta refines="#t1" property="alternate-script" xml:lang="ja">無題</meta>`, nil},
+		{"alternates", `<dc:title id="t1">Wagahai wa Neko de Aru</dc:title>
+			<dc:title id="t2">I Am a Cat</dc:title>
+			<meta refines="#t1" property="alternate-script" xml:lang="ja"> 吾輩は猫である </meta>
+			<meta refines="#t1" property="alternate-script" xml:lang="ja-Latn">Wagahai wa neko de aru</meta>
+			<meta refines="#t1" property="alternate-script" xml:lang="ja">ignored</meta>
+			<meta refines="#t2" property="alternate-script" xml:lang="fr">Je suis un chat</meta>
+			<meta refines="#t1" property="title-type">main</meta>`,
+			map[string]string{"ja": "吾輩は猫である", "ja-Latn": "Wagahai wa neko de aru"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			info := inspectFiles(t, map[string]string{
+				"OEBPS/content.opf": test.OPF(c.metadata,
+					`<item id="ch1" href="chapter1.xhtml" media-type="application/xhtml+xml"/>`,
+					`<spine><itemref idref="ch1"/></spine>`),
+				"OEBPS/chapter1.xhtml": `<html><body><p>Chapter</p></body></html>`,
+			})
+			if !maps.Equal(info.AltTitles, c.expected) {
+				t.Errorf("Expected %v, got %v", c.expected, info.AltTitles)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package pack
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+)
+
+// SupplementDir is the directory of the supplementary resources, relative to the package document.
+const SupplementDir = "supplements"
+
+// Supplement is a supplementary resource bundled with an EPUB.
+type Supplement struct {
+	Name      string // file name, unique in the bundle
+	Path      string // path of the file on disk
+	MediaType string
+}
+
+// manifestEnd matches the end tag of the manifest of a package document, whatever its prefix.
+var manifestEnd = regexp.MustCompile(`</([A-Za-z_][\w.-]*:)?manifest\s*>`)
+
+// AddSupplements rewrites the EPUB at src into dst, adding the supplementary resources
+// in SupplementDir and declaring them in the manifest of the package document.
+// The spine is unchanged: supplements are resources, not part of the reading order.
+// Other entries are copied byte for byte.
+func AddSupplements(src, dst string, supplements []Supplement) error {
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	rootFiles, err := readRootFiles(&zr.Reader)
+	if err != nil {
+		return err
+	}
+	if len(rootFiles) == 0 {
+		return errors.New("no package document declared in the container file")
+	}
+	opfPath := rootFiles[0]
+
+	entries := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		entries[f.Name] = f
+	}
+	opfFile, ok := entries[opfPath]
+	if !ok {
+		return errors.New("package document not found: " + opfPath)
+	}
+	names := make([]string, len(supplements))
+	for i, s := range supplements {
+		names[i] = path.Join(path.Dir(opfPath), SupplementDir, s.Name)
+		if _, exists := entries[names[i]]; exists || s.Name == "" || path.Base(s.Name) != s.Name {
+			return fmt.Errorf("invalid supplement name %q", s.Name)
+		}
+		entries[names[i]] = nil
+	}
+
+	opf, err := declareSupplements(opfFile, supplements)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	zw := zip.NewWriter(out)
+	for _, f := range zr.File {
+		if f.Name == opfPath {
+			err = writeEntry(zw, f.Name, bytes.NewReader(opf))
+		} else {
+			err = copyRaw(zw, f)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for i, s := range supplements {
+		if err := addFile(zw, names[i], s.Path); err != nil {
+			return err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// declareSupplements returns the package document with the supplements added to its manifest.
+// The document is edited as text, so that the rest of it is kept as-is.
+func declareSupplements(f *zip.File, supplements []Supplement) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	opf, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	loc := manifestEnd.FindSubmatchIndex(opf)
+	if loc == nil {
+		return nil, errors.New("no manifest in the package document")
+	}
+	prefix := ""
+	if loc[2] >= 0 {
+		prefix = string(opf[loc[2]:loc[3]])
+	}
+
+	var items bytes.Buffer
+	n := 0
+	for _, s := range supplements {
+		// find an unused id
+		var id string
+		for {
+			n++
+			id = fmt.Sprintf("supplement-%d", n)
+			if !bytes.Contains(opf, []byte(`"`+id+`"`)) {
+				break
+			}
+		}
+		href := (&url.URL{Path: path.Join(SupplementDir, s.Name)}).String()
+		fmt.Fprintf(&items, `  <%sitem id="%s" href="%s" media-type="%s"/>`+"\n  ", prefix, id, xmlEscape(href), xmlEscape(s.MediaType))
+	}
+
+	res := make([]byte, 0, len(opf)+items.Len())
+	res = append(res, opf[:loc[0]]...)
+	res = append(res, items.Bytes()...)
+	return append(res, opf[loc[0]:]...), nil
+}
+
+// xmlEscape escapes a string for an XML attribute value.
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+// writeEntry writes a compressed zip entry.
+func writeEntry(zw *zip.Writer, name string, r io.Reader) error {
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// addFile adds a file from the disk as a compressed zip entry.
+func addFile(zw *zip.Writer, name, filePath string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return writeEntry(zw, name, f)
+}
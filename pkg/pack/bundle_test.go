@@ -0,0 +1,85 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package pack
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/readium/readium-lcp-server/epub"
+)
+
+func TestAddSupplements(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "test.epub")
+	writePolicyEPUB(t, input)
+	worksheet := filepath.Join(dir, "worksheet")
+	if err := os.WriteFile(worksheet, []byte("%PDF-1.4"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	audio := filepath.Join(dir, "audio")
+	if err := os.WriteFile(audio, []byte("ID3"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	bundle := filepath.Join(dir, "bundle.epub")
+	err := AddSupplements(input, bundle, []Supplement{
+		{Name: "work sheet.pdf", Path: worksheet, MediaType: "application/pdf"},
+		{Name: "track.mp3", Path: audio, MediaType: "audio/mpeg"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := readZip(t, bundle)
+	if readAll(t, files["OEBPS/supplements/work sheet.pdf"].Open) != "%PDF-1.4" {
+		t.Error("Missing supplement")
+	}
+	opf := readAll(t, files["OEBPS/content.opf"].Open)
+	if !strings.Contains(opf, `<item id="supplement-1" href="supplements/work%20sheet.pdf" media-type="application/pdf"/>`) {
+		t.Errorf("Supplement not declared in the manifest:\n%s", opf)
+	}
+
+	// the supplements are resources of the publication, out of the reading order
+	zr, err := zip.OpenReader(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	ep, err := epub.Read(&zr.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ep.Package[0].Manifest.Items) != 6 || strings.Count(opf, "<itemref") != 1 {
+		t.Errorf("Unexpected package:\n%s", opf)
+	}
+
+	// and they are encrypted with the publication
+	output := filepath.Join(dir, "encrypted.epub")
+	if _, err := EncryptEPUB(bundle, output, Options{CompressionLevel: DefaultCompression}); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"OEBPS/chapter1.xhtml", "OEBPS/supplements/track.mp3", "OEBPS/supplements/work%20sheet.pdf"}
+	if got := encryptedPaths(t, output); !slices.Equal(got, expected) {
+		t.Errorf("Expected encrypted resources %v, got %v", expected, got)
+	}
+}
+
+func TestAddSupplementsInvalidName(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "test.epub")
+	writePolicyEPUB(t, input)
+	for _, names := range [][]string{{"../evil.pdf"}, {""}, {"a.pdf", "a.pdf"}} {
+		var supplements []Supplement
+		for _, name := range names {
+			supplements = append(supplements, Supplement{Name: name, Path: input, MediaType: "application/pdf"})
+		}
+		if err := AddSupplements(input, filepath.Join(dir, "bundle.epub"), supplements); err == nil {
+			t.Errorf("Expected an error for %q", names)
+		}
+	}
+}
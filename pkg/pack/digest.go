@@ -0,0 +1,170 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package pack
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+)
+
+// ManifestName is the path of the manifest of a Readium Package.
+const ManifestName = "manifest.json"
+
+// digestPrefix identifies the algorithm of the digests embedded in a manifest.
+const digestPrefix = "sha256:"
+
+// ResourceDigests returns the hex-encoded SHA-256 digests of the clear resources
+// of the Readium Package at src, keyed by path. The manifest is not digested.
+func ResourceDigests(src string) (map[string]string, error) {
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	digests := make(map[string]string)
+	for _, f := range zr.File {
+		if f.Name == ManifestName || f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		digests[f.Name] = hex.EncodeToString(h.Sum(nil))
+	}
+	return digests, nil
+}
+
+// ManifestHash returns the digest of the manifest of the Readium Package at path, in the form
+// "sha256:<hex digest>", or an empty string if the container has no manifest.
+// The manifest is hashed as stored, so that the same package always gives the same hash.
+func ManifestHash(path string) (string, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+	f, err := zr.Open(ManifestName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return digestPrefix + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// AddResourceDigests rewrites the Readium Package at src into dst, adding to each link of its manifest
+// the digest of the resource it references, as a "hash" property in the form "sha256:<hex digest>".
+// Other entries are copied byte for byte, and the other properties of the manifest are kept.
+func AddResourceDigests(src, dst string, digests map[string]string) error {
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	zw := zip.NewWriter(out)
+	for _, f := range zr.File {
+		if f.Name == ManifestName {
+			err = rewriteManifest(zw, f, digests)
+		} else {
+			err = copyRaw(zw, f)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// rewriteManifest copies the manifest after adding digests to its links.
+// The manifest is decoded generically, so that properties unknown to this package are kept.
+func rewriteManifest(zw *zip.Writer, f *zip.File, digests map[string]string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	dec := json.NewDecoder(rc)
+	dec.UseNumber()
+	var manifest map[string]any
+	if err := dec.Decode(&manifest); err != nil {
+		return err
+	}
+	for _, key := range []string{"readingOrder", "resources", "links"} {
+		addLinkDigests(manifest[key], digests)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return err
+	}
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: f.Name, Method: f.Method, Modified: f.Modified})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// addLinkDigests adds digests to a list of links and to their alternates and children.
+func addLinkDigests(links any, digests map[string]string) {
+	list, ok := links.([]any)
+	if !ok {
+		return
+	}
+	for _, l := range list {
+		link, ok := l.(map[string]any)
+		if !ok {
+			continue
+		}
+		if href, ok := link["href"].(string); ok {
+			digest, ok := digests[href]
+			if !ok {
+				// hrefs are URLs, which may be escaped
+				if name, err := url.PathUnescape(href); err == nil {
+					digest, ok = digests[name]
+				}
+			}
+			if ok {
+				link["hash"] = digestPrefix + digest
+			}
+		}
+		addLinkDigests(link["alternate"], digests)
+		addLinkDigests(link["children"], digests)
+	}
+}
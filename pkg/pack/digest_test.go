@@ -0,0 +1,123 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package pack
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/readium/readium-lcp-server/encrypt"
+	"github.com/readium/readium-lcp-server/rwpm"
+)
+
+const testAudiobookManifest = `{
+  "@context": "https://readium.org/webpub-manifest/context.jsonld",
+  "metadata": {"@type": "http://schema.org/Audiobook", "title": "Digests", "duration": 12.5},
+  "links": [{"rel": "cover", "href": "cover.jpg", "type": "image/jpeg"}],
+  "readingOrder": [
+    {"href": "track1.mp3", "type": "audio/mpeg", "duration": 10},
+    {"href": "track2.mp3", "type": "audio/mpeg", "duration": 2.5}
+  ]
+}`
+
+// writeTestAudiobook generates a Readium audiobook package.
+func writeTestAudiobook(t testing.TB, path string) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, e := range [][2]string{
+		{ManifestName, testAudiobookManifest},
+		{"cover.jpg", "cover"},
+		{"track1.mp3", "first track"},
+		{"track2.mp3", "second track"},
+	} {
+		w, err := zw.Create(e[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(e[1]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestAddResourceDigests(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "test.audiobook")
+	writeTestAudiobook(t, input)
+
+	digests, err := ResourceDigests(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(digests) != 3 || digests["track1.mp3"] != sha256Hex("first track") {
+		t.Fatalf("Unexpected digests %v", digests)
+	}
+
+	pub, err := encrypt.ProcessEncryption("", "", input, "", dir, "", "", "", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := filepath.Join(dir, pub.FileName)
+	output := filepath.Join(dir, "digests.lcpa")
+	if err := AddResourceDigests(encrypted, output, digests); err != nil {
+		t.Fatal(err)
+	}
+
+	files := readZip(t, output)
+	if len(files) != len(readZip(t, encrypted)) {
+		t.Error("Expected the same entries")
+	}
+	if string(rawBytes(t, files["track2.mp3"])) != string(rawBytes(t, readZip(t, encrypted)["track2.mp3"])) {
+		t.Error("Expected encrypted resources to be copied as-is")
+	}
+
+	// the manifest still conforms to the Readium Web Publication Manifest
+	var manifest rwpm.Publication
+	if err := json.Unmarshal([]byte(readAll(t, files[ManifestName].Open)), &manifest); err != nil {
+		t.Fatalf("Invalid manifest: %v", err)
+	}
+	if manifest.Metadata.Title.Text() != "Digests" || manifest.Metadata.Duration != 12.5 || len(manifest.ReadingOrder) != 2 {
+		t.Errorf("Unexpected manifest %+v", manifest)
+	}
+	for _, l := range manifest.ReadingOrder {
+		if l.Properties == nil || l.Properties.Encrypted == nil {
+			t.Errorf("Expected %s to be marked as encrypted", l.Href)
+		}
+	}
+
+	// digests are those of the clear content
+	var raw struct {
+		Links        []map[string]any `json:"links"`
+		ReadingOrder []struct {
+			Href string `json:"href"`
+			Hash string `json:"hash"`
+		} `json:"readingOrder"`
+	}
+	if err := json.Unmarshal([]byte(readAll(t, files[ManifestName].Open)), &raw); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"sha256:" + sha256Hex("first track"), "sha256:" + sha256Hex("second track")}
+	for i, l := range raw.ReadingOrder {
+		if l.Hash != expected[i] {
+			t.Errorf("Expected %s for %s, got %s", expected[i], l.Href, l.Hash)
+		}
+	}
+	if raw.Links[0]["hash"] != "sha256:"+sha256Hex("cover") {
+		t.Errorf("Expected a digest for the cover, got %v", raw.Links[0])
+	}
+}
@@ -0,0 +1,474 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package pack
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/readium/readium-lcp-server/crypto"
+	"github.com/readium/readium-lcp-server/epub"
+	"github.com/readium/readium-lcp-server/xmlenc"
+	"golang.org/x/net/html/charset"
+)
+
+// ClearPolicy selects the EPUB resources left in clear, on top of the files
+// which must never be encrypted (mimetype, META-INF files and package documents).
+type ClearPolicy string
+
+const (
+	// ClearPreview leaves in clear the navigation documents and the cover image,
+	// as identified by the package document, so that they can be presented before
+	// the acquisition of a license. This is the default policy.
+	ClearPreview ClearPolicy = "preview"
+	// ClearRequired encrypts every resource which can be encrypted.
+	ClearRequired ClearPolicy = "required"
+)
+
+// ParseClearPolicy returns the clear policy corresponding to a name; an empty name
+// selects the default policy.
+func ParseClearPolicy(name string) (ClearPolicy, error) {
+	switch p := ClearPolicy(name); p {
+	case "":
+		return ClearPreview, nil
+	case ClearPreview, ClearRequired:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown clear policy %q", name)
+}
+
+// Reasons for leaving a resource in clear
+const (
+	ReasonRequired         = "required"          // mimetype, META-INF file or package document
+	ReasonAlreadyEncrypted = "already-encrypted" // declared in the encryption file of the source, e.g. an obfuscated font
+	ReasonDeobfuscated     = "deobfuscated"      // obfuscated font left in clear by the font policy
+	ReasonNav              = "nav"
+	ReasonCoverImage       = "cover-image"
+	ReasonNCX              = "ncx"
+	ReasonPageMap          = "page-map"
+	ReasonBelowMinSize     = "below-min-size" // smaller than the minimum size of encrypted resources
+)
+
+// Resource reports how a resource of an EPUB has been processed.
+type Resource struct {
+	Path      string `json:"path"`
+	MediaType string `json:"media_type,omitempty"`
+	// DeclaredMediaType is the media type declared in the manifest, if it has been normalized
+	DeclaredMediaType string `json:"declared_media_type,omitempty"`
+	Encrypted         bool   `json:"encrypted"`
+	Reason            string `json:"reason,omitempty"` // why the resource is left in clear
+}
+
+// EPUBResult is the result of the encryption of an EPUB.
+type EPUBResult struct {
+	Key       crypto.ContentKey
+	Title     string
+	Resources []Resource
+	Warnings  []string // decisions taken on the obfuscated fonts
+}
+
+// EncryptEPUB encrypts the resources of the EPUB at src into dst with the content key of the options or a new one,
+// leaving clear the resources selected by the clear policy of the options.
+// Fonts obfuscated in the source are processed according to the font policy of the options.
+// It produces the same container as the LCP encryption tool with the preview policy.
+func EncryptEPUB(src, dst string, opts Options) (*EPUBResult, error) {
+	level := opts.CompressionLevel
+	if level < DefaultCompression || level > flate.BestCompression {
+		return nil, errors.New("invalid compression level")
+	}
+	policy, err := ParseClearPolicy(string(opts.ClearPolicy))
+	if err != nil {
+		return nil, err
+	}
+	fontPolicy, err := ParseFontPolicy(string(opts.FontPolicy))
+	if err != nil {
+		return nil, err
+	}
+
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	ep, err := epub.Read(&zr.Reader)
+	if err != nil {
+		return nil, err
+	}
+	rootFiles, err := readRootFiles(&zr.Reader)
+	if err != nil {
+		return nil, err
+	}
+	clear := clearResources(ep, rootFiles, policy)
+	var spine map[string]bool
+	if opts.MinEncryptSize > 0 {
+		// spine documents are encrypted whatever their size
+		if spine, err = readSpinePaths(&zr.Reader, rootFiles); err != nil {
+			return nil, err
+		}
+	}
+
+	encrypter := crypto.NewAESEncrypter_PUBLICATION_RESOURCES()
+	key := crypto.ContentKey(opts.ContentKey)
+	if key == nil {
+		if key, err = encrypter.GenerateKey(); err != nil {
+			return nil, err
+		}
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+
+	zw := zip.NewWriter(out)
+	zw.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(w, level)
+	})
+	if err := writeMimetype(zw); err != nil {
+		return nil, err
+	}
+
+	enc := ep.Encryption
+	if enc == nil {
+		enc = &xmlenc.Manifest{}
+	}
+	res := &EPUBResult{Key: key}
+	if len(ep.Package) > 0 && len(ep.Package[0].Metadata.Title) > 0 {
+		res.Title = ep.Package[0].Metadata.Title[0]
+	}
+	fonts := &fontHandler{policy: fontPolicy, enc: enc}
+	if fontPolicy != FontPreserve && len(rootFiles) > 0 {
+		// obfuscation keys derive from the identifiers of the publication
+		if fonts.uniqueID, fonts.identifiers, err = readIdentifiers(&zr.Reader, rootFiles[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	var normalized map[string]string
+	if opts.NormalizeMediaTypes {
+		normalized = canonicalMediaTypes(ep)
+		for _, r := range ep.Resource {
+			if canonical, ok := normalized[r.Path]; ok {
+				res.Warnings = append(res.Warnings, fmt.Sprintf("media type of %s declared as %q, normalized to %s", r.Path, r.ContentType, canonical))
+			}
+		}
+	}
+
+	for _, r := range ep.Resource {
+		report := Resource{Path: r.Path, MediaType: r.ContentType}
+		if canonical, ok := normalized[r.Path]; ok {
+			report.DeclaredMediaType = r.ContentType
+			report.MediaType = canonical
+			r.ContentType = canonical
+		}
+		if len(normalized) > 0 && slices.Contains(rootFiles, r.Path) {
+			opf, err := io.ReadAll(r.Contents)
+			if err != nil {
+				return nil, fmt.Errorf("unable to process %s: %w", r.Path, err)
+			}
+			r.Contents = bytes.NewReader(normalizeManifest(opf))
+		}
+		if data, encrypted := enc.DataForFile(r.Path); encrypted {
+			report.Reason = ReasonAlreadyEncrypted
+			if algorithm := string(data.Method.Algorithm); isObfuscation(algorithm) {
+				deobfuscated, err := fonts.handle(r, algorithm)
+				if err != nil {
+					return nil, fmt.Errorf("unable to process %s: %w", r.Path, err)
+				}
+				if deobfuscated {
+					report.Reason = ""
+					if fontPolicy == FontStrip {
+						report.Reason = ReasonDeobfuscated
+					}
+				}
+			}
+		} else {
+			report.Reason = clear[r.Path]
+			if report.Reason == "" && int64(r.OriginalSize) < opts.MinEncryptSize && !spine[r.Path] {
+				report.Reason = ReasonBelowMinSize
+			}
+		}
+		if report.Reason != "" {
+			err = copyResource(zw, r, level)
+		} else {
+			report.Encrypted = true
+			err = encryptResource(zw, encrypter, key, enc, r)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to process %s: %w", r.Path, err)
+		}
+		res.Resources = append(res.Resources, report)
+	}
+	res.Warnings = append(res.Warnings, fonts.warnings...)
+
+	// save the encryption manifest
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: epub.EncryptionFile, Method: zip.Deflate})
+	if err != nil {
+		return nil, err
+	}
+	if err := enc.Write(fw); err != nil {
+		return nil, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return res, out.Close()
+}
+
+// readRootFiles returns the paths of the package documents declared in the container file.
+func readRootFiles(zr *zip.Reader) ([]string, error) {
+	f, err := zr.Open(epub.ContainerFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var c struct {
+		Rootfiles []struct {
+			FullPath string `xml:"full-path,attr"`
+		} `xml:"rootfiles>rootfile"`
+	}
+	if err := xml.NewDecoder(f).Decode(&c); err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, rf := range c.Rootfiles {
+		paths = append(paths, rf.FullPath)
+	}
+	return paths, nil
+}
+
+// decodePackageDocument decodes the package document at name. As in epub.Read, a declaration of
+// XML 1.1, which EPUB does not allow, is read as XML 1.0.
+func decodePackageDocument(zr *zip.Reader, name string, v any) error {
+	f, err := zr.Open(name)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	decl := data[:min(len(data), 100)]
+	for _, version := range []string{`version="1.1"`, `version='1.1'`} {
+		if i := bytes.Index(decl, []byte(version)); i >= 0 {
+			data = slices.Concat(data[:i], []byte(strings.Replace(version, "1.1", "1.0", 1)), data[i+len(version):])
+			break
+		}
+	}
+	xd := xml.NewDecoder(bytes.NewReader(data))
+	xd.CharsetReader = charset.NewReaderLabel
+	return xd.Decode(v)
+}
+
+// readSpinePaths returns the paths of the documents of the spines of the package documents.
+func readSpinePaths(zr *zip.Reader, rootFiles []string) (map[string]bool, error) {
+	paths := make(map[string]bool)
+	for _, rootFile := range rootFiles {
+		var p struct {
+			Items []struct {
+				ID   string `xml:"id,attr"`
+				Href string `xml:"href,attr"`
+			} `xml:"manifest>item"`
+			Itemrefs []struct {
+				IDRef string `xml:"idref,attr"`
+			} `xml:"spine>itemref"`
+		}
+		if err := decodePackageDocument(zr, rootFile, &p); err != nil {
+			return nil, err
+		}
+		for _, ref := range p.Itemrefs {
+			for _, item := range p.Items {
+				if item.ID == ref.IDRef {
+					paths[path.Join(path.Dir(rootFile), item.Href)] = true
+				}
+			}
+		}
+	}
+	return paths, nil
+}
+
+// clearResources returns the resources left in clear, by path, with the reason of the decision.
+func clearResources(ep epub.Epub, rootFiles []string, policy ClearPolicy) map[string]string {
+	clear := make(map[string]string)
+	for _, r := range ep.Resource {
+		if strings.HasPrefix(r.Path, "META-INF/") || slices.Contains(rootFiles, r.Path) {
+			clear[r.Path] = ReasonRequired
+		}
+	}
+	if policy != ClearPreview {
+		return clear
+	}
+
+	for _, p := range ep.Package {
+		// EPUB 2 declares its cover image in a meta element
+		coverID := "cover-image"
+		for _, m := range p.Metadata.Metas {
+			if m.Name == "cover" {
+				coverID = m.Content
+			}
+		}
+		for _, item := range p.Manifest.Items {
+			props := strings.Fields(item.Properties)
+			var reason string
+			switch {
+			case slices.Contains(props, "nav"):
+				reason = ReasonNav
+			case slices.Contains(props, "cover-image") || item.ID == coverID:
+				reason = ReasonCoverImage
+			case item.MediaType == epub.ContentType_NCX:
+				reason = ReasonNCX
+			case item.MediaType == epub.ContentType_PAGEMAP:
+				reason = ReasonPageMap
+			default:
+				continue
+			}
+			name := path.Join(p.BasePath, item.Href)
+			if _, ok := clear[name]; !ok {
+				clear[name] = reason
+			}
+		}
+	}
+	return clear
+}
+
+// canonicalMediaTypes returns the canonical media types of the manifest items whose declared
+// media type is not canonical, by path.
+func canonicalMediaTypes(ep epub.Epub) map[string]string {
+	normalized := make(map[string]string)
+	for _, p := range ep.Package {
+		for _, item := range p.Manifest.Items {
+			if canonical := CanonicalMediaType(item.Href, item.MediaType); canonical != item.MediaType {
+				normalized[path.Join(p.BasePath, item.Href)] = canonical
+			}
+		}
+	}
+	return normalized
+}
+
+// writeMimetype writes the mimetype file, first and uncompressed.
+func writeMimetype(zw *zip.Writer) error {
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write([]byte(epub.ContentType_EPUB))
+	return err
+}
+
+// copyResource copies a clear resource, keeping resources stored without compression as-is.
+func copyResource(zw *zip.Writer, r *epub.Resource, level int) error {
+	method := zip.Deflate
+	if r.StorageMethod == zip.Store || level == flate.NoCompression {
+		method = zip.Store
+	}
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: r.Path, Method: method})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r.Contents)
+	return err
+}
+
+// encryptResource encrypts a resource, after compressing it when useful, and declares it
+// in the encryption manifest. The encrypted resource is stored without compression.
+func encryptResource(zw *zip.Writer, encrypter crypto.Encrypter, key crypto.ContentKey, enc *xmlenc.Manifest, r *epub.Resource) error {
+	compress := mustCompressBeforeEncryption(r.ContentType)
+
+	data := xmlenc.Data{}
+	data.Method.Algorithm = xmlenc.URI(encrypter.Signature())
+	data.KeyInfo = &xmlenc.KeyInfo{}
+	data.KeyInfo.RetrievalMethod.URI = "license.lcpl#/encryption/content_key"
+	data.KeyInfo.RetrievalMethod.Type = "http://readium.org/2014/01/lcp#EncryptedContentKey"
+	data.CipherData.CipherReference.URI = xmlenc.URI(xmlenc.ResourcePathEscape(r.Path))
+	method := zip.Store
+	if compress {
+		method = zip.Deflate
+	}
+	data.Properties = &xmlenc.EncryptionProperties{
+		Properties: []xmlenc.EncryptionProperty{
+			{Compression: xmlenc.Compression{Method: int(method), OriginalLength: r.OriginalSize}},
+		},
+	}
+	enc.Data = append(enc.Data, data)
+
+	input := r.Contents
+	if compress {
+		var buf bytes.Buffer
+		fw, err := flate.NewWriter(&buf, flate.BestCompression)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(fw, r.Contents); err != nil {
+			return err
+		}
+		if err := fw.Close(); err != nil {
+			return err
+		}
+		input = &buf
+	}
+
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: r.Path, Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	return encrypter.Encrypt(key, input, w)
+}
+
+// mustCompressBeforeEncryption checks if a resource must be compressed before its encryption.
+// Media resources are not compressed, as it would prevent streaming them with byte range requests.
+func mustCompressBeforeEncryption(mediaType string) bool {
+	for _, prefix := range []string{"image", "video", "audio"} {
+		if strings.HasPrefix(mediaType, prefix) {
+			return false
+		}
+	}
+	return mediaType != "application/pdf"
+}
+
+// Protection levels of a publication
+const (
+	ProtectionFull    = "full"
+	ProtectionPartial = "partial"
+	ProtectionSample  = "sample"
+)
+
+// ProtectionLevel qualifies the protection of an EPUB from the ratio of encrypted resources
+// to significant resources, i.e. resources which could be encrypted (the files which must stay
+// clear do not count): full at or above fullRatio, sample at or below sampleRatio, partial in between.
+// A publication without significant resources is a sample.
+func ProtectionLevel(resources []Resource, fullRatio, sampleRatio float64) string {
+	var significant, encrypted int
+	for _, r := range resources {
+		if r.Reason == ReasonRequired {
+			continue
+		}
+		significant++
+		if r.Encrypted {
+			encrypted++
+		}
+	}
+	if significant == 0 {
+		return ProtectionSample
+	}
+	ratio := float64(encrypted) / float64(significant)
+	switch {
+	case ratio >= fullRatio:
+		return ProtectionFull
+	case ratio <= sampleRatio:
+		return ProtectionSample
+	}
+	return ProtectionPartial
+}
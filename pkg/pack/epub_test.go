@@ -0,0 +1,272 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package pack
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/edrlab/lcp-server/pkg/test"
+	"github.com/readium/readium-lcp-server/crypto"
+	"github.com/readium/readium-lcp-server/encrypt"
+	"github.com/readium/readium-lcp-server/xmlenc"
+)
+
+const testChapter = "<html><body><p>Chapter</p></body></html>"
+
+// writePolicyEPUB generates an EPUB with a nav document, a cover image, an NCX and a chapter.
+func writePolicyEPUB(t testing.TB, path string) {
+	test.WriteEPUB(t, path, map[string]string{
+		"OEBPS/content.opf": test.OPF(`<dc:title>Policies</dc:title>`,
+			`<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+			<item id="cover" href="images/cover.jpg" media-type="image/jpeg" properties="cover-image"/>
+			<item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+			<item id="ch1" href="chapter1.xhtml" media-type="application/xhtml+xml"/>`,
+			`<spine toc="ncx"><itemref idref="ch1"/></spine>`),
+		"OEBPS/nav.xhtml":        "<html><body><nav></nav></body></html>",
+		"OEBPS/images/cover.jpg": "cover",
+		"OEBPS/toc.ncx":          "<ncx/>",
+		"OEBPS/chapter1.xhtml":   testChapter,
+	})
+}
+
+// encryptedPaths returns the paths declared in the encryption file of an EPUB.
+func encryptedPaths(t testing.TB, path string) []string {
+	files := readZip(t, path)
+	rc, err := files["META-INF/encryption.xml"].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	enc, err := xmlenc.Read(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, data := range enc.Data {
+		paths = append(paths, string(data.CipherData.CipherReference.URI))
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestEncryptEPUBPolicies(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "test.epub")
+	writePolicyEPUB(t, input)
+
+	cases := []struct {
+		policy    ClearPolicy
+		encrypted []string
+		reasons   map[string]string
+	}{
+		{ClearPreview, []string{"OEBPS/chapter1.xhtml"}, map[string]string{
+			"META-INF/container.xml": ReasonRequired,
+			"OEBPS/content.opf":      ReasonRequired,
+			"OEBPS/nav.xhtml":        ReasonNav,
+			"OEBPS/images/cover.jpg": ReasonCoverImage,
+			"OEBPS/toc.ncx":          ReasonNCX,
+		}},
+		{ClearRequired, []string{"OEBPS/chapter1.xhtml", "OEBPS/images/cover.jpg", "OEBPS/nav.xhtml", "OEBPS/toc.ncx"}, map[string]string{
+			"META-INF/container.xml": ReasonRequired,
+			"OEBPS/content.opf":      ReasonRequired,
+		}},
+	}
+	for _, c := range cases {
+		t.Run(string(c.policy), func(t *testing.T) {
+			output := filepath.Join(dir, string(c.policy)+".epub")
+			res, err := EncryptEPUB(input, output, Options{CompressionLevel: DefaultCompression, ClearPolicy: c.policy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := encryptedPaths(t, output); !slices.Equal(got, c.encrypted) {
+				t.Errorf("Expected encrypted resources %v, got %v", c.encrypted, got)
+			}
+			if len(res.Resources) != 6 {
+				t.Errorf("Expected 6 resources in the report, got %d", len(res.Resources))
+			}
+			for _, r := range res.Resources {
+				if r.Encrypted != (r.Reason == "") || r.Reason != c.reasons[r.Path] {
+					t.Errorf("Unexpected report for %s: %+v", r.Path, r)
+				}
+			}
+		})
+	}
+}
+
+func TestEncryptEPUBMinEncryptSize(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "test.epub")
+	test.WriteEPUB(t, input, map[string]string{
+		"OEBPS/content.opf": test.OPF(`<dc:title>Sizes</dc:title>`,
+			`<item id="css" href="style.css" media-type="text/css"/>
+			<item id="icon" href="images/icon.png" media-type="image/png"/>
+			<item id="photo" href="images/photo.jpg" media-type="image/jpeg"/>
+			<item id="ch1" href="chapter1.xhtml" media-type="application/xhtml+xml"/>`,
+			`<spine><itemref idref="ch1"/></spine>`),
+		"OEBPS/style.css":        "p {}",
+		"OEBPS/images/icon.png":  "icon",
+		"OEBPS/images/photo.jpg": strings.Repeat("photo", 100),
+		// smaller than the threshold, but in the spine
+		"OEBPS/chapter1.xhtml": testChapter,
+	})
+	output := filepath.Join(dir, "output.epub")
+	res, err := EncryptEPUB(input, output, Options{CompressionLevel: DefaultCompression, MinEncryptSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"OEBPS/chapter1.xhtml", "OEBPS/images/photo.jpg"}
+	if got := encryptedPaths(t, output); !slices.Equal(got, expected) {
+		t.Errorf("Expected encrypted resources %v, got %v", expected, got)
+	}
+	for _, r := range res.Resources {
+		small := r.Path == "OEBPS/style.css" || r.Path == "OEBPS/images/icon.png"
+		if small != (r.Reason == ReasonBelowMinSize) {
+			t.Errorf("Unexpected report for %s: %+v", r.Path, r)
+		}
+	}
+}
+
+func TestEncryptEPUBDecrypt(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "test.epub")
+	writePolicyEPUB(t, input)
+	output := filepath.Join(dir, "encrypted.epub")
+	res, err := EncryptEPUB(input, output, Options{CompressionLevel: DefaultCompression})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Title != "Policies" || len(res.Key) != 32 {
+		t.Errorf("Unexpected result: title %q, key length %d", res.Title, len(res.Key))
+	}
+
+	files := readZip(t, output)
+	if readAll(t, files["mimetype"].Open) != "application/epub+zip" {
+		t.Error("Invalid mimetype")
+	}
+
+	// the chapter is compressed then encrypted
+	var compressed bytes.Buffer
+	if err := crypto.NewAESEncrypter_PUBLICATION_RESOURCES().(crypto.Decrypter).Decrypt(res.Key, bytes.NewReader(rawBytes(t, files["OEBPS/chapter1.xhtml"])), &compressed); err != nil {
+		t.Fatal(err)
+	}
+	clear, err := io.ReadAll(flate.NewReader(&compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(clear) != testChapter {
+		t.Errorf("Unexpected decrypted chapter %q", clear)
+	}
+}
+
+// The default policy gives the same protection as the LCP encryption tool.
+func TestEncryptEPUBAsEncryptionTool(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "test.epub")
+	writePolicyEPUB(t, input)
+
+	pub, err := encrypt.ProcessEncryption("", "", input, "", dir, "", "", "", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "server.epub")
+	if _, err := EncryptEPUB(input, output, Options{CompressionLevel: DefaultCompression}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := encryptedPaths(t, filepath.Join(dir, pub.FileName))
+	if got := encryptedPaths(t, output); !slices.Equal(got, expected) {
+		t.Errorf("Expected encrypted resources %v, got %v", expected, got)
+	}
+	var expectedNames, names []string
+	for name := range readZip(t, filepath.Join(dir, pub.FileName)) {
+		expectedNames = append(expectedNames, name)
+	}
+	for name := range readZip(t, output) {
+		names = append(names, name)
+	}
+	sort.Strings(expectedNames)
+	sort.Strings(names)
+	if !slices.Equal(names, expectedNames) {
+		t.Errorf("Expected entries %v, got %v", expectedNames, names)
+	}
+}
+
+func TestParseClearPolicy(t *testing.T) {
+	if p, err := ParseClearPolicy(""); err != nil || p != ClearPreview {
+		t.Errorf("Expected the preview policy by default, got %q (%v)", p, err)
+	}
+	if _, err := ParseClearPolicy("none"); err == nil {
+		t.Error("Expected an error for an unknown policy")
+	}
+}
+
+func readAll(t testing.TB, open func() (io.ReadCloser, error)) string {
+	rc, err := open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	b, _ := io.ReadAll(rc)
+	return string(b)
+}
+
+func TestProtectionLevel(t *testing.T) {
+	required := Resource{Path: "OEBPS/content.opf", Reason: ReasonRequired}
+	encrypted := Resource{Path: "OEBPS/chapter.xhtml", Encrypted: true}
+	clear := Resource{Path: "OEBPS/nav.xhtml", Reason: ReasonNav}
+	font := Resource{Path: "OEBPS/font.otf", Reason: ReasonAlreadyEncrypted}
+
+	cases := []struct {
+		name      string
+		resources []Resource
+		expected  string
+	}{
+		{"all encrypted", []Resource{required, encrypted, encrypted}, ProtectionFull},
+		{"above the full ratio", []Resource{required, encrypted, encrypted, encrypted, encrypted, clear}, ProtectionFull},
+		{"half encrypted", []Resource{required, encrypted, clear}, ProtectionPartial},
+		{"obfuscated font", []Resource{encrypted, font}, ProtectionPartial},
+		{"below the sample ratio", []Resource{required, encrypted, clear, clear, clear, clear, clear}, ProtectionSample},
+		{"nothing encrypted", []Resource{required, clear}, ProtectionSample},
+		{"no significant resource", []Resource{required}, ProtectionSample},
+	}
+	for _, c := range cases {
+		if got := ProtectionLevel(c.resources, 0.8, 0.2); got != c.expected {
+			t.Errorf("%s: expected %s, got %s", c.name, c.expected, got)
+		}
+	}
+}
+
+func TestProtectionLevelPolicies(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "test.epub")
+	writePolicyEPUB(t, input)
+
+	cases := []struct {
+		policy      ClearPolicy
+		fullRatio   float64
+		sampleRatio float64
+		expected    string
+	}{
+		// the chapter out of the nav, cover image, NCX and chapter
+		{ClearPreview, 0.8, 0.2, ProtectionPartial},
+		{ClearPreview, 0.8, 0.25, ProtectionSample},
+		{ClearPreview, 0.25, 0.2, ProtectionFull},
+		{ClearRequired, 0.8, 0.2, ProtectionFull},
+	}
+	for _, c := range cases {
+		res, err := EncryptEPUB(input, filepath.Join(dir, "output.epub"), Options{CompressionLevel: DefaultCompression, ClearPolicy: c.policy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ProtectionLevel(res.Resources, c.fullRatio, c.sampleRatio); got != c.expected {
+			t.Errorf("%s (%v, %v): expected %s, got %s", c.policy, c.fullRatio, c.sampleRatio, c.expected, got)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package pack
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/readium/readium-lcp-server/epub"
+	"github.com/readium/readium-lcp-server/xmlenc"
+)
+
+// FontPolicy selects how the fonts obfuscated in the source EPUB are processed.
+type FontPolicy string
+
+const (
+	// FontPreserve keeps obfuscated fonts as-is, with their obfuscation. This is the default policy.
+	FontPreserve FontPolicy = "preserve"
+	// FontStrip removes the obfuscation, leaving the fonts in clear.
+	FontStrip FontPolicy = "strip"
+	// FontEncrypt removes the obfuscation and encrypts the fonts like the other resources.
+	FontEncrypt FontPolicy = "encrypt"
+)
+
+// ParseFontPolicy returns the font policy corresponding to a name; an empty name
+// selects the default policy.
+func ParseFontPolicy(name string) (FontPolicy, error) {
+	switch p := FontPolicy(name); p {
+	case "":
+		return FontPreserve, nil
+	case FontPreserve, FontStrip, FontEncrypt:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown font policy %q", name)
+}
+
+// Font obfuscation algorithms
+const (
+	AlgorithmIDPFObfuscation  = "http://www.idpf.org/2008/embedding"
+	AlgorithmAdobeObfuscation = "http://ns.adobe.com/pdf/enc#RC"
+)
+
+// Number of obfuscated bytes at the start of a font
+const (
+	idpfObfuscatedLength  = 1040
+	adobeObfuscatedLength = 1024
+)
+
+// isObfuscation checks if an encryption algorithm is a font obfuscation algorithm.
+func isObfuscation(algorithm string) bool {
+	return algorithm == AlgorithmIDPFObfuscation || algorithm == AlgorithmAdobeObfuscation
+}
+
+// fontHandler applies a font policy to the obfuscated fonts of an EPUB.
+type fontHandler struct {
+	policy      FontPolicy
+	uniqueID    string   // unique identifier of the publication
+	identifiers []string // all identifiers of the publication
+	enc         *xmlenc.Manifest
+	warnings    []string
+}
+
+// handle applies the font policy to an obfuscated resource. If the obfuscation is removed,
+// the contents of the resource are replaced by the clear font, its declaration is removed
+// from the encryption manifest, and handle returns true.
+func (h *fontHandler) handle(r *epub.Resource, algorithm string) (bool, error) {
+	if h.policy == FontPreserve {
+		h.warn("font %s kept with its %s obfuscation", r.Path, obfuscationName(algorithm))
+		return false, nil
+	}
+	key, length, err := obfuscationKey(algorithm, h.uniqueID, h.identifiers)
+	if err != nil {
+		h.warn("font %s kept with its %s obfuscation: %v", r.Path, obfuscationName(algorithm), err)
+		return false, nil
+	}
+	data, err := io.ReadAll(r.Contents)
+	if err != nil {
+		return false, err
+	}
+	deobfuscate(data, key, length)
+	r.Contents = bytes.NewReader(data)
+	removeData(h.enc, r.Path)
+	if h.policy == FontStrip {
+		h.warn("font %s deobfuscated (%s) and left in clear", r.Path, obfuscationName(algorithm))
+	} else {
+		h.warn("font %s deobfuscated (%s) and encrypted", r.Path, obfuscationName(algorithm))
+	}
+	return true, nil
+}
+
+func (h *fontHandler) warn(format string, args ...any) {
+	h.warnings = append(h.warnings, fmt.Sprintf(format, args...))
+}
+
+// obfuscationName returns a short name of an obfuscation algorithm.
+func obfuscationName(algorithm string) string {
+	if algorithm == AlgorithmAdobeObfuscation {
+		return "Adobe"
+	}
+	return "IDPF"
+}
+
+// obfuscationKey returns the key of an obfuscation algorithm and the number of obfuscated bytes.
+// The IDPF key is the SHA-1 digest of the unique identifier, without white space; the Adobe key
+// is the UUID of the publication.
+func obfuscationKey(algorithm, uniqueID string, identifiers []string) ([]byte, int, error) {
+	switch algorithm {
+	case AlgorithmIDPFObfuscation:
+		if uniqueID == "" {
+			return nil, 0, errors.New("no unique identifier")
+		}
+		id := strings.Map(func(r rune) rune {
+			switch r {
+			case ' ', '\t', '\r', '\n':
+				return -1
+			}
+			return r
+		}, uniqueID)
+		sum := sha1.Sum([]byte(id))
+		return sum[:], idpfObfuscatedLength, nil
+	case AlgorithmAdobeObfuscation:
+		for _, id := range append([]string{uniqueID}, identifiers...) {
+			id = strings.TrimSpace(id)
+			if !strings.HasPrefix(id, "urn:uuid:") {
+				continue
+			}
+			key, err := hex.DecodeString(strings.ReplaceAll(strings.TrimPrefix(id, "urn:uuid:"), "-", ""))
+			if err == nil && len(key) == 16 {
+				return key, adobeObfuscatedLength, nil
+			}
+		}
+		return nil, 0, errors.New("no UUID identifier")
+	}
+	return nil, 0, errors.New("unknown obfuscation algorithm " + algorithm)
+}
+
+// deobfuscate XORs the first length bytes of data with the key; obfuscation is symmetric.
+func deobfuscate(data, key []byte, length int) {
+	for i := 0; i < length && i < len(data); i++ {
+		data[i] ^= key[i%len(key)]
+	}
+}
+
+// removeData removes the declaration of a resource from an encryption manifest.
+func removeData(enc *xmlenc.Manifest, path string) {
+	uri := xmlenc.URI(xmlenc.ResourcePathEscape(path))
+	data := enc.Data[:0]
+	for _, d := range enc.Data {
+		if d.CipherData.CipherReference.URI != uri {
+			data = append(data, d)
+		}
+	}
+	enc.Data = data
+}
+
+// readIdentifiers returns the unique identifier and all the identifiers of a package document.
+func readIdentifiers(zr *zip.Reader, opfPath string) (string, []string, error) {
+	var p struct {
+		UniqueIdentifier string `xml:"unique-identifier,attr"`
+		Identifiers      []struct {
+			ID    string `xml:"id,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"metadata>identifier"`
+	}
+	if err := decodePackageDocument(zr, opfPath, &p); err != nil {
+		return "", nil, err
+	}
+	var uniqueID string
+	var ids []string
+	for _, id := range p.Identifiers {
+		if id.ID == p.UniqueIdentifier {
+			uniqueID = strings.TrimSpace(id.Value)
+		}
+		ids = append(ids, id.Value)
+	}
+	return uniqueID, ids, nil
+}
@@ -0,0 +1,198 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package pack
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/edrlab/lcp-server/pkg/test"
+	"github.com/readium/readium-lcp-server/crypto"
+)
+
+const fontEncryptionXML = `<?xml version="1.0" encoding="UTF-8"?>
+<encryption xmlns="urn:oasis:names:tc:opendocument:xmlns:container" xmlns:enc="http://www.w3.org/2001/04/xmlenc#">
+  <enc:EncryptedData>
+    <enc:EncryptionMethod Algorithm="http://www.idpf.org/2008/embedding"/>
+    <enc:CipherData><enc:CipherReference URI="OEBPS/fonts/idpf.otf"/></enc:CipherData>
+  </enc:EncryptedData>
+  <enc:EncryptedData>
+    <enc:EncryptionMethod Algorithm="http://ns.adobe.com/pdf/enc#RC"/>
+    <enc:CipherData><enc:CipherReference URI="OEBPS/fonts/adobe.otf"/></enc:CipherData>
+  </enc:EncryptedData>
+</encryption>`
+
+// testFont returns the content of a fake font, longer than the obfuscated headers.
+func testFont() []byte {
+	font := make([]byte, 2000)
+	for i := range font {
+		font[i] = byte(i % 251)
+	}
+	return font
+}
+
+// obfuscate returns data with its first length bytes XORed with the key.
+func obfuscate(data, key []byte, length int) string {
+	res := slices.Clone(data)
+	for i := 0; i < length; i++ {
+		res[i] ^= key[i%len(key)]
+	}
+	return string(res)
+}
+
+// writeFontEPUB generates an EPUB with a font obfuscated with the IDPF algorithm,
+// and a font obfuscated with the Adobe algorithm.
+func writeFontEPUB(t testing.TB, path string) {
+	idpfKey := sha1.Sum([]byte("urn:uuid:4b2c3d60-2c7a-4b8e-9d0f-0c5a2f1b7e41"))
+	adobeKey, _ := hex.DecodeString("4b2c3d602c7a4b8e9d0f0c5a2f1b7e41")
+	test.WriteEPUB(t, path, map[string]string{
+		"OEBPS/content.opf": test.OPF(`<dc:title>Fonts</dc:title>`,
+			`<item id="ch1" href="chapter1.xhtml" media-type="application/xhtml+xml"/>
+			<item id="f1" href="fonts/idpf.otf" media-type="application/vnd.ms-opentype"/>
+			<item id="f2" href="fonts/adobe.otf" media-type="application/vnd.ms-opentype"/>`,
+			`<spine><itemref idref="ch1"/></spine>`),
+		"META-INF/encryption.xml": fontEncryptionXML,
+		"OEBPS/chapter1.xhtml":    testChapter,
+		"OEBPS/fonts/idpf.otf":    obfuscate(testFont(), idpfKey[:], 1040),
+		"OEBPS/fonts/adobe.otf":   obfuscate(testFont(), adobeKey, 1024),
+	})
+}
+
+func TestEncryptEPUBFontPolicies(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "fonts.epub")
+	writeFontEPUB(t, input)
+	fonts := []string{"OEBPS/fonts/adobe.otf", "OEBPS/fonts/idpf.otf"}
+	source := readZip(t, input)
+
+	for _, policy := range []FontPolicy{"", FontPreserve, FontStrip, FontEncrypt} {
+		output := filepath.Join(dir, "encrypted.epub")
+		res, err := EncryptEPUB(input, output, Options{CompressionLevel: DefaultCompression, FontPolicy: policy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Warnings) != 2 {
+			t.Errorf("%q: expected a warning per font, got %q", policy, res.Warnings)
+		}
+		files := readZip(t, output)
+		paths := encryptedPaths(t, output)
+		for _, font := range fonts {
+			var report Resource
+			for _, r := range res.Resources {
+				if r.Path == font {
+					report = r
+				}
+			}
+			data := []byte(readAll(t, files[font].Open))
+			switch policy {
+			case "", FontPreserve:
+				if report.Reason != ReasonAlreadyEncrypted || !slices.Contains(paths, font) {
+					t.Errorf("%q: %s should be kept obfuscated, got %+v", policy, font, report)
+				}
+				if !bytes.Equal(data, []byte(readAll(t, source[font].Open))) {
+					t.Errorf("%q: %s should be copied as-is", policy, font)
+				}
+			case FontStrip:
+				if report.Reason != ReasonDeobfuscated || slices.Contains(paths, font) {
+					t.Errorf("%q: %s should be left in clear, got %+v", policy, font, report)
+				}
+				if !bytes.Equal(data, testFont()) {
+					t.Errorf("%q: %s is not deobfuscated", policy, font)
+				}
+			case FontEncrypt:
+				if !report.Encrypted || !slices.Contains(paths, font) {
+					t.Errorf("%q: %s should be encrypted, got %+v", policy, font, report)
+				}
+				var compressed bytes.Buffer
+				if err := crypto.NewAESEncrypter_PUBLICATION_RESOURCES().(crypto.Decrypter).Decrypt(res.Key, bytes.NewReader(data), &compressed); err != nil {
+					t.Fatal(err)
+				}
+				clear, err := io.ReadAll(flate.NewReader(&compressed))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(clear, testFont()) {
+					t.Errorf("%q: %s is not deobfuscated before its encryption", policy, font)
+				}
+			}
+		}
+	}
+}
+
+// Without the identifier the key derives from, obfuscated fonts are preserved.
+func TestEncryptEPUBFontWithoutKey(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "fonts.epub")
+	test.WriteEPUB(t, input, map[string]string{
+		"OEBPS/content.opf": `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="uid">isbn:9780000000000</dc:identifier>
+    <dc:title>Fonts</dc:title>
+  </metadata>
+  <manifest>
+    <item id="f2" href="fonts/adobe.otf" media-type="application/vnd.ms-opentype"/>
+  </manifest>
+  <spine/>
+</package>`,
+		"META-INF/encryption.xml": fontEncryptionXML,
+		"OEBPS/fonts/adobe.otf":   string(testFont()),
+	})
+	res, err := EncryptEPUB(input, filepath.Join(dir, "encrypted.epub"), Options{CompressionLevel: DefaultCompression, FontPolicy: FontStrip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range res.Resources {
+		if r.Path == "OEBPS/fonts/adobe.otf" && r.Reason != ReasonAlreadyEncrypted {
+			t.Errorf("The font should be preserved, got %+v", r)
+		}
+	}
+	if len(res.Warnings) != 1 {
+		t.Errorf("Expected a warning, got %q", res.Warnings)
+	}
+}
+
+// A package document declaring XML 1.1 is read as XML 1.0, as epub.Read does.
+func TestEncryptEPUBXML11(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "fonts.epub")
+	writeFontEPUB(t, input)
+	files := map[string]string{}
+	for name, f := range readZip(t, input) {
+		if name != "mimetype" && name != "META-INF/container.xml" {
+			files[name] = readAll(t, f.Open)
+		}
+	}
+	files["OEBPS/content.opf"] = strings.Replace(files["OEBPS/content.opf"], `version="1.0"`, `version="1.1"`, 1)
+	test.WriteEPUB(t, input, files)
+
+	output := filepath.Join(dir, "encrypted.epub")
+	res, err := EncryptEPUB(input, output, Options{CompressionLevel: DefaultCompression, FontPolicy: FontStrip, MinEncryptSize: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := encryptedPaths(t, output); !slices.Equal(got, []string{"OEBPS/chapter1.xhtml"}) {
+		t.Errorf("Expected only the spine item to be encrypted, got %v", got)
+	}
+	for _, r := range res.Resources {
+		if r.Path == "OEBPS/fonts/idpf.otf" && r.Reason != ReasonDeobfuscated {
+			t.Errorf("Expected the IDPF font to be deobfuscated, got %+v", r)
+		}
+	}
+}
+
+func TestParseFontPolicy(t *testing.T) {
+	if p, err := ParseFontPolicy(""); err != nil || p != FontPreserve {
+		t.Errorf("Expected the preserve policy by default, got %q (%v)", p, err)
+	}
+	if _, err := ParseFontPolicy("remove"); err == nil {
+		t.Error("Expected an error for an unknown policy")
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package pack
+
+import (
+	"bytes"
+	"mime"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// mediaTypeAliases are the nonstandard media types found in the manifests of EPUBs,
+// mapped to the canonical media type of the resources with the given extensions.
+var mediaTypeAliases = []struct {
+	extensions []string
+	canonical  string
+	aliases    []string
+}{
+	{[]string{".xhtml", ".xht", ".html", ".htm"}, "application/xhtml+xml", []string{"text/xml", "application/xml", "text/xhtml", "application/xhtml", "application/xhtml-xml"}},
+	{[]string{".svg"}, "image/svg+xml", []string{"text/xml", "application/xml", "image/svg", "image/svg-xml", "application/svg+xml"}},
+	{[]string{".css"}, "text/css", []string{"text/plain", "style/css", "application/css", "text/x-css"}},
+	{[]string{".jpg", ".jpeg", ".jpe"}, "image/jpeg", []string{"image/jpg", "image/pjpeg"}},
+	{[]string{".png"}, "image/png", []string{"image/x-png"}},
+	{[]string{".ncx"}, "application/x-dtbncx+xml", []string{"text/xml", "application/xml", "application/x-dtbncx"}},
+}
+
+// CanonicalMediaType returns the canonical form of the media type declared for the manifest item at href:
+// lower case, without parameters, and the standard media type of its extension instead of a known alias,
+// e.g. application/xhtml+xml for an XHTML document declared as text/xml. Other media types are kept.
+func CanonicalMediaType(href, declared string) string {
+	mediaType := strings.ToLower(strings.TrimSpace(declared))
+	if mt, _, err := mime.ParseMediaType(mediaType); err == nil {
+		mediaType = mt
+	}
+	if name, err := url.PathUnescape(href); err == nil {
+		href = name
+	}
+	ext := strings.ToLower(path.Ext(href))
+	for _, a := range mediaTypeAliases {
+		if slices.Contains(a.extensions, ext) && slices.Contains(a.aliases, mediaType) {
+			return a.canonical
+		}
+	}
+	if mediaType == "" {
+		return declared
+	}
+	return mediaType
+}
+
+// manifestItem matches the item elements of a package document, whatever their prefix.
+var manifestItem = regexp.MustCompile(`<(?:[\w.-]+:)?item\s[^>]*>`)
+
+// itemAttr matches the value of an attribute of an item element.
+func itemAttr(name string) *regexp.Regexp {
+	return regexp.MustCompile(`\s` + name + `\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+}
+
+var (
+	itemHref      = itemAttr("href")
+	itemMediaType = itemAttr("media-type")
+)
+
+// normalizeManifest returns the package document with the canonical media types of its manifest items.
+// The document is edited as text, so that the rest of it is kept as-is.
+func normalizeManifest(opf []byte) []byte {
+	return manifestItem.ReplaceAllFunc(opf, func(item []byte) []byte {
+		href := itemHref.FindSubmatch(item)
+		loc := itemMediaType.FindSubmatchIndex(item)
+		if href == nil || loc == nil {
+			return item
+		}
+		// the value is in the first group if double-quoted, else in the second
+		start, end := loc[2], loc[3]
+		if start < 0 {
+			start, end = loc[4], loc[5]
+		}
+		declared := string(item[start:end])
+		canonical := CanonicalMediaType(string(bytes.Join(href[1:], nil)), declared)
+		if canonical == declared {
+			return item
+		}
+		res := slices.Clone(item[:start])
+		res = append(res, xmlEscape(canonical)...)
+		return append(res, item[end:]...)
+	})
+}
@@ -0,0 +1,93 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package pack
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/edrlab/lcp-server/pkg/test"
+)
+
+func TestCanonicalMediaType(t *testing.T) {
+	cases := []struct {
+		href, declared, expected string
+	}{
+		{"chapter1.xhtml", "application/xhtml+xml", "application/xhtml+xml"},
+		{"chapter1.xhtml", "text/xml", "application/xhtml+xml"},
+		{"Text/Chapter%201.XHTML", "application/xml", "application/xhtml+xml"},
+		{"chapter1.xhtml", "Application/XHTML+XML; charset=utf-8", "application/xhtml+xml"},
+		{"map.svg", "text/xml", "image/svg+xml"},
+		{"style.css", "text/plain", "text/css"},
+		{"cover.jpg", "image/jpg", "image/jpeg"},
+		{"toc.ncx", "text/xml", "application/x-dtbncx+xml"},
+		// the alias of a media type is only normalized for the extensions of the media type
+		{"data.xml", "text/xml", "text/xml"},
+		// text/html documents may not be well-formed XML
+		{"chapter1.html", "text/html", "text/html"},
+		{"font.otf", "application/vnd.ms-opentype", "application/vnd.ms-opentype"},
+		{"unknown", "", ""},
+	}
+	for _, c := range cases {
+		if got := CanonicalMediaType(c.href, c.declared); got != c.expected {
+			t.Errorf("%s declared as %q: expected %q, got %q", c.href, c.declared, c.expected, got)
+		}
+	}
+}
+
+func TestEncryptEPUBNormalizeMediaTypes(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "test.epub")
+	opf := test.OPF(`<dc:title>Media types</dc:title>`,
+		`<item id="ch1" href="chapter1.xhtml" media-type="text/xml"/>
+			<item id="css" href='style.css' media-type='text/plain'/>
+			<item id="cover" href="images/cover.jpg" media-type="image/jpeg" properties="cover-image"/>`,
+		`<spine><itemref idref="ch1"/></spine>`)
+	test.WriteEPUB(t, input, map[string]string{
+		"OEBPS/content.opf":      opf,
+		"OEBPS/chapter1.xhtml":   testChapter,
+		"OEBPS/style.css":        "p {}",
+		"OEBPS/images/cover.jpg": "cover",
+	})
+
+	// media types are kept by default
+	output := filepath.Join(dir, "default.epub")
+	res, err := EncryptEPUB(input, output, Options{CompressionLevel: DefaultCompression})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, readZip(t, output)["OEBPS/content.opf"].Open); got != opf {
+		t.Errorf("Expected the package document unchanged, got %s", got)
+	}
+	for _, r := range res.Resources {
+		if r.DeclaredMediaType != "" {
+			t.Errorf("Unexpected normalization of %s", r.Path)
+		}
+	}
+
+	output = filepath.Join(dir, "normalized.epub")
+	res, err = EncryptEPUB(input, output, Options{CompressionLevel: DefaultCompression, NormalizeMediaTypes: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][2]string{
+		"OEBPS/chapter1.xhtml":   {"application/xhtml+xml", "text/xml"},
+		"OEBPS/style.css":        {"text/css", "text/plain"},
+		"OEBPS/images/cover.jpg": {"image/jpeg", ""},
+	}
+	for _, r := range res.Resources {
+		if e, ok := expected[r.Path]; ok && (r.MediaType != e[0] || r.DeclaredMediaType != e[1]) {
+			t.Errorf("Unexpected report for %s: %+v", r.Path, r)
+		}
+	}
+	if len(res.Warnings) != 2 || !strings.Contains(res.Warnings[0], `OEBPS/chapter1.xhtml declared as "text/xml", normalized to application/xhtml+xml`) {
+		t.Errorf("Unexpected warnings %q", res.Warnings)
+	}
+	normalized := readAll(t, readZip(t, output)["OEBPS/content.opf"].Open)
+	if !strings.Contains(normalized, `<item id="ch1" href="chapter1.xhtml" media-type="application/xhtml+xml"/>`) ||
+		!strings.Contains(normalized, `<item id="css" href='style.css' media-type='text/css'/>`) ||
+		!strings.Contains(normalized, `<item id="cover" href="images/cover.jpg" media-type="image/jpeg" properties="cover-image"/>`) {
+		t.Errorf("Unexpected package document %s", normalized)
+	}
+}
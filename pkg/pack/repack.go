@@ -0,0 +1,141 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+// Package pack generates encrypted EPUB containers, and post-processes the containers
+// generated by the LCP encryption tool.
+package pack
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/readium/readium-lcp-server/epub"
+	"github.com/readium/readium-lcp-server/xmlenc"
+)
+
+// DefaultCompression keeps the compression applied by the packager.
+const DefaultCompression = -1
+
+// Options drives the packaging of an encrypted container.
+type Options struct {
+	// CompressionLevel is the deflate level applied to clear resources,
+	// from flate.NoCompression (store only) to flate.BestCompression.
+	CompressionLevel int
+	// ClearPolicy selects the EPUB resources left in clear
+	ClearPolicy ClearPolicy
+	// FontPolicy selects the processing of the fonts obfuscated in the source EPUB
+	FontPolicy FontPolicy
+	// MinEncryptSize is the size, in bytes, under which the EPUB resources are left in clear,
+	// except the documents of the spine; 0 encrypts resources whatever their size
+	MinEncryptSize int64
+	// ContentKey is the content key of an EPUB, e.g. an escrowed key reused for a re-encryption;
+	// a new key is generated if not set
+	ContentKey []byte
+	// NormalizeMediaTypes replaces the nonstandard media types of the manifest of an EPUB
+	// by canonical media types, see CanonicalMediaType
+	NormalizeMediaTypes bool
+}
+
+// Repack rewrites the container at src into dst, applying the options.
+// Encrypted resources are copied byte for byte: they are never recompressed,
+// as compression, when needed, has been applied before encryption.
+// Resources stored without compression (mimetype, media) are also kept as-is.
+func Repack(src, dst string, opts Options) error {
+	if opts.CompressionLevel < flate.NoCompression || opts.CompressionLevel > flate.BestCompression {
+		return errors.New("invalid compression level")
+	}
+
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	enc, err := readEncryption(&zr.Reader)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	zw := zip.NewWriter(out)
+	zw.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(w, opts.CompressionLevel)
+	})
+
+	for _, f := range zr.File {
+		if _, encrypted := enc.DataForFile(f.Name); encrypted || f.Method == zip.Store {
+			err = copyRaw(zw, f)
+		} else {
+			err = recompress(zw, f, opts.CompressionLevel)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// readEncryption parses the encryption file of an EPUB, if any.
+// Other packages (Readium Packages) store their encrypted resources uncompressed.
+func readEncryption(zr *zip.Reader) (xmlenc.Manifest, error) {
+	for _, f := range zr.File {
+		if f.Name != epub.EncryptionFile {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return xmlenc.Manifest{}, err
+		}
+		defer rc.Close()
+		return xmlenc.Read(rc)
+	}
+	return xmlenc.Manifest{}, nil
+}
+
+// copyRaw copies a zip entry without decompressing it.
+func copyRaw(zw *zip.Writer, f *zip.File) error {
+	r, err := f.OpenRaw()
+	if err != nil {
+		return err
+	}
+	w, err := zw.CreateRaw(&f.FileHeader)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// recompress copies a zip entry after compressing it at the requested level.
+func recompress(zw *zip.Writer, f *zip.File, level int) error {
+	method := zip.Deflate
+	if level == flate.NoCompression {
+		method = zip.Store
+	}
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     f.Name,
+		Method:   method,
+		Modified: f.Modified,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
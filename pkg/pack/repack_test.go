@@ -0,0 +1,124 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package pack
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/edrlab/lcp-server/pkg/test"
+	"github.com/readium/readium-lcp-server/encrypt"
+)
+
+// writeTestEPUB generates a small EPUB; the nav document is left clear by the packager.
+func writeTestEPUB(t testing.TB, path string) {
+	test.WriteEPUB(t, path, map[string]string{
+		"OEBPS/nav.xhtml":      "<html><body><nav>" + strings.Repeat("<li><a href=\"chapter1.xhtml\">Chapter</a></li>", 2000) + "</nav></body></html>",
+		"OEBPS/chapter1.xhtml": "<html><body>" + strings.Repeat("<p>Lorem ipsum dolor sit amet.</p>", 2000) + "</body></html>",
+	})
+}
+
+// encryptTestEPUB returns the path of an encrypted test EPUB.
+func encryptTestEPUB(t testing.TB) string {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "test.epub")
+	writeTestEPUB(t, input)
+	pub, err := encrypt.ProcessEncryption("", "", input, "", dir, "", "", "", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, pub.FileName)
+}
+
+func readZip(t testing.TB, path string) map[string]*zip.File {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { zr.Close() })
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	return files
+}
+
+func rawBytes(t testing.TB, f *zip.File) []byte {
+	r, err := f.OpenRaw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(r)
+	return b
+}
+
+func TestRepack(t *testing.T) {
+	src := encryptTestEPUB(t)
+	before := readZip(t, src)
+
+	for _, level := range []int{flate.NoCompression, flate.BestCompression} {
+		dst := filepath.Join(t.TempDir(), "out.epub")
+		if err := Repack(src, dst, Options{CompressionLevel: level}); err != nil {
+			t.Fatalf("Repack failed at level %d: %v", level, err)
+		}
+		after := readZip(t, dst)
+		if len(after) != len(before) {
+			t.Fatalf("Expected %d entries, got %d", len(before), len(after))
+		}
+
+		// the encrypted resource must be copied byte for byte
+		enc := "OEBPS/chapter1.xhtml"
+		if !bytes.Equal(rawBytes(t, before[enc]), rawBytes(t, after[enc])) || after[enc].Method != zip.Store {
+			t.Errorf("Encrypted resource modified at level %d", level)
+		}
+		// mimetype must remain stored
+		if after["mimetype"].Method != zip.Store {
+			t.Errorf("mimetype compressed at level %d", level)
+		}
+		// clear resources are recompressed at the requested level
+		nav := "OEBPS/nav.xhtml"
+		expected := uint16(zip.Deflate)
+		if level == flate.NoCompression {
+			expected = zip.Store
+		}
+		if after[nav].Method != expected {
+			t.Errorf("Expected method %d for a clear resource at level %d, got %d", expected, level, after[nav].Method)
+		}
+		if after[nav].CRC32 != before[nav].CRC32 {
+			t.Errorf("Clear resource content modified at level %d", level)
+		}
+	}
+}
+
+func TestRepackInvalidLevel(t *testing.T) {
+	src := encryptTestEPUB(t)
+	dst := filepath.Join(t.TempDir(), "out.epub")
+	if err := Repack(src, dst, Options{CompressionLevel: 12}); err == nil {
+		t.Error("Expected an error for an invalid compression level")
+	}
+}
+
+// BenchmarkRepack compares output size and processing time at several compression levels.
+func BenchmarkRepack(b *testing.B) {
+	src := encryptTestEPUB(b)
+	for _, level := range []int{flate.NoCompression, flate.BestSpeed, 6, flate.BestCompression} {
+		b.Run(fmt.Sprintf("level=%d", level), func(b *testing.B) {
+			dst := filepath.Join(b.TempDir(), "out.epub")
+			for i := 0; i < b.N; i++ {
+				if err := Repack(src, dst, Options{CompressionLevel: level}); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if info, err := os.Stat(dst); err == nil {
+				b.ReportMetric(float64(info.Size()), "bytes")
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package pack
+
+import (
+	"archive/zip"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// ResourceLink is an entry of the resource map of an EPUB, which lets reading systems
+// plan the fetch of the resources before the acquisition of a license.
+type ResourceLink struct {
+	Href      string `json:"href"` // as declared in the manifest, relative to the package document
+	Path      string `json:"path"` // in the container
+	MediaType string `json:"media_type,omitempty"`
+	Encrypted bool   `json:"encrypted"`
+}
+
+// ResourceMap lists the resources declared in the manifests of the EPUB at src, in manifest order,
+// with their encryption as reported by resources. Remote resources are not listed.
+func ResourceMap(src string, resources []Resource) ([]ResourceLink, error) {
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	rootFiles, err := readRootFiles(&zr.Reader)
+	if err != nil {
+		return nil, err
+	}
+	encrypted := make(map[string]bool, len(resources))
+	for _, r := range resources {
+		encrypted[r.Path] = r.Encrypted
+	}
+
+	links := []ResourceLink{}
+	for _, rootFile := range rootFiles {
+		var p struct {
+			Items []struct {
+				Href      string `xml:"href,attr"`
+				MediaType string `xml:"media-type,attr"`
+			} `xml:"manifest>item"`
+		}
+		if err := decodePackageDocument(&zr.Reader, rootFile, &p); err != nil {
+			return nil, err
+		}
+		for _, item := range p.Items {
+			if u, err := url.Parse(item.Href); err != nil || u.IsAbs() || strings.HasPrefix(item.Href, "//") {
+				continue
+			}
+			href := item.Href
+			if unescaped, err := url.PathUnescape(href); err == nil {
+				href = unescaped
+			}
+			name := path.Join(path.Dir(rootFile), href)
+			links = append(links, ResourceLink{
+				Href:      item.Href,
+				Path:      name,
+				MediaType: item.MediaType,
+				Encrypted: encrypted[name],
+			})
+		}
+	}
+	return links, nil
+}
@@ -0,0 +1,236 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package pack
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/readium/readium-lcp-server/crypto"
+)
+
+// ErrSelfTest is returned when a resource of an encrypted container does not decrypt
+// to its clear content.
+var ErrSelfTest = errors.New("self-test failed")
+
+// sample is an encrypted resource which can be checked by the self-test.
+type sample struct {
+	path       string
+	compressed bool // deflated before its encryption
+}
+
+// SelfTest checks that the encrypted container at dst can be decrypted with the content key:
+// its first encrypted resource is decrypted and compared to the same resource in the clear
+// publication at src. Resources already encrypted in the source, e.g. obfuscated fonts, are not
+// compared, as their source is not clear. Resources are streamed, so that the memory used does
+// not depend on their size. A container without encrypted resources passes the test.
+func SelfTest(src, dst string, key crypto.ContentKey) error {
+	zr, err := zip.OpenReader(dst)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	samples, err := encryptedResources(&zr.Reader)
+	if err != nil {
+		return err
+	}
+
+	// a PDF is the single resource of its LCP package
+	if filepath.Ext(src) == ".pdf" {
+		if len(samples) == 0 {
+			return nil
+		}
+		f, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return checkSample(&zr.Reader, samples[0], f, key)
+	}
+
+	sr, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer sr.Close()
+	srcEnc, err := readEncryption(&sr.Reader)
+	if err != nil {
+		return err
+	}
+	for _, s := range samples {
+		if _, encrypted := srcEnc.DataForFile(s.path); encrypted {
+			continue
+		}
+		f, err := sr.Open(s.path)
+		if err != nil {
+			return fmt.Errorf("%w: %s: no clear resource: %v", ErrSelfTest, s.path, err)
+		}
+		defer f.Close()
+		return checkSample(&zr.Reader, s, f, key)
+	}
+	return nil
+}
+
+// checkSample compares the decrypted content of an encrypted resource with its clear content.
+func checkSample(zr *zip.Reader, s sample, clear io.Reader, key crypto.ContentKey) error {
+	f, err := zr.Open(s.path)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrSelfTest, s.path, err)
+	}
+	defer f.Close()
+	decrypted, err := decryptedDigest(f, key, s.compressed)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrSelfTest, s.path, err)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, clear); err != nil {
+		return err
+	}
+	if !bytes.Equal(decrypted, h.Sum(nil)) {
+		return fmt.Errorf("%w: %s: the decrypted content does not match the original", ErrSelfTest, s.path)
+	}
+	return nil
+}
+
+// encryptedResources returns the encrypted resources of a container, declared in the encryption file
+// of an EPUB or in the manifest of a Readium Package. Obfuscated fonts are not encrypted resources.
+func encryptedResources(zr *zip.Reader) ([]sample, error) {
+	algorithm := crypto.NewAESEncrypter_PUBLICATION_RESOURCES().Signature()
+	enc, err := readEncryption(zr)
+	if err != nil {
+		return nil, err
+	}
+	var samples []sample
+	for _, data := range enc.Data {
+		if string(data.Method.Algorithm) != algorithm {
+			continue
+		}
+		name, err := url.PathUnescape(string(data.CipherData.CipherReference.URI))
+		if err != nil {
+			return nil, err
+		}
+		s := sample{path: name}
+		if data.Properties != nil {
+			for _, p := range data.Properties.Properties {
+				s.compressed = s.compressed || p.Compression.Method == int(zip.Deflate)
+			}
+		}
+		samples = append(samples, s)
+	}
+	if len(samples) > 0 {
+		return samples, nil
+	}
+
+	f, err := zr.Open(ManifestName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	type link struct {
+		Href       string `json:"href"`
+		Properties struct {
+			Encrypted *struct {
+				Algorithm   string `json:"algorithm"`
+				Compression string `json:"compression"`
+			} `json:"encrypted"`
+		} `json:"properties"`
+	}
+	var manifest struct {
+		ReadingOrder []link `json:"readingOrder"`
+		Resources    []link `json:"resources"`
+	}
+	if err := json.NewDecoder(f).Decode(&manifest); err != nil {
+		return nil, err
+	}
+	for _, l := range append(manifest.ReadingOrder, manifest.Resources...) {
+		if e := l.Properties.Encrypted; e != nil && e.Algorithm == algorithm {
+			samples = append(samples, sample{path: l.Href, compressed: e.Compression == "deflate"})
+		}
+	}
+	return samples, nil
+}
+
+// decryptedDigest returns the SHA-256 digest of a resource, after its decryption and decompression.
+func decryptedDigest(r io.Reader, key crypto.ContentKey, compressed bool) ([]byte, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(decryptCBC(key, r, pw))
+	}()
+	defer pr.Close()
+	var clear io.Reader = pr
+	if compressed {
+		fr := flate.NewReader(pr)
+		defer fr.Close()
+		clear = fr
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, clear); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// decryptCBC decrypts an AES-CBC stream, made of the IV followed by the padded ciphertext.
+// Unlike the decrypter of the LCP library, it does not load the whole resource in memory,
+// and reports invalid input instead of panicking.
+func decryptCBC(key crypto.ContentKey, r io.Reader, w io.Writer) error {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(r, iv); err != nil {
+		return errors.New("truncated encrypted data")
+	}
+	mode := cipher.NewCBCDecrypter(block, iv)
+
+	buf := make([]byte, 32*1024)
+	var last []byte // the last block holds the padding, it is written at the end
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n%aes.BlockSize != 0 {
+			return errors.New("encrypted data is not a multiple of the block size")
+		}
+		if n > 0 {
+			mode.CryptBlocks(buf[:n], buf[:n])
+			if last != nil {
+				if _, err := w.Write(last); err != nil {
+					return err
+				}
+			}
+			if _, err := w.Write(buf[:n-aes.BlockSize]); err != nil {
+				return err
+			}
+			last = append(last[:0], buf[n-aes.BlockSize:n]...)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if last == nil {
+		return errors.New("no encrypted data")
+	}
+	padding := int(last[aes.BlockSize-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return errors.New("invalid padding")
+	}
+	_, err = w.Write(last[:aes.BlockSize-padding])
+	return err
+}
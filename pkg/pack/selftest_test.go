@@ -0,0 +1,101 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package pack
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/edrlab/lcp-server/pkg/test"
+	"github.com/readium/readium-lcp-server/crypto"
+	"github.com/readium/readium-lcp-server/encrypt"
+)
+
+func TestSelfTestEPUB(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "test.epub")
+	writePolicyEPUB(t, input)
+	output := filepath.Join(dir, "encrypted.epub")
+	res, err := EncryptEPUB(input, output, Options{CompressionLevel: DefaultCompression})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SelfTest(input, output, res.Key); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	// another key
+	key := bytes.Repeat([]byte{1}, 32)
+	if err := SelfTest(input, output, key); !errors.Is(err, ErrSelfTest) {
+		t.Errorf("Expected a self-test failure, got %v", err)
+	}
+
+	// another clear content
+	other := filepath.Join(dir, "other.epub")
+	test.WriteEPUB(t, other, map[string]string{"OEBPS/chapter1.xhtml": "<html><body><p>Other</p></body></html>"})
+	if err := SelfTest(other, output, res.Key); !errors.Is(err, ErrSelfTest) || !strings.Contains(err.Error(), "OEBPS/chapter1.xhtml") {
+		t.Errorf("Expected a self-test failure naming the resource, got %v", err)
+	}
+}
+
+// Fonts deobfuscated before their encryption are not compared to their obfuscated source.
+func TestSelfTestDeobfuscatedFonts(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "fonts.epub")
+	writeFontEPUB(t, input)
+	output := filepath.Join(dir, "encrypted.epub")
+	res, err := EncryptEPUB(input, output, Options{CompressionLevel: DefaultCompression, FontPolicy: FontEncrypt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SelfTest(input, output, res.Key); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestSelfTestAudiobook(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "test.audiobook")
+	writeTestAudiobook(t, input)
+	pub, err := encrypt.ProcessEncryption("", "", input, "", dir, "", "", "", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, pub.FileName)
+	if err := SelfTest(input, output, pub.EncryptionKey); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err := SelfTest(input, output, bytes.Repeat([]byte{1}, 32)); !errors.Is(err, ErrSelfTest) {
+		t.Errorf("Expected a self-test failure, got %v", err)
+	}
+}
+
+func TestDecryptCBC(t *testing.T) {
+	encrypter := crypto.NewAESEncrypter_PUBLICATION_RESOURCES()
+	key, err := encrypter.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{0, 15, 16, 17, 32 * 1024, 100000} {
+		clear := bytes.Repeat([]byte{'x'}, size)
+		var encrypted, decrypted bytes.Buffer
+		if err := encrypter.Encrypt(key, bytes.NewReader(clear), &encrypted); err != nil {
+			t.Fatal(err)
+		}
+		if err := decryptCBC(key, &encrypted, &decrypted); err != nil {
+			t.Errorf("%d bytes: unexpected error %v", size, err)
+		} else if !bytes.Equal(decrypted.Bytes(), clear) {
+			t.Errorf("%d bytes: unexpected decrypted content", size)
+		}
+	}
+
+	// invalid input is reported
+	for _, input := range [][]byte{nil, make([]byte, 16), make([]byte, 20)} {
+		if err := decryptCBC(key, bytes.NewReader(input), &bytes.Buffer{}); err == nil {
+			t.Errorf("%d bytes: expected an error", len(input))
+		}
+	}
+}
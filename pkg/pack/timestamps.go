@@ -0,0 +1,114 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package pack
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// minEntryTime and maxEntryTime bound the times which can be stored in a zip entry (MS-DOS time).
+var (
+	minEntryTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+	maxEntryTime = time.Date(2107, 12, 31, 23, 59, 58, 0, time.UTC)
+)
+
+// EntryTimestampPublicationDate is the entry timestamp setting which selects the publication date.
+const EntryTimestampPublicationDate = "publication_date"
+
+// ParseEntryTimestamp checks an entry timestamp setting: EntryTimestampPublicationDate, for which
+// the returned time is zero, or a fixed RFC 3339 time.
+func ParseEntryTimestamp(value string) (time.Time, error) {
+	if value == EntryTimestampPublicationDate {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("entry timestamp %q is neither %s nor an RFC 3339 time", value, EntryTimestampPublicationDate)
+	}
+	return t, nil
+}
+
+// Extra fields holding timestamps, replaced by the MS-DOS time of the entry
+var timestampFields = map[uint16]bool{
+	0x000a: true, // NTFS
+	0x5455: true, // extended timestamp
+	0x5855: true, // Info-ZIP Unix (original)
+}
+
+// SetTimestamps rewrites the container at src into dst, setting the modification time
+// of every entry to modified, at a two-second precision. Times before 1980 are set to 1980-01-01,
+// times after 2107 to 2107-12-31. Entries are copied byte for byte.
+func SetTimestamps(src, dst string, modified time.Time) error {
+	date, tm := msDosTime(modified)
+
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	zw := zip.NewWriter(out)
+	for _, f := range zr.File {
+		fh := f.FileHeader
+		fh.ModifiedDate, fh.ModifiedTime = date, tm
+		fh.Modified = time.Time{}
+		fh.Extra = stripTimestamps(fh.Extra)
+		r, err := f.OpenRaw()
+		if err != nil {
+			return err
+		}
+		w, err := zw.CreateRaw(&fh)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, r); err != nil {
+			return err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// msDosTime converts a time to an MS-DOS date and time, clamped to the range of MS-DOS times.
+func msDosTime(t time.Time) (date, tm uint16) {
+	t = t.UTC()
+	if t.Before(minEntryTime) {
+		t = minEntryTime
+	} else if t.After(maxEntryTime) {
+		t = maxEntryTime
+	}
+	date = uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	tm = uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+	return
+}
+
+// stripTimestamps removes the timestamp fields from the extra data of an entry.
+func stripTimestamps(extra []byte) []byte {
+	var res []byte
+	for len(extra) >= 4 {
+		tag := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if len(extra) < 4+size {
+			break
+		}
+		if !timestampFields[tag] {
+			res = append(res, extra[:4+size]...)
+		}
+		extra = extra[4+size:]
+	}
+	return res
+}
@@ -0,0 +1,82 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package pack
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSetTimestamps(t *testing.T) {
+	src := encryptTestEPUB(t)
+	dir := t.TempDir()
+	modified := time.Date(2021, 3, 14, 15, 9, 26, 0, time.UTC)
+
+	first, second := filepath.Join(dir, "first.epub"), filepath.Join(dir, "second.epub")
+	if err := SetTimestamps(src, first, modified); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetTimestamps(src, second, modified); err != nil {
+		t.Fatal(err)
+	}
+
+	before, files := readZip(t, src), readZip(t, first)
+	if len(files) != len(before) {
+		t.Fatalf("Expected %d entries, got %d", len(before), len(files))
+	}
+	for name, f := range files {
+		if !f.Modified.Equal(modified) {
+			t.Errorf("Expected %s to be modified at %v, got %v", name, modified, f.Modified)
+		}
+		if !bytes.Equal(rawBytes(t, f), rawBytes(t, before[name])) {
+			t.Errorf("Expected %s to be copied as-is", name)
+		}
+	}
+
+	// the output is reproducible
+	b1, _ := os.ReadFile(first)
+	b2, _ := os.ReadFile(second)
+	if !bytes.Equal(b1, b2) {
+		t.Error("Expected identical outputs")
+	}
+}
+
+func TestSetTimestampsOutOfRange(t *testing.T) {
+	src := encryptTestEPUB(t)
+	cases := []struct {
+		modified, expected time.Time
+	}{
+		{time.Unix(0, 0), minEntryTime},
+		{time.Date(1979, 12, 31, 23, 59, 59, 0, time.UTC), minEntryTime},
+		{time.Date(2108, 1, 1, 0, 0, 0, 0, time.UTC), maxEntryTime},
+		{time.Date(9999, 6, 1, 12, 0, 0, 0, time.UTC), maxEntryTime},
+	}
+	for _, c := range cases {
+		output := filepath.Join(t.TempDir(), "clamped.epub")
+		if err := SetTimestamps(src, output, c.modified); err != nil {
+			t.Fatal(err)
+		}
+		for name, f := range readZip(t, output) {
+			if !f.Modified.Equal(c.expected) {
+				t.Errorf("%v: expected %s to be modified at %v, got %v", c.modified, name, c.expected, f.Modified)
+			}
+		}
+	}
+}
+
+func TestParseEntryTimestamp(t *testing.T) {
+	if ts, err := ParseEntryTimestamp(EntryTimestampPublicationDate); err != nil || !ts.IsZero() {
+		t.Errorf("Expected the publication date, got %v (%v)", ts, err)
+	}
+	if ts, err := ParseEntryTimestamp("2000-01-01T00:00:00Z"); err != nil || !ts.Equal(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected a fixed time, got %v (%v)", ts, err)
+	}
+	for _, value := range []string{"yesterday", "2000-01-01", "PUBLICATION_DATE"} {
+		if _, err := ParseEntryTimestamp(value); err == nil {
+			t.Errorf("Expected an error for %q", value)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package pack
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// TranscriptMediaType is the media type of the transcripts and captions of audiobooks (WebVTT).
+const TranscriptMediaType = "text/vtt"
+
+// FindTranscripts returns the paths of the transcripts (WebVTT files) of the Readium Package at src,
+// in container order.
+func FindTranscripts(src string) ([]string, error) {
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	var transcripts []string
+	for _, f := range zr.File {
+		if strings.EqualFold(path.Ext(f.Name), ".vtt") && !f.FileInfo().IsDir() {
+			transcripts = append(transcripts, f.Name)
+		}
+	}
+	return transcripts, nil
+}
+
+// DeclareTranscripts rewrites the Readium Package at src into dst, declaring its transcripts
+// in the resources of its manifest with the WebVTT media type. The links which already reference
+// a transcript, e.g. an alternate of a track, are typed. The packager copies the resources of the
+// manifest in clear, so that transcripts are kept even if they are only referenced as alternates.
+// Other entries are copied byte for byte.
+func DeclareTranscripts(src, dst string, transcripts []string) error {
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	zw := zip.NewWriter(out)
+	for _, f := range zr.File {
+		if f.Name == ManifestName {
+			err = declareTranscripts(zw, f, transcripts)
+		} else {
+			err = copyRaw(zw, f)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// declareTranscripts copies the manifest after declaring the transcripts in its resources.
+// The manifest is decoded generically, so that properties unknown to this package are kept.
+func declareTranscripts(zw *zip.Writer, f *zip.File, transcripts []string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	dec := json.NewDecoder(rc)
+	dec.UseNumber()
+	var manifest map[string]any
+	if err := dec.Decode(&manifest); err != nil {
+		return err
+	}
+
+	isTranscript := make(map[string]bool, len(transcripts))
+	for _, name := range transcripts {
+		isTranscript[name] = true
+	}
+	for _, key := range []string{"readingOrder", "resources", "links"} {
+		typeTranscriptLinks(manifest[key], isTranscript)
+	}
+	resources, _ := manifest["resources"].([]any)
+	declared := make(map[string]bool)
+	for _, l := range resources {
+		if link, ok := l.(map[string]any); ok {
+			if href, ok := link["href"].(string); ok {
+				declared[linkPath(href)] = true
+			}
+		}
+	}
+	for _, name := range transcripts {
+		if !declared[name] {
+			resources = append(resources, map[string]any{"href": name, "type": TranscriptMediaType})
+		}
+	}
+	manifest["resources"] = resources
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return err
+	}
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: f.Name, Method: f.Method, Modified: f.Modified})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// typeTranscriptLinks sets the media type of the links to transcripts, in a list of links
+// and in their alternates and children.
+func typeTranscriptLinks(links any, isTranscript map[string]bool) {
+	list, ok := links.([]any)
+	if !ok {
+		return
+	}
+	for _, l := range list {
+		link, ok := l.(map[string]any)
+		if !ok {
+			continue
+		}
+		if href, ok := link["href"].(string); ok && isTranscript[linkPath(href)] {
+			link["type"] = TranscriptMediaType
+		}
+		typeTranscriptLinks(link["alternate"], isTranscript)
+		typeTranscriptLinks(link["children"], isTranscript)
+	}
+}
+
+// linkPath returns the path in the container referenced by the href of a manifest link.
+func linkPath(href string) string {
+	if name, err := url.PathUnescape(href); err == nil {
+		return name
+	}
+	return href
+}
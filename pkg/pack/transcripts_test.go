@@ -0,0 +1,86 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package pack
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/readium/readium-lcp-server/encrypt"
+	"github.com/readium/readium-lcp-server/rwpm"
+)
+
+func TestDeclareTranscripts(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "test.audiobook")
+	f, err := os.Create(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for _, e := range [][2]string{
+		{ManifestName, `{
+  "metadata": {"@type": "http://schema.org/Audiobook", "title": "Transcripts"},
+  "readingOrder": [
+    {"href": "track1.mp3", "type": "audio/mpeg", "alternate": [{"href": "track1.vtt"}]},
+    {"href": "track2.mp3", "type": "audio/mpeg"}
+  ]
+}`},
+		{"track1.mp3", "first track"},
+		{"track1.vtt", "WEBVTT\n\n00:00.000 --> 00:05.000\nFirst track"},
+		{"track2.mp3", "second track"},
+		{"captions/track2.VTT", "WEBVTT\n\n00:00.000 --> 00:05.000\nSecond track"},
+	} {
+		w, _ := zw.Create(e[0])
+		w.Write([]byte(e[1]))
+	}
+	zw.Close()
+	f.Close()
+
+	transcripts, err := FindTranscripts(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(transcripts, []string{"track1.vtt", "captions/track2.VTT"}) {
+		t.Fatalf("Unexpected transcripts %v", transcripts)
+	}
+	declared := filepath.Join(dir, "declared.audiobook")
+	if err := DeclareTranscripts(input, declared, transcripts); err != nil {
+		t.Fatal(err)
+	}
+
+	// the transcripts are kept in clear by the packager
+	pub, err := encrypt.ProcessEncryption("", "", declared, "", dir, "", "", "", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := readZip(t, filepath.Join(dir, pub.FileName))
+	for _, name := range transcripts {
+		if files[name] == nil {
+			t.Fatalf("Missing transcript %s", name)
+		}
+	}
+	if got := readAll(t, files["track1.vtt"].Open); got != "WEBVTT\n\n00:00.000 --> 00:05.000\nFirst track" {
+		t.Errorf("Expected a clear transcript, got %q", got)
+	}
+
+	var manifest rwpm.Publication
+	if err := json.Unmarshal([]byte(readAll(t, files[ManifestName].Open)), &manifest); err != nil {
+		t.Fatalf("Invalid manifest: %v", err)
+	}
+	if len(manifest.Resources) != 2 {
+		t.Fatalf("Expected 2 resources, got %+v", manifest.Resources)
+	}
+	for i, name := range transcripts {
+		if l := manifest.Resources[i]; l.Href != name || l.Type != TranscriptMediaType {
+			t.Errorf("Unexpected resource %+v", l)
+		}
+	}
+	if alt := manifest.ReadingOrder[0].Alternate; len(alt) != 1 || alt[0].Type != TranscriptMediaType {
+		t.Errorf("Expected a typed alternate, got %+v", alt)
+	}
+}
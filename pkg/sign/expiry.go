@@ -0,0 +1,39 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package sign
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"time"
+)
+
+// Expiry states of a certificate
+const (
+	CertificateValid    = "valid"
+	CertificateExpiring = "expiring" // expires within the warning window
+	CertificateExpired  = "expired"
+)
+
+// CertificateExpiry returns the expiry date of the leaf certificate of cert, and its expiry state
+// at now: expiring if it expires within window.
+func CertificateExpiry(cert *tls.Certificate, window time.Duration, now time.Time) (time.Time, string, error) {
+	leaf := cert.Leaf
+	if leaf == nil {
+		if len(cert.Certificate) == 0 {
+			return time.Time{}, "", errors.New("no certificate")
+		}
+		var err error
+		if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return time.Time{}, "", err
+		}
+	}
+	switch {
+	case !now.Before(leaf.NotAfter):
+		return leaf.NotAfter, CertificateExpired, nil
+	case now.Add(window).After(leaf.NotAfter):
+		return leaf.NotAfter, CertificateExpiring, nil
+	}
+	return leaf.NotAfter, CertificateValid, nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+package sign
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// newTestCertificate generates a self-signed provider certificate expiring at notAfter.
+func newTestCertificate(t *testing.T, notAfter time.Time) *tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Test provider"},
+		NotBefore:    notAfter.AddDate(-1, 0, 0),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestCertificateExpiry(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	// a certificate expiring in 10 days
+	cert := newTestCertificate(t, now.AddDate(0, 0, 10))
+	cases := []struct {
+		name   string
+		window time.Duration
+		now    time.Time
+		status string
+	}{
+		{"outside the window", 5 * 24 * time.Hour, now, CertificateValid},
+		{"within the window", 30 * 24 * time.Hour, now, CertificateExpiring},
+		{"expired", 30 * 24 * time.Hour, now.AddDate(0, 0, 11), CertificateExpired},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			notAfter, status, err := CertificateExpiry(cert, c.window, c.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status != c.status || !notAfter.Equal(now.AddDate(0, 0, 10)) {
+				t.Errorf("Expected %s on %s, got %s on %s", c.status, now.AddDate(0, 0, 10), status, notAfter)
+			}
+		})
+	}
+
+	if _, _, err := CertificateExpiry(&tls.Certificate{}, 0, now); err == nil {
+		t.Error("Expected an error without certificate")
+	}
+}
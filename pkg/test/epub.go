@@ -0,0 +1,77 @@
+// Copyright 2025 iTech Mobi. All rights reserved.
+
+// Package test provides fixtures shared by the tests of the different packages.
+package test
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"sort"
+	"testing"
+)
+
+// ContainerXML points to OEBPS/content.opf.
+const ContainerXML = `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>`
+
+// OPF returns an EPUB 3 package document built from the content of its metadata and manifest
+// elements, and from its spine element.
+func OPF(metadata, manifest, spine string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="uid">urn:uuid:4b2c3d60-2c7a-4b8e-9d0f-0c5a2f1b7e41</dc:identifier>
+` + metadata + `
+  </metadata>
+  <manifest>
+` + manifest + `
+  </manifest>
+  ` + spine + `
+</package>`
+}
+
+// DefaultOPF is a minimal package with a nav document and a single chapter.
+var DefaultOPF = OPF(
+	`    <dc:title>Test Book</dc:title>
+    <dc:language>en</dc:language>`,
+	`    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="ch1" href="chapter1.xhtml" media-type="application/xhtml+xml"/>`,
+	`<spine><itemref idref="ch1"/></spine>`)
+
+// BuildEPUB returns an EPUB made of the mimetype, the container file and the given files,
+// keyed by path. Unless provided, OEBPS/content.opf is set to DefaultOPF.
+func BuildEPUB(files map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, _ := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	w.Write([]byte("application/epub+zip"))
+	w, _ = zw.Create("META-INF/container.xml")
+	w.Write([]byte(ContainerXML))
+	if _, ok := files["OEBPS/content.opf"]; !ok {
+		w, _ = zw.Create("OEBPS/content.opf")
+		w.Write([]byte(DefaultOPF))
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		w, _ := zw.Create(name)
+		w.Write([]byte(files[name]))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+// WriteEPUB writes an EPUB generated by BuildEPUB at the given path.
+func WriteEPUB(tb testing.TB, path string, files map[string]string) {
+	if err := os.WriteFile(path, BuildEPUB(files), 0600); err != nil {
+		tb.Fatal(err)
+	}
+}